@@ -1,17 +1,35 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cbolanos79/shoppingbag_tracker/internal/api"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/auth"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/export"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/importer"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/ingest"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/mailbox"
 	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/quota"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/receipt_scanner"
 
 	"github.com/joho/godotenv"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/relvacode/iso8601"
 )
 
 func main() {
@@ -20,11 +38,45 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Subcommands for scripted tasks, server is started otherwise
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "import":
+			if err := runImport(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "mail":
+			if err := runMail(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "user":
+			if err := runUser(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		default:
+			log.Fatalf("Unknown command %s", os.Args[1])
+		}
+	}
+
+	// Google login is optional when other login methods are enabled, for instances which can not reach Google
 	google_client_id := os.Getenv("GOOGLE_CLIENT_ID")
-	if len(google_client_id) == 0 {
+	oidc_issuer := os.Getenv("OIDC_ISSUER")
+	if len(google_client_id) == 0 && len(oidc_issuer) == 0 && !auth.PasswordLoginEnabled() {
 		log.Fatal("Empty value for GOOGLE_CLIENT_ID")
 	}
 
+	if len(oidc_issuer) > 0 && len(os.Getenv("OIDC_CLIENT_ID")) == 0 {
+		log.Fatal("Empty value for OIDC_CLIENT_ID")
+	}
+
 	db_name := os.Getenv("DB_NAME")
 	if len(db_name) == 0 {
 		log.Fatal("Empty value for DB_NAME")
@@ -42,14 +94,446 @@ func main() {
 
 	model.InitDB(db)
 
+	if err := auth.PromoteAdmins(db); err != nil {
+		log.Fatal(err)
+	}
+
+	// Scan receipts saved to a folder, like a phone sync directory
+	if watch_dir := os.Getenv("WATCH_DIR"); len(watch_dir) > 0 {
+		if err := startWatcher(db, watch_dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.CORS())
 
-	e.GET("/receipts/:id", api.GetReceipt, echojwt.JWT([]byte(jwt_signature)), api.UserMiddleware)
-	e.GET("/receipts", api.GetReceipts, echojwt.JWT([]byte(jwt_signature)), api.UserMiddleware)
+	// Session tokens are validated as JWT, while API tokens are validated by UserMiddleware
+	jwt_middleware := echojwt.WithConfig(echojwt.Config{SigningKey: []byte(jwt_signature), Skipper: api.APITokenSkipper})
 
-	e.POST("/receipt", api.CreateReceipt, echojwt.JWT([]byte(jwt_signature)), api.UserMiddleware)
-	e.POST("/login/google", api.LoginGoogle)
+	e.GET("/receipts/:id", api.GetReceipt, jwt_middleware, api.UserMiddleware)
+	e.GET("/receipts", api.GetReceipts, jwt_middleware, api.UserMiddleware)
+	e.PUT("/receipts/:id", api.UpdateReceipt, jwt_middleware, api.UserMiddleware)
+	e.PATCH("/receipts/:id", api.UpdateReceipt, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/receipts/:id", api.DeleteReceipt, jwt_middleware, api.UserMiddleware)
+	e.POST("/receipts/:id/items", api.CreateReceiptItem, jwt_middleware, api.UserMiddleware)
+	e.PATCH("/receipts/:id/items/:item_id", api.UpdateReceiptItem, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/receipts/:id/items/:item_id", api.DeleteReceiptItem, jwt_middleware, api.UserMiddleware)
+	e.POST("/receipts/:id/restore", api.RestoreReceipt, jwt_middleware, api.UserMiddleware)
+	e.POST("/receipts/:id/items/:item_id/restore", api.RestoreReceiptItem, jwt_middleware, api.UserMiddleware)
+	e.GET("/receipts/:id/history", api.GetReceiptHistory, jwt_middleware, api.UserMiddleware)
+
+	e.GET("/price-changes", api.GetPriceChanges, jwt_middleware, api.UserMiddleware)
+	e.GET("/stats/spending", api.GetSpending, jwt_middleware, api.UserMiddleware)
+	e.GET("/stats/top-items", api.GetTopItems, jwt_middleware, api.UserMiddleware)
+	e.GET("/stats/inflation", api.GetInflation, jwt_middleware, api.UserMiddleware)
+	e.GET("/stats/shrinkflation", api.GetShrinkflation, jwt_middleware, api.UserMiddleware)
+	e.POST("/stats/basket", api.CompareBasket, jwt_middleware, api.UserMiddleware)
+	e.GET("/export", api.GetExport, jwt_middleware, api.UserMiddleware)
+	e.POST("/import", api.ImportReceipts, jwt_middleware, api.UserMiddleware)
+	e.GET("/products", api.GetProducts, jwt_middleware, api.UserMiddleware)
+	e.PATCH("/products/:id", api.UpdateProduct, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+
+	e.POST("/receipt", api.CreateReceipt, jwt_middleware, api.UserMiddleware)
+	e.POST("/receipts", api.CreateManualReceipt, jwt_middleware, api.UserMiddleware)
+	e.POST("/receipts/batch", api.CreateReceiptsBatch, jwt_middleware, api.UserMiddleware)
+	e.GET("/me", api.GetMe, jwt_middleware, api.UserMiddleware)
+	e.PATCH("/me", api.UpdateMe, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/me", api.DeleteMe, jwt_middleware, api.UserMiddleware)
+	e.GET("/me/export", api.GetMeExport, jwt_middleware, api.UserMiddleware)
+	e.POST("/households", api.CreateHousehold, jwt_middleware, api.UserMiddleware)
+	e.GET("/households", api.GetHouseholds, jwt_middleware, api.UserMiddleware)
+	e.GET("/households/:id", api.GetHousehold, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/households/:id", api.DeleteHousehold, jwt_middleware, api.UserMiddleware)
+	e.POST("/households/:id/members", api.AddHouseholdMember, jwt_middleware, api.UserMiddleware)
+	e.PATCH("/households/:id/members/:user_id", api.UpdateHouseholdMember, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/households/:id/members/:user_id", api.RemoveHouseholdMember, jwt_middleware, api.UserMiddleware)
+	e.POST("/invites", api.CreateInvite, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.GET("/invites", api.GetInvites, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.DELETE("/invites/:id", api.DeleteInvite, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.GET("/usage", api.GetUsage, jwt_middleware, api.UserMiddleware)
+	e.GET("/categories", api.GetCategories, jwt_middleware, api.UserMiddleware)
+	e.GET("/admin/users", api.GetAdminUsers, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.PATCH("/admin/users/:id", api.UpdateAdminUser, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.POST("/admin/receipts/:id/reparse", api.ReparseReceipt, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.GET("/admin/chains", api.GetStoreChains, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.POST("/admin/chains", api.CreateStoreChain, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.DELETE("/admin/chains/:id", api.DeleteStoreChain, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.POST("/admin/categories", api.CreateCategory, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.PATCH("/admin/categories/:id", api.UpdateCategory, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.DELETE("/admin/categories/:id", api.DeleteCategory, jwt_middleware, api.UserMiddleware, api.AdminMiddleware)
+	e.GET("/me/tokens", api.GetAPITokens, jwt_middleware, api.UserMiddleware)
+	e.POST("/me/tokens", api.CreateAPIToken, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/me/tokens/:id", api.DeleteAPIToken, jwt_middleware, api.UserMiddleware)
+	e.GET("/login/providers", api.GetLoginProviders)
+	e.POST("/auth/refresh", api.RefreshToken)
+	e.POST("/auth/logout", api.Logout, jwt_middleware, api.UserMiddleware)
+	e.GET("/auth/sessions", api.GetSessions, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/auth/sessions", api.DeleteSessions, jwt_middleware, api.UserMiddleware)
+	e.DELETE("/auth/sessions/:id", api.DeleteSession, jwt_middleware, api.UserMiddleware)
+	if len(google_client_id) > 0 {
+		e.POST("/login/google", api.LoginGoogle)
+	}
+	if len(oidc_issuer) > 0 {
+		e.POST("/login/oidc", api.LoginOIDC)
+	}
+	if auth.PasswordLoginEnabled() {
+		e.POST("/login/password", api.LoginPassword)
+	}
 	e.Logger.Fatal(e.Start(fmt.Sprintf(":%s", os.Getenv("PORT"))))
 }
+
+// Export receipt items for a user to a file or standard output
+// Usage: main export -user 1 -format csv [-output file] [-supermarket name] [-item name] [-min-date date] [-max-date date]
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	user_id := flags.Int("user", 0, "ID of user whose receipts are exported")
+	format := flags.String("format", export.FormatCSV, "Export format: csv, json or xlsx")
+	output := flags.String("output", "", "Output file, standard output if empty")
+	supermarket := flags.String("supermarket", "", "Filter by supermarket")
+	item := flags.String("item", "", "Filter receipts including item")
+	min_date := flags.String("min-date", "", "Filter receipts from date (ISO8601)")
+	max_date := flags.String("max-date", "", "Filter receipts until date (ISO8601)")
+	flags.Parse(args)
+
+	if _, err := export.ContentType(*format); err != nil {
+		return err
+	}
+
+	filters := model.ReceiptFilter{Supermarket: *supermarket, Item: *item}
+
+	if len(*min_date) > 0 {
+		date, err := iso8601.ParseString(*min_date)
+		if err != nil {
+			return fmt.Errorf("Error in min-date format: %v", err)
+		}
+		filters.MinDate = &date
+
+		if len(*max_date) > 0 {
+			date, err := iso8601.ParseString(*max_date)
+			if err != nil {
+				return fmt.Errorf("Error in max-date format: %v", err)
+			}
+			filters.MaxDate = &date
+		}
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := model.InitDB(db); err != nil {
+		return err
+	}
+
+	user, err := model.FindUserById(db, *user_id)
+	if err != nil {
+		return fmt.Errorf("Error getting user %d: %v", *user_id, err)
+	}
+
+	var w io.Writer = os.Stdout
+
+	if len(*output) > 0 {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return export.Write(w, *format, db, user, &filters)
+}
+
+// Import receipts for a user from a CSV or JSON file, printing the report as JSON
+// Usage: main import -user 1 -file receipts.csv [-format csv] [-dry-run]
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	user_id := flags.Int("user", 0, "ID of user who owns imported receipts")
+	path := flags.String("file", "", "File to import")
+	format := flags.String("format", "", "Import format: csv or json, file extension if empty")
+	dry_run := flags.Bool("dry-run", false, "Validate file without storing receipts")
+	flags.Parse(args)
+
+	if len(*path) == 0 {
+		return fmt.Errorf("Missing file to import")
+	}
+
+	if len(*format) == 0 {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*path)), ".")
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	db, err := model.NewDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := model.InitDB(db); err != nil {
+		return err
+	}
+
+	user, err := model.FindUserById(db, *user_id)
+	if err != nil {
+		return fmt.Errorf("Error getting user %d: %v", *user_id, err)
+	}
+
+	report, err := importer.Import(db, user, file, importer.Options{Format: *format, DryRun: *dry_run, Threshold: api.PriceChangeThreshold()})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// Create receipts from .eml files given as arguments, or from unseen emails in an IMAP mailbox
+// Recipient addresses are matched with users in MAIL_USERS, and HTML e-tickets are read with templates in MAIL_TEMPLATES
+// Usage: main mail file.eml [file.eml...]
+//
+//	main mail -imap [-once]
+func runMail(args []string) error {
+	flags := flag.NewFlagSet("mail", flag.ExitOnError)
+	use_imap := flags.Bool("imap", false, "Read unseen emails from mailbox set in IMAP_ADDR")
+	once := flags.Bool("once", false, "Check mailbox once instead of every MAIL_INTERVAL seconds")
+	flags.Parse(args)
+
+	if !*use_imap && flags.NArg() == 0 {
+		return fmt.Errorf("Missing emails to read")
+	}
+
+	users, err := mailbox.UsersFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		return fmt.Errorf("Empty value for MAIL_USERS")
+	}
+
+	templates := []mailbox.Template{}
+	if path := os.Getenv("MAIL_TEMPLATES"); len(path) > 0 {
+		templates, err = mailbox.LoadTemplates(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := model.InitDB(db); err != nil {
+		return err
+	}
+
+	session, err := receipt_scanner.NewAwsSession()
+	if err != nil {
+		return err
+	}
+
+	ingester := mailbox.Ingester{
+		DB:          db,
+		Users:       users,
+		Templates:   templates,
+		Concurrency: ingest.Concurrency(),
+		Scan: func(user *model.User, data []byte) (*model.Receipt, error) {
+			return quota.NewScanner(db, session, user.ID, model.ScanSourceEmail)(data)
+		},
+		Created: func(user *model.User, receipt *model.Receipt) {
+			api.DetectPriceChanges(db, user, receipt)
+		},
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if !*use_imap {
+		for _, path := range flags.Args() {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+
+			results, err := ingester.Process(file)
+			file.Close()
+
+			if err != nil {
+				return fmt.Errorf("Error reading email %s: %v", path, err)
+			}
+
+			if err := encoder.Encode(results); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	interval := 60 * time.Second
+	if value := os.Getenv("MAIL_INTERVAL"); len(value) > 0 {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 1 {
+			return fmt.Errorf("Invalid value for MAIL_INTERVAL: %s", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	for {
+		results, err := pollMailbox(&ingester)
+		if err != nil {
+			if *once {
+				return err
+			}
+			log.Printf("Error checking mailbox\n%v", err)
+		} else if len(results) > 0 {
+			encoder.Encode(results)
+		}
+
+		if *once {
+			return nil
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// Connect to mailbox set in IMAP_ADDR and create receipts from unseen emails
+func pollMailbox(ingester *mailbox.Ingester) ([]ingest.Result, error) {
+	address := os.Getenv("IMAP_ADDR")
+	if len(address) == 0 {
+		return nil, fmt.Errorf("Empty value for IMAP_ADDR")
+	}
+
+	client, err := mailbox.DialIMAP(address, os.Getenv("IMAP_TLS") != "false")
+	if err != nil {
+		return nil, err
+	}
+	defer client.Logout()
+
+	if err := client.Login(os.Getenv("IMAP_USERNAME"), os.Getenv("IMAP_PASSWORD")); err != nil {
+		return nil, err
+	}
+
+	folder := os.Getenv("IMAP_MAILBOX")
+	if len(folder) == 0 {
+		folder = "INBOX"
+	}
+
+	if err := client.Select(folder); err != nil {
+		return nil, err
+	}
+
+	return ingester.PollIMAP(client)
+}
+
+// Watch given folder in background, storing receipts for user set in WATCH_USER
+// Folder is checked every WATCH_INTERVAL seconds, 30 by default
+func startWatcher(db *sql.DB, dir string) error {
+	user_id, err := strconv.Atoi(os.Getenv("WATCH_USER"))
+	if err != nil {
+		return fmt.Errorf("Invalid value for WATCH_USER: %v", err)
+	}
+
+	user, err := model.FindUserById(db, user_id)
+	if err != nil {
+		return fmt.Errorf("Error getting user %d to watch folder: %v", user_id, err)
+	}
+
+	interval := 30 * time.Second
+	if value := os.Getenv("WATCH_INTERVAL"); len(value) > 0 {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 1 {
+			return fmt.Errorf("Invalid value for WATCH_INTERVAL: %s", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	session, err := receipt_scanner.NewAwsSession()
+	if err != nil {
+		return err
+	}
+
+	watcher := ingest.Watcher{
+		Dir:         dir,
+		DB:          db,
+		User:        user,
+		Concurrency: ingest.Concurrency(),
+		Interval:    interval,
+		Scan:        quota.NewScanner(db, session, user.ID, model.ScanSourceWatch),
+		Created: func(receipt *model.Receipt) {
+			api.DetectPriceChanges(db, user, receipt)
+		},
+	}
+
+	log.Printf("Watching folder %s for user %d every %v\n", dir, user.ID, interval)
+	go watcher.Run(context.Background())
+
+	return nil
+}
+
+// Manage users for local login, reading password from standard input
+// Usage: main user create -username name [-email address]
+//
+//	main user password -username name
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Missing user command, create or password")
+	}
+
+	flags := flag.NewFlagSet("user", flag.ExitOnError)
+	username := flags.String("username", "", "Username for local login")
+	email := flags.String("email", "", "Email of new user")
+	flags.Parse(args[1:])
+
+	if len(*username) == 0 {
+		return fmt.Errorf("Missing username")
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	db, err := model.NewDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := model.InitDB(db); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		user, err := auth.CreatePasswordUser(db, *username, *email, password)
+		if err != nil {
+			return fmt.Errorf("Error creating user %s: %v", *username, err)
+		}
+		fmt.Printf("Created user %d\n", user.ID)
+	case "password":
+		if err := auth.ResetPassword(db, *username, password); err != nil {
+			return fmt.Errorf("Error changing password for user %s: %v", *username, err)
+		}
+		fmt.Println("Password changed")
+	default:
+		return fmt.Errorf("Unknown user command %s", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/quota"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/receipt_scanner"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type AdminUserUpdate struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+type CategoryRequest struct {
+	Name string `json:"name"`
+}
+
+// Return every user with their receipts, scans and storage used
+func GetAdminUsers(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetAdminUsers - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	users, err := model.FindAllUsersWithUsage(db)
+	if err != nil {
+		log.Println("GetAdminUsers - Error getting users\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting users", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"users": users})
+}
+
+// Change role of a user or disable it, disabled users are logged out of every session
+func UpdateAdminUser(c echo.Context) error {
+	user_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in user id format", []string{err.Error()}})
+	}
+
+	update := AdminUserUpdate{}
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	// Administrators can not lock themselves out
+	admin := c.Get("user_id").(*model.User)
+	if admin.ID == user_id {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating user", []string{"Administrators can not change their own role or disable themselves"}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UpdateAdminUser - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	if update.Role != nil {
+		err = model.SetUserRole(db, user_id, *update.Role)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"User not found", []string{err.Error()}})
+		}
+
+		if err != nil {
+			log.Println("UpdateAdminUser - Error updating role\n", err)
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating user", []string{err.Error()}})
+		}
+	}
+
+	if update.Disabled != nil {
+		err = model.SetUserDisabled(db, user_id, *update.Disabled)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"User not found", []string{err.Error()}})
+		}
+
+		if err == nil && *update.Disabled {
+			err = model.RevokeAllSessions(db, user_id)
+		}
+
+		if err != nil {
+			log.Println("UpdateAdminUser - Error disabling user\n", err)
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating user", []string{err.Error()}})
+		}
+	}
+
+	user, err := model.FindUserById(db, int(user_id))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorMessage{"User not found", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"user": user})
+}
+
+// Scan original file of a receipt again, replacing its values and items
+func ReparseReceipt(c echo.Context) error {
+	receipt_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("ReparseReceipt - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	image_path, err := model.FindReceiptImage(db, receipt_id)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, ErrorMessage{"Original file of receipt not found", []string{err.Error()}})
+	}
+
+	if err != nil {
+		log.Println("ReparseReceipt - Error getting receipt\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting receipt", []string{err.Error()}})
+	}
+
+	data, err := storage.Read(image_path)
+	if err != nil {
+		log.Println("ReparseReceipt - Error reading original file\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading original file", []string{err.Error()}})
+	}
+
+	session, err := receipt_scanner.NewAwsSession()
+	if err != nil {
+		log.Println("ReparseReceipt - Error creating new aws session\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to aws", []string{err.Error()}})
+	}
+
+	admin := c.Get("user_id").(*model.User)
+
+	// Scan is charged to administrator who requested it
+	parsed, err := quota.NewScanner(db, session, admin.ID, model.ScanSourceReparse)(data)
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		return c.JSON(http.StatusTooManyRequests, ErrorMessage{"Scan not allowed", []string{err.Error()}})
+	}
+
+	if err != nil {
+		log.Println("ReparseReceipt - Error analyzing file\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error analyzing file", []string{err.Error()}})
+	}
+
+	if err := model.ValidateReceipt(parsed); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Invalid receipt", []string{err.Error()}})
+	}
+
+	receipt, err := model.ReparseReceipt(db, receipt_id, admin.ID, parsed)
+	if err != nil {
+		log.Println("ReparseReceipt - Error updating receipt\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating receipt", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Receipt parsed successfully", "receipt": receipt})
+}
+
+// Return store chains used to name supermarkets
+func GetStoreChains(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetStoreChains - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	chains, err := model.FindAllStoreChains(db)
+	if err != nil {
+		log.Println("GetStoreChains - Error getting store chains\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting store chains", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"chains": chains})
+}
+
+// Create a store chain, renaming receipts of matching supermarkets
+func CreateStoreChain(c echo.Context) error {
+	chain := model.StoreChain{}
+	if err := c.Bind(&chain); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateStoreChain - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	renamed, err := model.CreateStoreChain(db, &chain)
+	if err != nil {
+		log.Println("CreateStoreChain - Error creating store chain\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating store chain", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"chain": chain, "renamed_receipts": renamed})
+}
+
+func DeleteStoreChain(c echo.Context) error {
+	chain_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in store chain id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteStoreChain - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	if err := model.DeleteStoreChain(db, chain_id); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Store chain not found", []string{err.Error()}})
+		}
+
+		log.Println("DeleteStoreChain - Error deleting store chain\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error deleting store chain", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Store chain deleted successfully"})
+}
+
+// Return categories which can be set to products
+func GetCategories(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetCategories - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	categories, err := model.FindAllCategories(db)
+	if err != nil {
+		log.Println("GetCategories - Error getting categories\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting categories", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"categories": categories})
+}
+
+func CreateCategory(c echo.Context) error {
+	request := CategoryRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateCategory - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	category := model.Category{Name: request.Name}
+	if err := model.CreateCategory(db, &category); err != nil {
+		log.Println("CreateCategory - Error creating category\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating category", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"category": category})
+}
+
+// Rename a category, products keep it with its new name
+func UpdateCategory(c echo.Context) error {
+	category_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in category id format", []string{err.Error()}})
+	}
+
+	request := CategoryRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UpdateCategory - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	if err := model.RenameCategory(db, category_id, request.Name); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Category not found", []string{err.Error()}})
+		}
+
+		log.Println("UpdateCategory - Error renaming category\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating category", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Category updated successfully"})
+}
+
+// Delete a category, products with it are left without category
+func DeleteCategory(c echo.Context) error {
+	category_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in category id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteCategory - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	if err := model.DeleteCategory(db, category_id); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Category not found", []string{err.Error()}})
+		}
+
+		log.Println("DeleteCategory - Error deleting category\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error deleting category", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Category deleted successfully"})
+}
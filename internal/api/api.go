@@ -2,16 +2,23 @@ package api
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/cbolanos79/shoppingbag_tracker/internal/auth"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/ingest"
 	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/oidc"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/quota"
 	"github.com/cbolanos79/shoppingbag_tracker/internal/receipt_scanner"
-	"github.com/relvacode/iso8601"
 
 	"github.com/golang-jwt/jwt/v5"
 
@@ -21,12 +28,20 @@ import (
 
 type Login struct {
 	Credential string `json:"credential"`
+	InviteCode string `json:"invite_code"`
+}
+
+type PasswordLogin struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 type UserProfile struct {
-	Name       string `json:"name"`
-	PictureUrl string `json:"picture_url"`
-	AuthToken  string `json:"auth_token"`
+	Name         string    `json:"name"`
+	PictureUrl   string    `json:"picture_url"`
+	AuthToken    string    `json:"auth_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
 }
 
 type ErrorMessage struct {
@@ -58,42 +73,174 @@ func LoginGoogle(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error validating user", []string{err.Error()}})
 	}
 
-	// Check if user exists
+	// idtoken.Validate checks expiration too, this check is kept in case it is skipped
+	if time.Now().Unix() > payload.Expires {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Expired credential", []string{"Credential is expired"}})
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	email_verified, _ := payload.Claims["email_verified"].(bool)
+	name, _ := payload.Claims["name"].(string)
+	picture, _ := payload.Claims["picture"].(string)
+	locale, _ := payload.Claims["locale"].(string)
+
+	identity := loginIdentity{model.GoogleIssuer, payload.Subject, email, email_verified, name, picture, locale}
+
+	return loginWithIdentity(c, "LoginGoogle", &identity, login.InviteCode)
+}
+
+// Receive ID token from OpenID Connect provider set in OIDC_ISSUER, like Authentik or Keycloak
+// Users are linked by issuer and subject of the token, and registered like Google users
+func LoginOIDC(c echo.Context) error {
+	login := Login{}
+	c.Bind(&login)
+
+	if len(login.Credential) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"message": "Missing credential value"})
+	}
+
+	provider := oidcProvider()
+	if provider == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "OpenID Connect login is not enabled"})
+	}
+
+	claims, err := provider.Validate(c.Request().Context(), login.Credential)
+	if err != nil {
+		log.Printf("LoginOIDC - Error validating user in %s: %v\n", provider.Issuer, err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error validating user", []string{err.Error()}})
+	}
+
+	identity := loginIdentity{provider.Issuer, claims.Subject, claims.Email, claims.EmailVerified, claims.Name, claims.Picture, claims.Locale}
+
+	return loginWithIdentity(c, "LoginOIDC", &identity, login.InviteCode)
+}
+
+// Return login methods enabled, so clients can show them
+func GetLoginProviders(c echo.Context) error {
+	providers := echo.Map{"password": auth.PasswordLoginEnabled()}
+
+	if google_client_id := os.Getenv("GOOGLE_CLIENT_ID"); len(google_client_id) > 0 {
+		providers["google"] = echo.Map{"client_id": google_client_id}
+	}
+
+	if provider := oidcProvider(); provider != nil {
+		discovery, err := provider.Discover(c.Request().Context())
+		if err != nil {
+			log.Printf("GetLoginProviders - Error reading discovery document from %s: %v\n", provider.Issuer, err)
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading OpenID Connect provider", []string{err.Error()}})
+		}
+
+		providers["oidc"] = echo.Map{
+			"name":                   os.Getenv("OIDC_NAME"),
+			"issuer":                 provider.Issuer,
+			"client_id":              provider.ClientID,
+			"authorization_endpoint": discovery.AuthorizationEndpoint,
+		}
+	}
+
+	return c.JSON(http.StatusOK, providers)
+}
+
+// OpenID Connect provider is created once, so its keys are cached between logins
+var oidcProvider = sync.OnceValue(oidc.ProviderFromEnv)
+
+// User identity validated by a login provider
+type loginIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	Locale        string
+}
+
+// Find user linked with identity, registering it on first login, and return profile with auth token
+func loginWithIdentity(c echo.Context, handler string, identity *loginIdentity, invite_code string) error {
 	db, err := model.NewDB()
 	if err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error accessing database", []string{err.Error()}})
 	}
 	defer db.Close()
 
-	user, err := model.FindUserByGoogleUid(db, payload.Subject)
+	user, err := model.FindUserByIdentity(db, identity.Issuer, identity.Subject)
+
+	// Create user on first login if registration mode allows it
+	if err == sql.ErrNoRows {
+		registration := auth.Registration{Issuer: identity.Issuer, Subject: identity.Subject, Email: identity.Email, EmailVerified: identity.EmailVerified, InviteCode: invite_code}
+
+		user, err = auth.Register(db, auth.Mode(), auth.AllowedEmails(), &registration)
+		if err != nil {
+			log.Printf("%s - User %s can not register, error %v\n", handler, identity.Subject, err)
+			return c.JSON(http.StatusForbidden, ErrorMessage{"User not allowed to register", []string{err.Error()}})
+		}
+
+		log.Printf("%s - Registered user %d for %s\n", handler, user.ID, identity.Subject)
+	}
+
 	if err != nil {
-		log.Printf("GoogleLogin - User %s not found, error %v\n", payload.Subject, err)
+		log.Printf("%s - User %s not found, error %v\n", handler, identity.Subject, err)
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"User not found", []string{err.Error()}})
 	}
 
-	// Check if token is expired
-	if time.Now().Unix() > payload.Expires {
-		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Expired credential", []string{err.Error()}})
+	// Keep profile values from provider up to date
+	if err := model.UpdateUserLogin(db, user, identity.Email, identity.Name, identity.Picture, identity.Locale); err != nil {
+		log.Printf("%s - Error updating profile for user %d, error %v\n", handler, user.ID, err)
 	}
 
-	claims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-		Subject:   fmt.Sprint(user.ID),
+	userProfile, err := startSession(c, db, user)
+	if err == model.ErrUserDisabled {
+		return c.JSON(http.StatusForbidden, ErrorMessage{"User not allowed to log in", []string{err.Error()}})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwt_signature := os.Getenv("JWT_SIGNATURE")
-
-	ss, err := token.SignedString([]byte(jwt_signature))
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Error signing JWT token for user %s", payload.Subject), err.Error())
+		log.Printf("%s - Error creating session for user %d: %v\n", handler, user.ID, err)
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating token for user", []string{err.Error()}})
 	}
 
-	userProfile := UserProfile{payload.Claims["name"].(string), payload.Claims["picture"].(string), ss}
-
 	// Return HTTP 200 if success
-	return c.JSON(http.StatusOK, &userProfile)
+	return c.JSON(http.StatusOK, userProfile)
+}
+
+// Receive username and password for local login, and return the same token as Google login if they are valid
+func LoginPassword(c echo.Context) error {
+	login := PasswordLogin{}
+	if err := c.Bind(&login); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	if len(login.Username) == 0 || len(login.Password) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"message": "Missing username or password"})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error accessing database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user, err := auth.LoginPassword(db, login.Username, login.Password)
+	if err == auth.ErrInvalidCredentials {
+		log.Printf("LoginPassword - Invalid credentials for %s\n", login.Username)
+		return c.JSON(http.StatusUnauthorized, ErrorMessage{"Error validating user", []string{err.Error()}})
+	}
+
+	if err != nil {
+		log.Printf("LoginPassword - Error validating user %s: %v\n", login.Username, err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error validating user", []string{err.Error()}})
+	}
+
+	userProfile, err := startSession(c, db, user)
+	if err == model.ErrUserDisabled {
+		return c.JSON(http.StatusForbidden, ErrorMessage{"User not allowed to log in", []string{err.Error()}})
+	}
+
+	if err != nil {
+		log.Printf("LoginPassword - Error creating session for user %d: %v\n", user.ID, err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating token for user", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, userProfile)
 }
 
 // Create a receipt from given file using a valid user, or return error with status 422 if can not create
@@ -107,6 +254,15 @@ func CreateReceipt(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error opening file", []string{err.Error()}})
 	}
 
+	// Receipt can be shared in a household
+	var household_id int64
+	if value := c.FormValue("household_id"); len(value) > 0 {
+		household_id, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in household_id param format", []string{err.Error()}})
+		}
+	}
+
 	session, err := receipt_scanner.NewAwsSession()
 	if err != nil {
 		log.Println("CreateReceipt - Error creating new aws session\n", err)
@@ -126,20 +282,44 @@ func CreateReceipt(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error opening file", []string{err.Error()}})
 	}
 
-	receipt, err := receipt_scanner.Scan(session, f, file.Size)
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		log.Println("CreateReceipt - Error reading file\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error opening file", []string{err.Error()}})
+	}
+
+	user := c.Get("user_id").(*model.User)
+
+	receipt, err := quota.NewScanner(db, session, user.ID, model.ScanSourceUpload)(data)
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		return c.JSON(http.StatusTooManyRequests, ErrorMessage{"Scan not allowed", []string{err.Error()}})
+	}
+
 	if err != nil {
 		log.Println("CreateReceipt - Error opening file\n", err)
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error analyzing file", []string{err.Error()}})
 	}
 
-	user := c.Get("user_id").(*model.User)
+	if err := model.ValidateReceipt(receipt); err != nil {
+		log.Println("CreateReceipt - Invalid receipt\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Invalid receipt", []string{err.Error()}})
+	}
+
 	receipt.UserID = user.ID
+	receipt.HouseholdID = household_id
 
 	_, err = model.CreateReceipt(db, receipt)
 	if err != nil {
 		log.Println("CreateReceipt - Error creating receipt\n", err)
 		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating receipt", []string{err.Error()}})
 	}
+
+	ingest.KeepOriginal(db, receipt, ingest.File{Name: file.Filename, Data: data})
+
+	DetectPriceChanges(db, user, receipt)
+
 	return c.JSON(http.StatusOK, echo.Map{"message": "Receipt created successfully", "receipt": receipt})
 }
 
@@ -155,7 +335,27 @@ func GetReceipts(c echo.Context) error {
 
 	user := c.Get("user_id").(*model.User)
 
+	filters, emsg := receiptFilterFromQuery(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	receipts, err := model.FindAllReceiptsForUser(db, user, filters)
+	if err != nil {
+		log.Println("GetReceipts - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting receipts list", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"receipts": receipts})
+}
+
+// Read receipt filters from query params, or return error message if any of them has wrong format
+// Dates are read in timezone of current user
+func receiptFilterFromQuery(c echo.Context) (*model.ReceiptFilter, *ErrorMessage) {
 	var filters model.ReceiptFilter
+	var err error
+
+	user := c.Get("user_id").(*model.User)
 
 	// Supermarket filter
 	filters.Supermarket = c.QueryParam("supermarket")
@@ -166,48 +366,69 @@ func GetReceipts(c echo.Context) error {
 	max_date := c.QueryParam("max_date")
 	filters.Item = c.QueryParam("item")
 
+	// Household and member filters
+	var emsg *ErrorMessage
+	filters.HouseholdID, filters.MemberID, emsg = householdFilterFromQuery(c)
+	if emsg != nil {
+		return nil, emsg
+	}
+
 	// Page filter
 	if len(page) > 0 && len(per_page) > 0 {
 		filters.Page, err = strconv.ParseInt(page, 10, 64)
 		if err != nil {
-			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in page param format", []string{err.Error()}})
+			return nil, &ErrorMessage{"Error in page param format", []string{err.Error()}}
 		}
 
 		filters.PerPage, err = strconv.ParseInt(per_page, 10, 64)
 		if err != nil {
-			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in per_page param format", []string{err.Error()}})
+			return nil, &ErrorMessage{"Error in per_page param format", []string{err.Error()}}
 		}
 	}
 
 	// Minimum date
 	if len(min_date) > 0 {
-		// Parse ISO8601 format
-		tmin_date, err := iso8601.ParseString(min_date)
+		tmin_date, err := user.ParseDate(min_date)
 		if err != nil {
-			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in min_date param format", []string{err.Error()}})
+			return nil, &ErrorMessage{"Error in min_date param format", []string{err.Error()}}
 		}
 
 		filters.MinDate = &tmin_date
 
 		// Maximum date
 		if len(max_date) > 0 && filters.MinDate != nil {
-			// Parse ISO8601 format
-			tmax_date, err := iso8601.ParseString(max_date)
+			tmax_date, err := user.ParseDate(max_date)
 			if err != nil {
-				return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in max_date param format", []string{err.Error()}})
+				return nil, &ErrorMessage{"Error in max_date param format", []string{err.Error()}}
 			}
 
 			filters.MaxDate = &tmax_date
 		}
 	}
 
-	receipts, err := model.FindAllReceiptsForUser(db, user, &filters)
-	if err != nil {
-		log.Println("GetReceipts - Error connecting to database\n", err)
-		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting receipts list", []string{err.Error()}})
+	return &filters, nil
+}
+
+// Read household_id and member_id params, to get receipts of a household or created by one of its members
+func householdFilterFromQuery(c echo.Context) (int64, int64, *ErrorMessage) {
+	var household_id, member_id int64
+	var err error
+
+	if value := c.QueryParam("household_id"); len(value) > 0 {
+		household_id, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, 0, &ErrorMessage{"Error in household_id param format", []string{err.Error()}}
+		}
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{"receipts": receipts})
+	if value := c.QueryParam("member_id"); len(value) > 0 {
+		member_id, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, 0, &ErrorMessage{"Error in member_id param format", []string{err.Error()}}
+		}
+	}
+
+	return household_id, member_id, nil
 }
 
 // Return list of items for given receipt owned by user
@@ -240,6 +461,11 @@ func GetReceipt(c echo.Context) error {
 // Check if user from jwt exists or stop if not
 func UserMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		// API tokens skip JWT validation and are checked here
+		if value, ok := bearerAPIToken(c); ok {
+			return apiTokenMiddleware(c, value, next)
+		}
+
 		token := c.Get("user").(*jwt.Token)
 
 		user_id, err := token.Claims.GetSubject()
@@ -267,7 +493,43 @@ func UserMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			return echo.ErrUnauthorized
 		}
 
+		// Disabled users can not use tokens issued before they were disabled
+		if user.DisabledAt != nil {
+			return echo.ErrUnauthorized
+		}
+
+		// Every access token belongs to a session, so tokens without one are rejected as well as tokens of revoked sessions
+		// Tokens issued before sessions existed had no session, and they expired 24 hours after being issued
+		session_id, err := sessionID(token)
+		if err != nil {
+			log.Println("UserMiddleware - Token without session\n", err)
+			return echo.ErrUnauthorized
+		}
+
+		if err := model.CheckSessionActive(db, session_id, user.ID); err != nil {
+			return echo.ErrUnauthorized
+		}
+		c.Set("session_id", session_id)
+
 		c.Set("user_id", user)
 		return next(c)
 	}
 }
+
+// Allow request only for users with given role, must be used after UserMiddleware
+func RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := c.Get("user_id").(*model.User)
+
+			if !auth.HasRole(user, role) {
+				return c.JSON(http.StatusForbidden, ErrorMessage{fmt.Sprintf("Role %s required", role), []string{}})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Allow request only for administrators, must be used after UserMiddleware
+var AdminMiddleware = RequireRole(model.UserRoleAdmin)
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/auth"
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+type APITokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+
+	// Token never expires if empty
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// Scope needed to use each route with an API token, routes not listed here can only be used with session tokens
+var routeScopes = map[string]string{
+	"GET /receipts":                    model.ScopeRead,
+	"GET /receipts/:id":                model.ScopeRead,
+	"GET /receipts/:id/history":        model.ScopeRead,
+	"GET /price-changes":               model.ScopeRead,
+	"GET /stats/spending":              model.ScopeRead,
+	"GET /stats/top-items":             model.ScopeRead,
+	"GET /stats/inflation":             model.ScopeRead,
+	"GET /stats/shrinkflation":         model.ScopeRead,
+	"POST /stats/basket":               model.ScopeRead,
+	"GET /products":                    model.ScopeRead,
+	"GET /households":                  model.ScopeRead,
+	"GET /households/:id":              model.ScopeRead,
+	"GET /me":                          model.ScopeRead,
+	"POST /receipt":                    model.ScopeUpload,
+	"POST /receipts":                   model.ScopeUpload,
+	"POST /receipts/batch":             model.ScopeUpload,
+	"POST /import":                     model.ScopeUpload,
+	"GET /export":                      model.ScopeExport,
+	"GET /me/export":                   model.ScopeExport,
+	"POST /invites":                    model.ScopeAdmin,
+	"GET /invites":                     model.ScopeAdmin,
+	"DELETE /invites/:id":              model.ScopeAdmin,
+	"GET /usage":                       model.ScopeRead,
+	"GET /categories":                  model.ScopeRead,
+	"GET /admin/users":                 model.ScopeAdmin,
+	"PATCH /admin/users/:id":           model.ScopeAdmin,
+	"POST /admin/receipts/:id/reparse": model.ScopeAdmin,
+	"GET /admin/chains":                model.ScopeAdmin,
+	"POST /admin/chains":               model.ScopeAdmin,
+	"DELETE /admin/chains/:id":         model.ScopeAdmin,
+	"POST /admin/categories":           model.ScopeAdmin,
+	"PATCH /admin/categories/:id":      model.ScopeAdmin,
+	"DELETE /admin/categories/:id":     model.ScopeAdmin,
+}
+
+// Return API token sent as bearer token, if any
+func bearerAPIToken(c echo.Context) (string, bool) {
+	value, found := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !found || !strings.HasPrefix(value, model.APITokenPrefix) {
+		return "", false
+	}
+
+	return value, true
+}
+
+// Skip JWT validation for requests with API tokens, which are validated by UserMiddleware
+func APITokenSkipper(c echo.Context) bool {
+	_, ok := bearerAPIToken(c)
+	return ok
+}
+
+// Set user of API token for current request, if token has the scope needed by route
+func apiTokenMiddleware(c echo.Context, value string, next echo.HandlerFunc) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UserMiddleware - Error connecting to database\n", err)
+		return echo.ErrUnauthorized
+	}
+	defer db.Close()
+
+	token, err := model.FindAPIToken(db, value)
+	if err != nil {
+		log.Println("UserMiddleware - Invalid API token\n", err)
+		return echo.ErrUnauthorized
+	}
+
+	user, err := model.FindUserById(db, int(token.UserID))
+	if err != nil {
+		log.Println("UserMiddleware - User not found\n", err)
+		return echo.ErrUnauthorized
+	}
+
+	if user.DisabledAt != nil {
+		return echo.ErrUnauthorized
+	}
+
+	scope, ok := routeScopes[c.Request().Method+" "+c.Path()]
+	if !ok || !token.HasScope(scope) {
+		return c.JSON(http.StatusForbidden, ErrorMessage{"API token scope does not allow this action", []string{}})
+	}
+
+	c.Set("user_id", user)
+	c.Set("api_token", token)
+	return next(c)
+}
+
+// Return API tokens of current user
+func GetAPITokens(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetAPITokens - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	tokens, err := model.FindAPITokensForUser(db, user.ID)
+	if err != nil {
+		log.Println("GetAPITokens - Error getting tokens\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting tokens", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"tokens": tokens})
+}
+
+// Create an API token for current user, its value is only returned in this response
+func CreateAPIToken(c echo.Context) error {
+	var request APITokenRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	user := c.Get("user_id").(*model.User)
+
+	for _, scope := range request.Scopes {
+		if scope == model.ScopeAdmin && !auth.IsAdmin(user) {
+			return c.JSON(http.StatusForbidden, ErrorMessage{"Administrator role required", []string{}})
+		}
+	}
+
+	if request.ExpiresInDays < 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Invalid token", []string{"expires_in_days can not be negative"}})
+	}
+
+	var expires_date *time.Time
+	if request.ExpiresInDays > 0 {
+		date := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expires_date = &date
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateAPIToken - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	token, value, err := model.CreateAPIToken(db, user.ID, request.Name, request.Scopes, expires_date)
+	if err != nil {
+		log.Println("CreateAPIToken - Error creating token\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating token", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"token": token, "value": value})
+}
+
+// Delete an API token of current user, so it can not be used again
+func DeleteAPIToken(c echo.Context) error {
+	token_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in token id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteAPIToken - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.DeleteAPIToken(db, token_id, user.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Token not found", []string{err.Error()}})
+		}
+
+		log.Println("DeleteAPIToken - Error deleting token\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error deleting token", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Token deleted successfully"})
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+type BasketProduct struct {
+	ProductID int64   `json:"product_id"`
+	Quantity  float64 `json:"quantity"`
+}
+
+type BasketRequest struct {
+	Products []BasketProduct `json:"products"`
+	Usual    bool            `json:"usual"`
+	Size     int64           `json:"size"`
+	Months   int             `json:"months"`
+}
+
+// Compare cost of a basket in every supermarket where its products were bought
+// Basket can be a list of products, or the usual basket from products bought more often in the last months
+func CompareBasket(c echo.Context) error {
+	request := BasketRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading basket", []string{err.Error()}})
+	}
+
+	if !request.Usual && len(request.Products) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Empty basket", []string{"Set a list of products or use usual basket"}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CompareBasket - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	basket := []model.BasketItem{}
+
+	if request.Usual {
+		if request.Size <= 0 {
+			request.Size = 20
+		}
+
+		if request.Months <= 0 {
+			request.Months = 3
+		}
+
+		basket, err = model.FindUsualBasketForUser(db, user, time.Now().AddDate(0, -request.Months, 0), request.Size)
+		if err != nil {
+			log.Println("CompareBasket - Error getting usual basket\n", err)
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting usual basket", []string{err.Error()}})
+		}
+	} else {
+		for _, product := range request.Products {
+			if product.Quantity <= 0 {
+				product.Quantity = 1
+			}
+			basket = append(basket, model.BasketItem{ProductID: product.ProductID, Quantity: product.Quantity})
+		}
+	}
+
+	stores, err := model.CompareBasketForUser(db, user, basket)
+	if err != nil {
+		log.Println("CompareBasket - Error comparing basket\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error comparing basket", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"basket": basket, "stores": stores})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/ingest"
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/quota"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/receipt_scanner"
+	"github.com/labstack/echo/v4"
+)
+
+// Create receipts from many files sent in files field, where zip archives are expanded
+// Every file is reported as created, duplicate or failed, so one wrong file does not stop the others
+func CreateReceiptsBatch(c echo.Context) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		log.Println("CreateReceiptsBatch - Error processing form\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading files", []string{err.Error()}})
+	}
+
+	headers := append(form.File["files"], form.File["file"]...)
+	if len(headers) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Missing files", []string{"files field is required"}})
+	}
+
+	// Receipts can be shared in a household
+	var household_id int64
+	if value := c.FormValue("household_id"); len(value) > 0 {
+		household_id, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in household_id param format", []string{err.Error()}})
+		}
+	}
+
+	files := []ingest.File{}
+	results := []ingest.Result{}
+
+	for _, header := range headers {
+		f, err := header.Open()
+		if err != nil {
+			results = append(results, ingest.Result{File: header.Filename, Status: ingest.StatusFailed, Error: err.Error()})
+			continue
+		}
+
+		data, err := io.ReadAll(f)
+		f.Close()
+
+		if err != nil {
+			results = append(results, ingest.Result{File: header.Filename, Status: ingest.StatusFailed, Error: err.Error()})
+			continue
+		}
+
+		if !ingest.IsZip(header.Filename) {
+			files = append(files, ingest.File{Name: header.Filename, Data: data})
+			continue
+		}
+
+		archived, err := ingest.ReadZip(data)
+		if errors.Is(err, ingest.ErrZipTooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, ErrorMessage{"Error reading zip archive " + header.Filename, []string{err.Error()}})
+		}
+
+		if err != nil {
+			results = append(results, ingest.Result{File: header.Filename, Status: ingest.StatusFailed, Error: err.Error()})
+			continue
+		}
+
+		for _, file := range archived {
+			file.Name = path.Join(header.Filename, file.Name)
+			files = append(files, file)
+		}
+	}
+
+	session, err := receipt_scanner.NewAwsSession()
+	if err != nil {
+		log.Println("CreateReceiptsBatch - Error creating new aws session\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to aws", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateReceiptsBatch - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	// Check household before scanning, so files are not analyzed for nothing
+	if household_id > 0 {
+		err := model.CheckHouseholdWriteAccess(db, household_id, user.ID)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Household not found", []string{err.Error()}})
+		}
+
+		if err == model.ErrHouseholdForbidden {
+			return c.JSON(http.StatusForbidden, ErrorMessage{"Error creating receipts", []string{err.Error()}})
+		}
+
+		if err != nil {
+			log.Println("CreateReceiptsBatch - Error checking household\n", err)
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error checking household", []string{err.Error()}})
+		}
+	}
+
+	scan := quota.NewScanner(db, session, user.ID, model.ScanSourceBatch)
+
+	created := func(receipt *model.Receipt) {
+		DetectPriceChanges(db, user, receipt)
+	}
+
+	results = append(results, ingest.ProcessFiles(db, user, household_id, files, scan, ingest.Concurrency(), created)...)
+
+	summary := map[string]int{ingest.StatusCreated: 0, ingest.StatusDuplicate: 0, ingest.StatusFailed: 0}
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"results": results, "summary": summary})
+}
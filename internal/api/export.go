@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/export"
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// Download every item of receipts for current user as csv, json or xlsx, filtered like receipts list
+func GetExport(c echo.Context) error {
+	format := c.QueryParam("format")
+	if len(format) == 0 {
+		format = export.FormatCSV
+	}
+
+	content_type, err := export.ContentType(format)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Invalid format", []string{err.Error()}})
+	}
+
+	filters, emsg := receiptFilterFromQuery(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	// Export includes every matching receipt
+	filters.Page = 0
+	filters.PerPage = 0
+
+	if filters.MinDate != nil && filters.MaxDate != nil && filters.MaxDate.Before(*filters.MinDate) {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Invalid dates", []string{"MaxDate can not no lower than MinDate"}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetExport - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, content_type)
+	response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", export.FileName(format)))
+	response.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so errors can only be logged
+	if err := export.Write(response, format, db, user, filters); err != nil {
+		log.Println("GetExport - Error writing export\n", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+type HouseholdRequest struct {
+	Name string `json:"name"`
+}
+
+type HouseholdMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// Return error response for household actions, with status depending on error
+func householdError(c echo.Context, message string, err error) error {
+	switch err {
+	case sql.ErrNoRows:
+		return c.JSON(http.StatusNotFound, ErrorMessage{"Household not found", []string{err.Error()}})
+	case model.ErrHouseholdForbidden:
+		return c.JSON(http.StatusForbidden, ErrorMessage{message, []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{message, []string{err.Error()}})
+}
+
+// Read household id and optional member id from path params
+func householdParams(c echo.Context) (int64, int64, *ErrorMessage) {
+	household_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, 0, &ErrorMessage{"Error in household id format", []string{err.Error()}}
+	}
+
+	var member_id int64
+	if value := c.Param("user_id"); len(value) > 0 {
+		member_id, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, 0, &ErrorMessage{"Error in user id format", []string{err.Error()}}
+		}
+	}
+
+	return household_id, member_id, nil
+}
+
+// Create a household with current user as owner
+func CreateHousehold(c echo.Context) error {
+	var request HouseholdRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateHousehold - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	household, err := model.CreateHousehold(db, request.Name, user.ID)
+	if err != nil {
+		log.Println("CreateHousehold - Error creating household\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating household", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"household": household})
+}
+
+// Return households current user belongs to
+func GetHouseholds(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetHouseholds - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	households, err := model.FindHouseholdsForUser(db, user.ID)
+	if err != nil {
+		log.Println("GetHouseholds - Error getting households\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting households", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"households": households})
+}
+
+// Return household with its members
+func GetHousehold(c echo.Context) error {
+	household_id, _, emsg := householdParams(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetHousehold - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	household, err := model.FindHouseholdForUser(db, household_id, user.ID)
+	if err != nil {
+		log.Println("GetHousehold - Error getting household\n", err)
+		return householdError(c, "Error getting household", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"household": household})
+}
+
+// Delete household, keeping its receipts as personal receipts
+func DeleteHousehold(c echo.Context) error {
+	household_id, _, emsg := householdParams(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteHousehold - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.DeleteHousehold(db, household_id, user.ID); err != nil {
+		log.Println("DeleteHousehold - Error deleting household\n", err)
+		return householdError(c, "Error deleting household", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Household deleted successfully"})
+}
+
+// Add a registered user to household by email
+func AddHouseholdMember(c echo.Context) error {
+	household_id, _, emsg := householdParams(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	var request HouseholdMemberRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	if len(request.Role) == 0 {
+		request.Role = model.RoleMember
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("AddHouseholdMember - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	member, err := model.AddHouseholdMember(db, household_id, user.ID, request.Email, request.Role)
+	if err != nil {
+		log.Println("AddHouseholdMember - Error adding member\n", err)
+		return householdError(c, "Error adding member", err)
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"member": member})
+}
+
+// Change role of a household member
+func UpdateHouseholdMember(c echo.Context) error {
+	household_id, member_id, emsg := householdParams(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	var request HouseholdMemberRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error processing request", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UpdateHouseholdMember - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.UpdateHouseholdMember(db, household_id, user.ID, member_id, request.Role); err != nil {
+		log.Println("UpdateHouseholdMember - Error updating member\n", err)
+		return householdError(c, "Error updating member", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Member updated successfully"})
+}
+
+// Remove a member from household, or leave it when removing current user
+func RemoveHouseholdMember(c echo.Context) error {
+	household_id, member_id, emsg := householdParams(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("RemoveHouseholdMember - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.RemoveHouseholdMember(db, household_id, user.ID, member_id); err != nil {
+		log.Println("RemoveHouseholdMember - Error removing member\n", err)
+		return householdError(c, "Error removing member", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Member removed successfully"})
+}
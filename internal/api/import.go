@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/importer"
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// Import receipts for current user from a CSV or JSON file with one row per item
+// Format is read from format param or file extension, and nothing is stored when dry_run is true
+func ImportReceipts(c echo.Context) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		log.Println("ImportReceipts - Error processing form file\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error opening file", []string{err.Error()}})
+	}
+
+	format := c.QueryParam("format")
+	if len(format) == 0 {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+	}
+
+	dry_run := false
+	if value := c.QueryParam("dry_run"); len(value) > 0 {
+		dry_run, err = strconv.ParseBool(value)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in dry_run param format", []string{err.Error()}})
+		}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		log.Println("ImportReceipts - Error opening file\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error opening file", []string{err.Error()}})
+	}
+	defer src.Close()
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("ImportReceipts - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	report, err := importer.Import(db, user, src, importer.Options{Format: format, DryRun: dry_run, Threshold: PriceChangeThreshold()})
+	if err != nil {
+		log.Println("ImportReceipts - Error importing receipts\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error importing receipts", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"report": report})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// Create a single use invite code for a new user
+func CreateInvite(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateInvite - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	invite, err := model.CreateInvite(db, user.ID)
+	if err != nil {
+		log.Println("CreateInvite - Error creating invite\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating invite", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"invite": invite})
+}
+
+// Return every invite, used or not
+func GetInvites(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetInvites - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	invites, err := model.FindAllInvites(db)
+	if err != nil {
+		log.Println("GetInvites - Error getting invites\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting invites", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"invites": invites})
+}
+
+// Delete an invite not used yet
+func DeleteInvite(c echo.Context) error {
+	invite_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in invite id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteInvite - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	if err := model.DeleteInvite(db, invite_id); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Invite not found", []string{err.Error()}})
+		}
+
+		log.Println("DeleteInvite - Error deleting invite\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error deleting invite", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Invite deleted successfully"})
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/export"
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type ProfileRequest struct {
+	Name     *string `json:"name"`
+	Locale   *string `json:"locale"`
+	Currency *string `json:"currency"`
+	Timezone *string `json:"timezone"`
+}
+
+// Return profile of current user
+func GetMe(c echo.Context) error {
+	user := c.Get("user_id").(*model.User)
+
+	return c.JSON(http.StatusOK, echo.Map{"user": user})
+}
+
+// Update profile preferences of current user, only fields sent are changed
+func UpdateMe(c echo.Context) error {
+	request := ProfileRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading profile", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UpdateMe - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := *c.Get("user_id").(*model.User)
+
+	if request.Name != nil {
+		user.Name = strings.TrimSpace(*request.Name)
+	}
+
+	if request.Locale != nil {
+		user.Locale = strings.TrimSpace(*request.Locale)
+	}
+
+	if request.Currency != nil {
+		user.Currency = strings.ToUpper(strings.TrimSpace(*request.Currency))
+	}
+
+	if request.Timezone != nil {
+		user.Timezone = strings.TrimSpace(*request.Timezone)
+	}
+
+	if err := model.UpdateUserProfile(db, &user); err != nil {
+		log.Println("UpdateMe - Error updating profile\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating profile", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Profile updated successfully", "user": user})
+}
+
+// Download a zip archive with every data belonging to current user
+func GetMeExport(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetMeExport - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "application/zip")
+	response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", export.AccountFileName()))
+	response.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so errors can only be logged
+	if err := export.WriteAccount(response, db, user); err != nil {
+		log.Println("GetMeExport - Error writing export\n", err)
+	}
+
+	return nil
+}
+
+// Delete current user with every data belonging to them, including original files of receipts
+func DeleteMe(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteMe - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.DeleteUserAccount(db, user.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"User not found", []string{err.Error()}})
+		}
+
+		log.Println("DeleteMe - Error deleting user\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error deleting user", []string{err.Error()}})
+	}
+
+	// User is already deleted, so files left behind are only logged
+	if err := storage.RemoveUser(user.ID); err != nil {
+		log.Printf("DeleteMe - Error removing files of user %d\n%v", user.ID, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "User deleted successfully"})
+}
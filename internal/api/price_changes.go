@@ -0,0 +1,130 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/notifier"
+	"github.com/labstack/echo/v4"
+)
+
+// Default minimum percentage for a price change to be recorded
+const defaultPriceChangeThreshold = 5.0
+
+// Return threshold configured by PRICE_CHANGE_THRESHOLD or default value
+func PriceChangeThreshold() float64 {
+	value := os.Getenv("PRICE_CHANGE_THRESHOLD")
+	if len(value) == 0 {
+		return defaultPriceChangeThreshold
+	}
+
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid PRICE_CHANGE_THRESHOLD value %s, using default\n", value)
+		return defaultPriceChangeThreshold
+	}
+
+	return threshold
+}
+
+// Detect price changes for a new receipt and notify price rises
+// Receipt is already stored, so errors are logged but not returned
+func DetectPriceChanges(db *sql.DB, user *model.User, receipt *model.Receipt) {
+	changes, err := model.DetectPriceChanges(db, receipt, PriceChangeThreshold())
+	if err != nil {
+		log.Printf("DetectPriceChanges - Error detecting price changes for receipt %d\n%v", receipt.ID, err)
+		return
+	}
+
+	n := notifier.NewFromEnv()
+	if n == nil {
+		return
+	}
+
+	if err := n.Notify(user, notifier.Increases(changes)); err != nil {
+		log.Printf("DetectPriceChanges - Error notifying price changes for receipt %d\n%v", receipt.ID, err)
+	}
+}
+
+// Detect again price changes for a corrected receipt, without notifying them
+// Changes are detected against history of the receipt owner, who can be other household member than current user
+func refreshPriceChanges(db *sql.DB, user *model.User, receipt_id int64) {
+	receipt, err := model.FindReceiptForUser(db, int(receipt_id), int(user.ID))
+	if err != nil {
+		log.Printf("refreshPriceChanges - Error getting receipt %d\n%v", receipt_id, err)
+		return
+	}
+
+	if _, err := model.RefreshPriceChanges(db, receipt, PriceChangeThreshold()); err != nil {
+		log.Printf("refreshPriceChanges - Error detecting price changes for receipt %d\n%v", receipt_id, err)
+	}
+}
+
+// Return list of price changes detected for current user
+func GetPriceChanges(c echo.Context) error {
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetPriceChanges - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	var filters model.PriceChangeFilter
+
+	filters.Product = c.QueryParam("product")
+	filters.Supermarket = c.QueryParam("supermarket")
+	filters.Direction = c.QueryParam("direction")
+
+	page := c.QueryParam("page")
+	per_page := c.QueryParam("per_page")
+	min_date := c.QueryParam("min_date")
+	max_date := c.QueryParam("max_date")
+
+	// Page filter
+	if len(page) > 0 && len(per_page) > 0 {
+		filters.Page, err = strconv.ParseInt(page, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in page param format", []string{err.Error()}})
+		}
+
+		filters.PerPage, err = strconv.ParseInt(per_page, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in per_page param format", []string{err.Error()}})
+		}
+	}
+
+	// Minimum date
+	if len(min_date) > 0 {
+		tmin_date, err := user.ParseDate(min_date)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in min_date param format", []string{err.Error()}})
+		}
+
+		filters.MinDate = &tmin_date
+
+		// Maximum date
+		if len(max_date) > 0 {
+			tmax_date, err := user.ParseDate(max_date)
+			if err != nil {
+				return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in max_date param format", []string{err.Error()}})
+			}
+
+			filters.MaxDate = &tmax_date
+		}
+	}
+
+	changes, err := model.FindAllPriceChangesForUser(db, user, &filters)
+	if err != nil {
+		log.Println("GetPriceChanges - Error getting price changes\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting price changes list", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"price_changes": changes})
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+type ProductUpdate struct {
+	Category    *string  `json:"category"`
+	PackageSize *float64 `json:"package_size"`
+	PackageUnit string   `json:"package_unit"`
+}
+
+// Return list of products bought by current user
+func GetProducts(c echo.Context) error {
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetProducts - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	products, err := model.FindAllProductsForUser(db, user, c.QueryParam("name"))
+	if err != nil {
+		log.Println("GetProducts - Error getting products\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting products list", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"products": products})
+}
+
+// Update product information, like category used to group statistics or package size when it is not in the name
+// Products are shared by all users, so only administrators can update them
+func UpdateProduct(c echo.Context) error {
+	product_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in product id format", []string{err.Error()}})
+	}
+
+	update := ProductUpdate{}
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading product", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UpdateProduct - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	if update.Category != nil {
+		// Categories created by administrators are the only ones allowed
+		if err := model.CheckCategory(db, *update.Category); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Invalid category", []string{err.Error()}})
+		}
+
+		err = model.UpdateProductCategory(db, product_id, *update.Category)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Product not found", []string{err.Error()}})
+		}
+
+		if err != nil {
+			log.Println("UpdateProduct - Error updating product\n", err)
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating product", []string{err.Error()}})
+		}
+	}
+
+	if update.PackageSize != nil {
+		err = model.UpdateProductPackageSize(db, product_id, *update.PackageSize, update.PackageUnit)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Product not found", []string{err.Error()}})
+		}
+
+		if err != nil {
+			log.Println("UpdateProduct - Error updating product\n", err)
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error updating product", []string{err.Error()}})
+		}
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Product updated successfully"})
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+type ReceiptRequest struct {
+	Supermarket *string  `json:"supermarket"`
+	Date        *string  `json:"date"`
+	Currency    *string  `json:"currency"`
+	Total       *float64 `json:"total"`
+	HouseholdID *int64   `json:"household_id"`
+}
+
+type ReceiptItemRequest struct {
+	Name      *string  `json:"name"`
+	Quantity  *float64 `json:"quantity"`
+	Price     *float64 `json:"price"`
+	UnitPrice *float64 `json:"unit_price"`
+}
+
+type ManualReceiptRequest struct {
+	Supermarket string               `json:"supermarket"`
+	Date        string               `json:"date"`
+	Currency    string               `json:"currency"`
+	Total       *float64             `json:"total"`
+	HouseholdID int64                `json:"household_id"`
+	Items       []ReceiptItemRequest `json:"items"`
+}
+
+// Return error response for errors from receipts edition, using 404 when receipt or item does not exist for user
+func receiptEditError(c echo.Context, message string, err error) error {
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, ErrorMessage{"Receipt not found", []string{err.Error()}})
+	}
+
+	if err == model.ErrHouseholdForbidden {
+		return c.JSON(http.StatusForbidden, ErrorMessage{message, []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{message, []string{err.Error()}})
+}
+
+// Read receipt id and item id from url params
+func receiptParams(c echo.Context, with_item bool) (int64, int64, error) {
+	receipt_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || !with_item {
+		return receipt_id, 0, err
+	}
+
+	item_id, err := strconv.ParseInt(c.Param("item_id"), 10, 64)
+	return receipt_id, item_id, err
+}
+
+// Create a receipt from values sent by user, for purchases without a receipt to scan
+// Total is calculated from items when it is not sent
+func CreateManualReceipt(c echo.Context) error {
+	request := ManualReceiptRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading receipt", []string{err.Error()}})
+	}
+
+	receipt := model.Receipt{Supermarket: strings.TrimSpace(request.Supermarket), Currency: strings.ToUpper(request.Currency), HouseholdID: request.HouseholdID, Source: model.SourceManual}
+
+	// Base currency of user is used when receipt currency is not set
+	if len(receipt.Currency) == 0 {
+		receipt.Currency = c.Get("user_id").(*model.User).Currency
+	}
+
+	if len(request.Date) > 0 {
+		date, err := c.Get("user_id").(*model.User).ParseDate(request.Date)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in date format", []string{err.Error()}})
+		}
+		receipt.Date = date
+	}
+
+	total := 0.0
+	for index, item := range request.Items {
+		if item.Name == nil || item.Price == nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Missing item fields", []string{fmt.Sprintf("name and price are required for item #%d", index)}})
+		}
+
+		receipt_item := model.ReceiptItem{Name: *item.Name, Price: *item.Price, Quantity: 1}
+
+		if item.Quantity != nil {
+			receipt_item.Quantity = *item.Quantity
+		}
+
+		if item.UnitPrice != nil {
+			receipt_item.UnitPrice = *item.UnitPrice
+		}
+
+		total += receipt_item.Price
+		receipt.Items = append(receipt.Items, receipt_item)
+	}
+
+	if request.Total != nil {
+		receipt.Total = *request.Total
+	} else {
+		receipt.Total = math.Round(total*100) / 100
+	}
+
+	if err := model.ValidateReceipt(&receipt); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Invalid receipt", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateManualReceipt - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+	receipt.UserID = user.ID
+
+	_, err = model.CreateReceipt(db, &receipt)
+	if err != nil {
+		log.Println("CreateManualReceipt - Error creating receipt\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating receipt", []string{err.Error()}})
+	}
+
+	DetectPriceChanges(db, user, &receipt)
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Receipt created successfully", "receipt": receipt})
+}
+
+// Update receipt fields for current user
+// PUT requires every field, while PATCH only changes fields sent
+func UpdateReceipt(c echo.Context) error {
+	receipt_id, _, err := receiptParams(c, false)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt id format", []string{err.Error()}})
+	}
+
+	request := ReceiptRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading receipt", []string{err.Error()}})
+	}
+
+	if c.Request().Method == http.MethodPut && (request.Supermarket == nil || request.Date == nil || request.Currency == nil || request.Total == nil) {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Missing receipt fields", []string{"supermarket, date, currency and total are required"}})
+	}
+
+	update := model.ReceiptUpdate{Supermarket: request.Supermarket, Currency: request.Currency, Total: request.Total, HouseholdID: request.HouseholdID}
+
+	if request.Date != nil {
+		date, err := c.Get("user_id").(*model.User).ParseDate(*request.Date)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in date format", []string{err.Error()}})
+		}
+		update.Date = &date
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UpdateReceipt - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	receipt, err := model.UpdateReceipt(db, receipt_id, user.ID, &update)
+	if err != nil {
+		log.Println("UpdateReceipt - Error updating receipt\n", err)
+		return receiptEditError(c, "Error updating receipt", err)
+	}
+
+	// Supermarket or date changes which purchases are compared
+	if update.Supermarket != nil || update.Date != nil {
+		refreshPriceChanges(db, user, receipt_id)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Receipt updated successfully", "receipt": receipt})
+}
+
+// Delete receipt owned by current user
+func DeleteReceipt(c echo.Context) error {
+	receipt_id, _, err := receiptParams(c, false)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteReceipt - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.DeleteReceipt(db, receipt_id, user.ID); err != nil {
+		log.Println("DeleteReceipt - Error deleting receipt\n", err)
+		return receiptEditError(c, "Error deleting receipt", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Receipt deleted successfully"})
+}
+
+// Add an item to receipt owned by current user
+func CreateReceiptItem(c echo.Context) error {
+	receipt_id, _, err := receiptParams(c, false)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt id format", []string{err.Error()}})
+	}
+
+	request := ReceiptItemRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading item", []string{err.Error()}})
+	}
+
+	if request.Name == nil || request.Price == nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Missing item fields", []string{"name and price are required"}})
+	}
+
+	item := model.ReceiptItem{Name: *request.Name, Price: *request.Price, Quantity: 1}
+
+	if request.Quantity != nil {
+		item.Quantity = *request.Quantity
+	}
+
+	if request.UnitPrice != nil {
+		item.UnitPrice = *request.UnitPrice
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("CreateReceiptItem - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	_, err = model.CreateReceiptItem(db, receipt_id, user.ID, &item)
+	if err != nil {
+		log.Println("CreateReceiptItem - Error creating item\n", err)
+		return receiptEditError(c, "Error creating item", err)
+	}
+
+	refreshPriceChanges(db, user, receipt_id)
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Item created successfully", "item": item})
+}
+
+// Update item from receipt owned by current user, only fields sent are changed
+func UpdateReceiptItem(c echo.Context) error {
+	receipt_id, item_id, err := receiptParams(c, true)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt or item id format", []string{err.Error()}})
+	}
+
+	request := ReceiptItemRequest{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error reading item", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("UpdateReceiptItem - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	update := model.ReceiptItemUpdate{Name: request.Name, Quantity: request.Quantity, Price: request.Price, UnitPrice: request.UnitPrice}
+
+	item, err := model.UpdateReceiptItem(db, receipt_id, item_id, user.ID, &update)
+	if err != nil {
+		log.Println("UpdateReceiptItem - Error updating item\n", err)
+		return receiptEditError(c, "Error updating item", err)
+	}
+
+	refreshPriceChanges(db, user, receipt_id)
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Item updated successfully", "item": item})
+}
+
+// Delete item from receipt owned by current user
+func DeleteReceiptItem(c echo.Context) error {
+	receipt_id, item_id, err := receiptParams(c, true)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt or item id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteReceiptItem - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.DeleteReceiptItem(db, receipt_id, item_id, user.ID); err != nil {
+		log.Println("DeleteReceiptItem - Error deleting item\n", err)
+		return receiptEditError(c, "Error deleting item", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Item deleted successfully"})
+}
+
+// Restore a deleted receipt owned by current user
+func RestoreReceipt(c echo.Context) error {
+	receipt_id, _, err := receiptParams(c, false)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("RestoreReceipt - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	receipt, err := model.RestoreReceipt(db, receipt_id, user.ID)
+	if err != nil {
+		log.Println("RestoreReceipt - Error restoring receipt\n", err)
+		return receiptEditError(c, "Error restoring receipt", err)
+	}
+
+	refreshPriceChanges(db, user, receipt_id)
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Receipt restored successfully", "receipt": receipt})
+}
+
+// Restore a deleted item from receipt owned by current user
+func RestoreReceiptItem(c echo.Context) error {
+	receipt_id, item_id, err := receiptParams(c, true)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt or item id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("RestoreReceiptItem - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	item, err := model.RestoreReceiptItem(db, receipt_id, item_id, user.ID)
+	if err != nil {
+		log.Println("RestoreReceiptItem - Error restoring item\n", err)
+		return receiptEditError(c, "Error restoring item", err)
+	}
+
+	refreshPriceChanges(db, user, receipt_id)
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Item restored successfully", "item": item})
+}
+
+// Return every change made to receipt owned by current user, including deleted ones
+func GetReceiptHistory(c echo.Context) error {
+	receipt_id, _, err := receiptParams(c, false)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in receipt id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetReceiptHistory - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	changes, err := model.FindReceiptHistoryForUser(db, receipt_id, user.ID)
+	if err != nil {
+		log.Println("GetReceiptHistory - Error getting receipt history\n", err)
+		return receiptEditError(c, "Error getting receipt history", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"history": changes})
+}
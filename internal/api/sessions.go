@@ -0,0 +1,244 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultAccessTokenTTL = 15 * time.Minute
+
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Return lifetime of access tokens in minutes configured by ACCESS_TOKEN_TTL or default value
+func AccessTokenTTL() time.Duration {
+	value := os.Getenv("ACCESS_TOKEN_TTL")
+	if len(value) == 0 {
+		return defaultAccessTokenTTL
+	}
+
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes <= 0 {
+		log.Printf("Invalid ACCESS_TOKEN_TTL value %s, using default\n", value)
+		return defaultAccessTokenTTL
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// Return lifetime of unused refresh tokens in days configured by REFRESH_TOKEN_TTL or default value
+func RefreshTokenTTL() time.Duration {
+	value := os.Getenv("REFRESH_TOKEN_TTL")
+	if len(value) == 0 {
+		return defaultRefreshTokenTTL
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days <= 0 {
+		log.Printf("Invalid REFRESH_TOKEN_TTL value %s, using default\n", value)
+		return defaultRefreshTokenTTL
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Return a JWT access token for user and session, which is set as token id
+func signToken(user *model.User, session_id int64) (string, time.Time, error) {
+	expires_at := time.Now().Add(AccessTokenTTL())
+
+	claims := jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expires_at),
+		Subject:   fmt.Sprint(user.ID),
+		ID:        fmt.Sprint(session_id),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	jwt_signature := os.Getenv("JWT_SIGNATURE")
+
+	ss, err := token.SignedString([]byte(jwt_signature))
+	return ss, expires_at, err
+}
+
+// Return session id of access token, or error if token has none
+func sessionID(token *jwt.Token) (int64, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errors.New("Unexpected claims type")
+	}
+
+	jti, _ := claims["jti"].(string)
+	return strconv.ParseInt(jti, 10, 64)
+}
+
+// Create a session for user after login, returning profile with access and refresh tokens
+// Disabled users can not log in
+func startSession(c echo.Context, db *sql.DB, user *model.User) (*UserProfile, error) {
+	if user.DisabledAt != nil {
+		return nil, model.ErrUserDisabled
+	}
+
+	session, refresh_token, err := model.CreateSession(db, user.ID, c.Request().UserAgent(), c.RealIP(), RefreshTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+
+	ss, expires_at, err := signToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserProfile{user.Name, user.PictureURL, ss, expires_at, refresh_token}, nil
+}
+
+// Exchange a refresh token for a new access token and a new refresh token
+// Refresh tokens can only be used once
+func RefreshToken(c echo.Context) error {
+	var request RefreshRequest
+	if err := c.Bind(&request); err != nil || len(request.RefreshToken) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"message": "Missing refresh_token value"})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("RefreshToken - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	session, refresh_token, err := model.RefreshSession(db, request.RefreshToken, c.RealIP(), RefreshTokenTTL())
+	if err == model.ErrInvalidRefreshToken {
+		return c.JSON(http.StatusUnauthorized, ErrorMessage{"Error refreshing token", []string{err.Error()}})
+	}
+
+	if err != nil {
+		log.Println("RefreshToken - Error refreshing session\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error refreshing token", []string{err.Error()}})
+	}
+
+	user, err := model.FindUserById(db, int(session.UserID))
+	if err != nil {
+		log.Println("RefreshToken - User not found\n", err)
+		return c.JSON(http.StatusUnauthorized, ErrorMessage{"User not found", []string{err.Error()}})
+	}
+
+	if user.DisabledAt != nil {
+		return c.JSON(http.StatusForbidden, ErrorMessage{"Error refreshing token", []string{model.ErrUserDisabled.Error()}})
+	}
+
+	ss, expires_at, err := signToken(user, session.ID)
+	if err != nil {
+		log.Println("RefreshToken - Error signing JWT token\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error creating token for user", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, &UserProfile{user.Name, user.PictureURL, ss, expires_at, refresh_token})
+}
+
+// Revoke session of current access token, so neither it nor its refresh token can be used again
+func Logout(c echo.Context) error {
+	session_id, ok := c.Get("session_id").(int64)
+	if !ok {
+		return c.JSON(http.StatusOK, echo.Map{"message": "Logged out successfully"})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("Logout - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.RevokeSession(db, session_id, user.ID); err != nil && err != sql.ErrNoRows {
+		log.Println("Logout - Error revoking session\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error revoking session", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Logged out successfully"})
+}
+
+// Return active sessions of current user, marking the one of current access token
+func GetSessions(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetSessions - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	sessions, err := model.FindSessionsForUser(db, user.ID)
+	if err != nil {
+		log.Println("GetSessions - Error getting sessions\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting sessions", []string{err.Error()}})
+	}
+
+	session_id, _ := c.Get("session_id").(int64)
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].ID == session_id
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"sessions": sessions})
+}
+
+// Revoke a session of current user, like the one of a lost device
+func DeleteSession(c echo.Context) error {
+	session_id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in session id format", []string{err.Error()}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteSession - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.RevokeSession(db, session_id, user.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, ErrorMessage{"Session not found", []string{err.Error()}})
+		}
+
+		log.Println("DeleteSession - Error revoking session\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error revoking session", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Session revoked successfully"})
+}
+
+// Revoke every session of current user, including the current one
+func DeleteSessions(c echo.Context) error {
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("DeleteSessions - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	if err := model.RevokeAllSessions(db, user.ID); err != nil {
+		log.Println("DeleteSessions - Error revoking sessions\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error revoking sessions", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Sessions revoked successfully"})
+}
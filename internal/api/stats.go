@@ -0,0 +1,185 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// Return personal inflation index for current user, using products bought in base month as basket
+func GetInflation(c echo.Context) error {
+	base := c.QueryParam("base")
+	if len(base) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Missing base param", []string{"base must be a month with format YYYY-MM"}})
+	}
+
+	tbase, err := time.Parse("2006-01", base)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in base param format", []string{err.Error()}})
+	}
+
+	granularity := c.QueryParam("granularity")
+	if len(granularity) == 0 {
+		granularity = "month"
+	}
+
+	if granularity != "month" && granularity != "quarter" && granularity != "year" {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in granularity param", []string{"granularity must be month, quarter or year"}})
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetInflation - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	index, err := model.FindInflationIndexForUser(db, user, tbase, granularity)
+	if err != nil {
+		log.Println("GetInflation - Error computing inflation index\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error computing inflation index", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"inflation": index})
+}
+
+// Return spending aggregates for current user grouped by day, week, month, year, supermarket or category
+// Receipts can be filtered using the same params as receipts list
+func GetSpending(c echo.Context) error {
+	group_by := c.QueryParam("group_by")
+	if len(group_by) == 0 {
+		group_by = "month"
+	}
+
+	filters, emsg := receiptFilterFromQuery(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetSpending - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	spending, err := model.FindSpendingForUser(db, user, filters, group_by)
+	if err != nil {
+		log.Println("GetSpending - Error getting spending\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting spending", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"group_by": group_by, "spending": spending})
+}
+
+// Return ranking of most bought products for current user, compared with previous period
+// Current month in timezone of user is used when dates are not set
+func GetTopItems(c echo.Context) error {
+	user := c.Get("user_id").(*model.User)
+
+	today := user.Day(time.Now())
+
+	filters := model.TopItemFilter{
+		MinDate:     time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC),
+		MaxDate:     today,
+		Supermarket: c.QueryParam("supermarket"),
+		Category:    c.QueryParam("category"),
+		OrderBy:     c.QueryParam("order_by"),
+		Limit:       10,
+	}
+
+	if len(filters.OrderBy) == 0 {
+		filters.OrderBy = "count"
+	}
+
+	var emsg *ErrorMessage
+	filters.HouseholdID, filters.MemberID, emsg = householdFilterFromQuery(c)
+	if emsg != nil {
+		return c.JSON(http.StatusUnprocessableEntity, emsg)
+	}
+
+	if min_date := c.QueryParam("min_date"); len(min_date) > 0 {
+		tmin_date, err := user.ParseDate(min_date)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in min_date param format", []string{err.Error()}})
+		}
+		filters.MinDate = tmin_date
+	}
+
+	if max_date := c.QueryParam("max_date"); len(max_date) > 0 {
+		tmax_date, err := user.ParseDate(max_date)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in max_date param format", []string{err.Error()}})
+		}
+		filters.MaxDate = tmax_date
+	}
+
+	if limit := c.QueryParam("limit"); len(limit) > 0 {
+		var err error
+		filters.Limit, err = strconv.ParseInt(limit, 10, 64)
+		if err != nil || filters.Limit <= 0 {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in limit param format", []string{"limit must be a positive number"}})
+		}
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetTopItems - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	items, err := model.FindTopItemsForUser(db, user, &filters)
+	if err != nil {
+		log.Println("GetTopItems - Error getting top items\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting top items", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"min_date": filters.MinDate, "max_date": filters.MaxDate, "top_items": items})
+}
+
+// Return products whose package got smaller while price stayed similar or rose
+func GetShrinkflation(c echo.Context) error {
+	user := c.Get("user_id").(*model.User)
+
+	filters := model.ShrinkflationFilter{Supermarket: c.QueryParam("supermarket"), Tolerance: 5}
+
+	if min_date := c.QueryParam("min_date"); len(min_date) > 0 {
+		tmin_date, err := user.ParseDate(min_date)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in min_date param format", []string{err.Error()}})
+		}
+		filters.MinDate = &tmin_date
+	}
+
+	if tolerance := c.QueryParam("tolerance"); len(tolerance) > 0 {
+		var err error
+		filters.Tolerance, err = strconv.ParseFloat(tolerance, 64)
+		if err != nil || filters.Tolerance < 0 {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in tolerance param format", []string{"tolerance must be a positive percentage"}})
+		}
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetShrinkflation - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	found, err := model.FindShrinkflationForUser(db, user, &filters)
+	if err != nil {
+		log.Println("GetShrinkflation - Error detecting shrinkflation\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error detecting shrinkflation", []string{err.Error()}})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"shrinkflation": found})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/auth"
+	model "github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/quota"
+	"github.com/labstack/echo/v4"
+)
+
+// Return scans, pages and estimated cost of current user in current month, or month given as YYYY-MM
+// Usage of the whole instance is only returned to administrators
+func GetUsage(c echo.Context) error {
+	date := time.Now()
+	if value := c.QueryParam("month"); len(value) > 0 {
+		month, err := time.Parse("2006-01", value)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error in month param format", []string{err.Error()}})
+		}
+		date = month
+	}
+
+	db, err := model.NewDB()
+	if err != nil {
+		log.Println("GetUsage - Error connecting to database\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error connecting to database", []string{err.Error()}})
+	}
+	defer db.Close()
+
+	user := c.Get("user_id").(*model.User)
+
+	usage, err := quota.FindUsage(db, quota.LimitsFromEnv(), user.ID, date)
+	if err != nil {
+		log.Println("GetUsage - Error getting usage\n", err)
+		return c.JSON(http.StatusUnprocessableEntity, ErrorMessage{"Error getting usage", []string{err.Error()}})
+	}
+
+	if !auth.IsAdmin(user) {
+		usage.Instance = nil
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"usage": usage})
+}
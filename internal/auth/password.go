@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Minimum length of local passwords
+const MinPasswordLength = 8
+
+var (
+	ErrInvalidCredentials = errors.New("Invalid username or password")
+	ErrWeakPassword       = errors.New("Password must have at least 8 characters")
+	ErrInvalidUsername    = errors.New("Username can not be empty or have spaces")
+)
+
+// Hash compared when user does not exist, so response time does not tell which usernames exist
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("shoppingbag_tracker"), bcrypt.DefaultCost)
+
+// Check if local login with username and password is enabled, set by PASSWORD_LOGIN
+func PasswordLoginEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("PASSWORD_LOGIN"))
+	return enabled
+}
+
+// Usernames are not case sensitive
+func normalizeUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if len(username) == 0 || strings.ContainsAny(username, " \t\r\n") {
+		return "", ErrInvalidUsername
+	}
+
+	return username, nil
+}
+
+// Return bcrypt hash of password
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Create a user for local login
+func CreatePasswordUser(db *sql.DB, username string, email string, password string) (*model.User, error) {
+	username, err := normalizeUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	return model.CreatePasswordUser(db, username, strings.TrimSpace(email), hash)
+}
+
+// Set a new password for user with given username, returning sql.ErrNoRows if user does not exist
+func ResetPassword(db *sql.DB, username string, password string) error {
+	username, err := normalizeUsername(username)
+	if err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return model.UpdateUserPassword(db, username, hash)
+}
+
+// Return user for given username and password, or ErrInvalidCredentials if they do not match
+func LoginPassword(db *sql.DB, username string, password string) (*model.User, error) {
+	username, err := normalizeUsername(username)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	user_id, hash, err := model.FindUserPasswordHash(db, username)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return model.FindUserById(db, int(user_id))
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordLoginEnabled(t *testing.T) {
+	t.Setenv("PASSWORD_LOGIN", "true")
+	assert.True(t, PasswordLoginEnabled())
+
+	t.Setenv("PASSWORD_LOGIN", "")
+	assert.False(t, PasswordLoginEnabled())
+}
+
+func TestHashPassword(t *testing.T) {
+	_, err := HashPassword("short")
+	assert.Equal(t, ErrWeakPassword, err)
+
+	hash, err := HashPassword("long enough")
+	if err != nil {
+		t.Fatalf("Unexpected error %s hashing password", err)
+	}
+
+	assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("long enough")))
+}
+
+func TestCreatePasswordUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)")).
+		WithArgs("jane", "jane@example.com", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+
+	user, err := CreatePasswordUser(db, " Jane ", "jane@example.com", "long enough")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating user", err)
+	}
+
+	assert.Equal(t, int64(4), user.ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreatePasswordUserInvalidUsername(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = CreatePasswordUser(db, "jane doe", "", "long enough")
+	assert.Equal(t, ErrInvalidUsername, err)
+}
+
+func TestLoginPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("long enough"), bcrypt.MinCost)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, password_hash FROM users WHERE username = ?")).
+		WithArgs("jane").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash"}).AddRow(4, string(hash)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at FROM users WHERE id = ?")).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at"}).
+			AddRow(4, nil, "jane@example.com", "Jane", nil, nil, nil, nil, nil, nil))
+
+	user, err := LoginPassword(db, "Jane", "long enough")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s logging in", err)
+	}
+
+	assert.Equal(t, int64(4), user.ID)
+	assert.Equal(t, "Jane", user.Name)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLoginPasswordInvalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("long enough"), bcrypt.MinCost)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, password_hash FROM users WHERE username = ?")).
+		WithArgs("jane").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash"}).AddRow(4, string(hash)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, password_hash FROM users WHERE username = ?")).
+		WithArgs("john").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = LoginPassword(db, "jane", "wrong password")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	_, err = LoginPassword(db, "john", "long enough")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestResetPasswordUnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET password_hash = ? WHERE username = ?")).
+		WithArgs(sqlmock.AnyArg(), "john").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, sql.ErrNoRows, ResetPassword(db, "john", "long enough"))
+}
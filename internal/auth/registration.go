@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+)
+
+// Registration modes for users logging in for the first time, set by REGISTRATION_MODE
+const (
+	// Only existing users can log in
+	ModeClosed = "closed"
+
+	// Anyone can register
+	ModeOpen = "open"
+
+	// Users with an email in ALLOWED_EMAILS, or with an invite code, can register
+	ModeAllowlist = "allowlist"
+
+	// Only users with an invite code can register
+	ModeInvite = "invite"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("Registration is closed")
+	ErrEmailNotAllowed    = errors.New("Email is not allowed to register")
+)
+
+// Return registration mode, closed by default
+func Mode() string {
+	switch mode := strings.ToLower(os.Getenv("REGISTRATION_MODE")); mode {
+	case ModeOpen, ModeAllowlist, ModeInvite:
+		return mode
+	default:
+		return ModeClosed
+	}
+}
+
+// Return emails and domains allowed to register, from ALLOWED_EMAILS separated by comma
+func AllowedEmails() []string {
+	allowed := []string{}
+
+	for _, value := range strings.Split(os.Getenv("ALLOWED_EMAILS"), ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if len(value) > 0 {
+			allowed = append(allowed, value)
+		}
+	}
+
+	return allowed
+}
+
+// Check if email is in allowed list, which can have full addresses or domains like @example.com or example.com
+func EmailAllowed(allowed []string, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) == 0 {
+		return false
+	}
+
+	for _, value := range allowed {
+		if email == value || strings.HasSuffix(email, "@"+strings.TrimPrefix(value, "@")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check if user is an administrator, by role or listed by id in ADMIN_USERS separated by comma
+func IsAdmin(user *model.User) bool {
+	if user.Role == model.UserRoleAdmin {
+		return true
+	}
+
+	for _, value := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		user_id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err == nil && user_id == user.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check if user has given role, administrators have every role
+func HasRole(user *model.User, role string) bool {
+	return user.Role == role || IsAdmin(user)
+}
+
+// Give administrator role to users listed in ADMIN_USERS, so they keep it if the variable is removed
+func PromoteAdmins(db *sql.DB) error {
+	for _, value := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		user_id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if err := model.SetUserRole(db, user_id, model.UserRoleAdmin); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Information about a user logging in for the first time
+type Registration struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	InviteCode    string
+}
+
+// Create user for first login if registration mode allows it, using invite code if given
+func Register(db *sql.DB, mode string, allowed []string, registration *Registration) (*model.User, error) {
+	has_invite := len(strings.TrimSpace(registration.InviteCode)) > 0
+
+	// Invite codes are only spent when they are needed to register
+	use_invite := false
+
+	switch mode {
+	case ModeOpen:
+	case ModeAllowlist:
+		if !registration.EmailVerified || !EmailAllowed(allowed, registration.Email) {
+			if !has_invite {
+				return nil, ErrEmailNotAllowed
+			}
+			use_invite = true
+		}
+	case ModeInvite:
+		if !has_invite {
+			return nil, model.ErrInvalidInvite
+		}
+		use_invite = true
+	default:
+		return nil, ErrRegistrationClosed
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Google id is kept for users of Google
+	google_uid := ""
+	if registration.Issuer == model.GoogleIssuer {
+		google_uid = registration.Subject
+	}
+
+	user, err := model.CreateUser(tx, google_uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.CreateUserIdentity(tx, user.ID, registration.Issuer, registration.Subject); err != nil {
+		return nil, err
+	}
+
+	if use_invite {
+		if err := model.UseInvite(tx, registration.InviteCode, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
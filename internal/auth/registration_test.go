@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMode(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", "Invite")
+	assert.Equal(t, ModeInvite, Mode())
+
+	t.Setenv("REGISTRATION_MODE", "unknown")
+	assert.Equal(t, ModeClosed, Mode())
+}
+
+func TestEmailAllowed(t *testing.T) {
+	allowed := []string{"me@example.com", "@family.example", "friends.example"}
+
+	assert.True(t, EmailAllowed(allowed, "Me@Example.com"))
+	assert.True(t, EmailAllowed(allowed, "kid@family.example"))
+	assert.True(t, EmailAllowed(allowed, "someone@friends.example"))
+	assert.False(t, EmailAllowed(allowed, "other@example.com"))
+	assert.False(t, EmailAllowed(allowed, "someone@notfriends.example"))
+	assert.False(t, EmailAllowed(allowed, ""))
+}
+
+func TestIsAdmin(t *testing.T) {
+	t.Setenv("ADMIN_USERS", "1, 3")
+
+	assert.True(t, IsAdmin(&model.User{ID: 3}))
+	assert.False(t, IsAdmin(&model.User{ID: 2}))
+}
+
+func TestHasRole(t *testing.T) {
+	t.Setenv("ADMIN_USERS", "")
+
+	assert.True(t, HasRole(&model.User{ID: 2, Role: model.UserRoleAdmin}, model.UserRoleAdmin))
+	assert.True(t, HasRole(&model.User{ID: 2, Role: model.UserRoleAdmin}, model.UserRoleUser))
+	assert.True(t, HasRole(&model.User{ID: 2, Role: model.UserRoleUser}, model.UserRoleUser))
+	assert.False(t, HasRole(&model.User{ID: 2, Role: model.UserRoleUser}, model.UserRoleAdmin))
+}
+
+func TestPromoteAdmins(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	t.Setenv("ADMIN_USERS", "1, wrong, 3")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET role = ? WHERE id = ?")).
+		WithArgs(model.UserRoleAdmin, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET role = ? WHERE id = ?")).
+		WithArgs(model.UserRoleAdmin, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, PromoteAdmins(db))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegisterClosed(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = Register(db, ModeClosed, []string{}, &Registration{Issuer: model.GoogleIssuer, Subject: "123", InviteCode: "ABCD"})
+	assert.Equal(t, ErrRegistrationClosed, err)
+}
+
+func TestRegisterAllowlist(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (google_uid) VALUES (?)")).
+		WithArgs("123").
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identities (user_id, issuer, subject) VALUES (?, ?, ?)")).
+		WithArgs(4, model.GoogleIssuer, "123").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// Invite is not used when email is allowed
+	user, err := Register(db, ModeAllowlist, []string{"example.com"}, &Registration{Issuer: model.GoogleIssuer, Subject: "123", Email: "me@example.com", EmailVerified: true, InviteCode: "ABCD"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s registering user", err)
+	}
+
+	assert.Equal(t, int64(4), user.ID)
+	assert.Equal(t, "123", user.GoogleUID)
+
+	_, err = Register(db, ModeAllowlist, []string{"example.com"}, &Registration{Issuer: model.GoogleIssuer, Subject: "456", Email: "me@example.com"})
+	assert.Equal(t, ErrEmailNotAllowed, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegisterInvite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (google_uid) VALUES (?)")).
+		WithArgs("123").
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identities (user_id, issuer, subject) VALUES (?, ?, ?)")).
+		WithArgs(4, model.GoogleIssuer, "123").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE invites SET used_by = ?, used_date = ? WHERE code = ? AND used_by IS NULL")).
+		WithArgs(4, sqlmock.AnyArg(), "ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	user, err := Register(db, ModeInvite, []string{}, &Registration{Issuer: model.GoogleIssuer, Subject: "123", InviteCode: "abcd"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s registering user", err)
+	}
+
+	assert.Equal(t, int64(4), user.ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegisterInviteUsed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (google_uid) VALUES (?)")).
+		WithArgs("123").
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identities (user_id, issuer, subject) VALUES (?, ?, ?)")).
+		WithArgs(4, model.GoogleIssuer, "123").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE invites SET used_by = ?, used_date = ? WHERE code = ? AND used_by IS NULL")).
+		WithArgs(4, sqlmock.AnyArg(), "ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err = Register(db, ModeInvite, []string{}, &Registration{Issuer: model.GoogleIssuer, Subject: "123", InviteCode: "ABCD"})
+	assert.Equal(t, model.ErrInvalidInvite, err)
+
+	_, err = Register(db, ModeInvite, []string{}, &Registration{Issuer: model.GoogleIssuer, Subject: "123"})
+	assert.Equal(t, model.ErrInvalidInvite, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegisterOIDC(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	// Google id is not set for users of other providers
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (google_uid) VALUES (?)")).
+		WithArgs(nil).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identities (user_id, issuer, subject) VALUES (?, ?, ?)")).
+		WithArgs(5, "https://auth.example.com", "abc").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	user, err := Register(db, ModeOpen, []string{}, &Registration{Issuer: "https://auth.example.com", Subject: "abc"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s registering user", err)
+	}
+
+	assert.Equal(t, int64(5), user.ID)
+	assert.Equal(t, "", user.GoogleUID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
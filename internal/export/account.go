@@ -0,0 +1,121 @@
+package export
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/storage"
+)
+
+// Return file name to download every data of a user
+func AccountFileName() string {
+	return fmt.Sprintf("account-%s.zip", time.Now().Format("2006-01-02"))
+}
+
+// Write a zip archive to w with every data belonging to user: profile, receipts created by user with their items
+// as csv and json, changes made to receipts, price changes, households, sessions, API tokens, scans and original files
+func WriteAccount(w io.Writer, db *sql.DB, user *model.User) error {
+	archive := zip.NewWriter(w)
+
+	// Receipts of households created by other members are not included
+	filters := &model.ReceiptFilter{MemberID: user.ID}
+
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		f, err := archive.Create("receipts." + format)
+		if err != nil {
+			return err
+		}
+
+		if err := Write(f, format, db, user, filters); err != nil {
+			return err
+		}
+	}
+
+	history, err := model.FindReceiptChangesByUser(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	price_changes, err := model.FindAllPriceChangesForUser(db, user, nil)
+	if err != nil {
+		return err
+	}
+
+	households, err := model.FindHouseholdsForUser(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := model.FindSessionsForUser(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := model.FindAPITokensForUser(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	scans, err := model.FindScansForUser(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	documents := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", user},
+		{"receipt_history.json", history},
+		{"price_changes.json", price_changes},
+		{"households.json", households},
+		{"sessions.json", sessions},
+		{"api_tokens.json", tokens},
+		{"scans.json", scans},
+	}
+
+	for _, document := range documents {
+		f, err := archive.Create(document.name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(document.value); err != nil {
+			return err
+		}
+	}
+
+	images, err := model.FindReceiptImagesForUser(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for receipt_id, image_path := range images {
+		data, err := storage.Read(image_path)
+		if err != nil {
+			// Files removed from storage by hand must not stop the export
+			log.Printf("WriteAccount - Error reading file of receipt %d\n%v", receipt_id, err)
+			continue
+		}
+
+		f, err := archive.Create(fmt.Sprintf("images/%d%s", receipt_id, filepath.Ext(image_path)))
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
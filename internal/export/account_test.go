@@ -0,0 +1,105 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAccount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	storage_dir := t.TempDir()
+	t.Setenv("STORAGE_DIR", storage_dir)
+
+	if err := os.MkdirAll(filepath.Join(storage_dir, "1"), 0o750); err != nil {
+		t.Fatalf("Unexpected error %s creating storage", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(storage_dir, "1", "abc.jpg"), []byte("picture"), 0o640); err != nil {
+		t.Fatalf("Unexpected error %s creating file", err)
+	}
+
+	ts := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	item_columns := []string{"receipt_id", "supermarket", "receipt_date", "currency", "total", "source", "item_id", "name", "product", "category", "quantity", "unit_price", "price"}
+
+	// Items are exported as csv and json
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_items INNER JOIN receipts ON receipts.id = receipt_items.receipt_id")).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows(item_columns).AddRow(1, "Any", ts, "EUR", 1.5, model.SourceScan, 1, "Pan", "PAN", nil, 1, 1.5, 1.5))
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_changes WHERE user_id = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "receipt_id", "receipt_item_id", "action", "field", "old_value", "new_value", "change_date"}).
+			AddRow(1, 1, nil, model.ActionCreate, "source", "", "scan", ts))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM price_changes")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM households")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sessions")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM api_tokens")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, image_path FROM receipts WHERE user_id = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "image_path"}).AddRow(1, "1/abc.jpg").AddRow(2, "1/missing.jpg"))
+
+	buffer := bytes.Buffer{}
+	if err := WriteAccount(&buffer, db, &model.User{ID: 1, Email: "user@example.com"}); err != nil {
+		t.Fatalf("Unexpected error %s writing account", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading archive", err)
+	}
+
+	files := map[string]string{}
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatalf("Unexpected error %s opening %s", err, file.Name)
+		}
+
+		content, _ := io.ReadAll(f)
+		f.Close()
+		files[file.Name] = string(content)
+	}
+
+	assert.Contains(t, files["receipts.csv"], "Pan")
+	assert.Contains(t, files["receipts.json"], "Pan")
+	assert.Contains(t, files["profile.json"], "user@example.com")
+	assert.Contains(t, files["receipt_history.json"], model.ActionCreate)
+	assert.Equal(t, "picture", files["images/1.jpg"])
+
+	// Missing files are skipped
+	_, found := files["images/2.jpg"]
+	assert.False(t, found)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,173 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/xuri/excelize/v2"
+)
+
+// Available export formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatXLSX = "xlsx"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:  "text/csv",
+	FormatJSON: "application/json",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Column names for tabular formats, in the same order as rowValues
+var header = []string{"receipt_id", "supermarket", "date", "currency", "total", "source", "item_id", "name", "product", "category", "quantity", "unit_price", "price"}
+
+// Return content type for given format, or error if format is not supported
+func ContentType(format string) (string, error) {
+	content_type, ok := contentTypes[format]
+	if !ok {
+		return "", fmt.Errorf("Invalid format %s", format)
+	}
+
+	return content_type, nil
+}
+
+// Return file name to download an export in given format
+func FileName(format string) string {
+	return fmt.Sprintf("receipts-%s.%s", time.Now().Format("2006-01-02"), format)
+}
+
+// Write every receipt item owned by user and matching filters to w in given format
+func Write(w io.Writer, format string, db *sql.DB, user *model.User, filters *model.ReceiptFilter) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, db, user, filters)
+	case FormatJSON:
+		return writeJSON(w, db, user, filters)
+	case FormatXLSX:
+		return writeXLSX(w, db, user, filters)
+	default:
+		return fmt.Errorf("Invalid format %s", format)
+	}
+}
+
+// Return row values for tabular formats
+func rowValues(row *model.ExportRow) []interface{} {
+	return []interface{}{row.ReceiptID, row.Supermarket, row.Date.Format("2006-01-02"), row.Currency, row.Total, row.Source,
+		row.ItemID, row.Name, row.Product, row.Category, row.Quantity, row.UnitPrice, row.Price}
+}
+
+func writeCSV(w io.Writer, db *sql.DB, user *model.User, filters *model.ReceiptFilter) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	err := model.ExportReceiptItemsForUser(db, user, filters, func(row *model.ExportRow) error {
+		record := []string{}
+		for _, value := range rowValues(row) {
+			switch v := value.(type) {
+			case float64:
+				record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+			default:
+				record = append(record, fmt.Sprint(v))
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+
+		// Flush every row, so it is sent to client while next rows are read
+		writer.Flush()
+		return writer.Error()
+	})
+
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Write rows as a JSON array, encoding one row at a time
+func writeJSON(w io.Writer, db *sql.DB, user *model.User, filters *model.ReceiptFilter) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	encoder := json.NewEncoder(w)
+
+	err := model.ExportReceiptItemsForUser(db, user, filters, func(row *model.ExportRow) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		return encoder.Encode(row)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// Write rows to a spreadsheet using a stream writer, which keeps rows in a temporary file instead of memory
+func writeXLSX(w io.Writer, db *sql.DB, user *model.User, filters *model.ReceiptFilter) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	cells := []interface{}{}
+	for _, name := range header {
+		cells = append(cells, name)
+	}
+
+	if err := stream.SetRow("A1", cells); err != nil {
+		return err
+	}
+
+	row_number := 1
+
+	err = model.ExportReceiptItemsForUser(db, user, filters, func(row *model.ExportRow) error {
+		row_number++
+
+		cell, err := excelize.CoordinatesToCellName(1, row_number)
+		if err != nil {
+			return err
+		}
+
+		return stream.SetRow(cell, rowValues(row))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := stream.Flush(); err != nil {
+		return err
+	}
+
+	return file.Write(w)
+}
@@ -0,0 +1,133 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+// Expect export query returning two items from the same receipt
+func expectExportRows(mock sqlmock.Sqlmock) {
+	ts := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_items INNER JOIN receipts ON receipts.id = receipt_items.receipt_id")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"receipt_id", "supermarket", "receipt_date", "currency", "total", "source", "item_id", "name", "product", "category", "quantity", "unit_price", "price"}).
+			AddRow(1, "Any", ts, "EUR", 3.5, model.SourceScan, 1, "Leche", "LECHE", "dairy", 2, 1.0, 2.0).
+			AddRow(1, "Any", ts, "EUR", 3.5, model.SourceScan, 2, "Pan", "PAN", nil, 1, 1.5, 1.5))
+}
+
+func TestWriteCSV(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	expectExportRows(mock)
+
+	buffer := bytes.Buffer{}
+	if err := Write(&buffer, FormatCSV, db, &model.User{ID: 1}, nil); err != nil {
+		t.Fatalf("Unexpected error %s writing csv", err)
+	}
+
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading csv", err)
+	}
+
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, header, records[0])
+	assert.Equal(t, []string{"1", "Any", "2024-01-15", "EUR", "3.5", "scan", "1", "Leche", "LECHE", "dairy", "2", "1", "2"}, records[1])
+	assert.Equal(t, "", records[2][9])
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	expectExportRows(mock)
+
+	buffer := bytes.Buffer{}
+	if err := Write(&buffer, FormatJSON, db, &model.User{ID: 1}, nil); err != nil {
+		t.Fatalf("Unexpected error %s writing json", err)
+	}
+
+	rows := []model.ExportRow{}
+	if err := json.Unmarshal(buffer.Bytes(), &rows); err != nil {
+		t.Fatalf("Unexpected error %s reading json", err)
+	}
+
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, "PAN", rows[1].Product)
+	assert.Equal(t, 1.5, rows[1].Price)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	expectExportRows(mock)
+
+	buffer := bytes.Buffer{}
+	if err := Write(&buffer, FormatXLSX, db, &model.User{ID: 1}, nil); err != nil {
+		t.Fatalf("Unexpected error %s writing xlsx", err)
+	}
+
+	file, err := excelize.OpenReader(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading xlsx", err)
+	}
+
+	defer file.Close()
+
+	rows, err := file.GetRows(file.GetSheetName(0))
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading rows", err)
+	}
+
+	assert.Equal(t, 3, len(rows))
+	assert.Equal(t, "Leche", rows[1][7])
+	assert.Equal(t, "Pan", rows[2][7])
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWriteInvalidFormat(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	err = Write(&bytes.Buffer{}, "pdf", db, &model.User{ID: 1}, nil)
+	assert.NotNil(t, err, "Expected error for invalid format")
+}
@@ -0,0 +1,427 @@
+package importer
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+)
+
+// Available import formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Columns read from files, one row per item
+// Rows with the same receipt value belong to the same receipt, or rows with the same supermarket and date if it is empty
+const (
+	ColumnReceipt     = "receipt"
+	ColumnSupermarket = "supermarket"
+	ColumnDate        = "date"
+	ColumnCurrency    = "currency"
+	ColumnTotal       = "total"
+	ColumnName        = "name"
+	ColumnQuantity    = "quantity"
+	ColumnUnitPrice   = "unit_price"
+	ColumnPrice       = "price"
+)
+
+// Columns every row must include
+var requiredColumns = []string{ColumnSupermarket, ColumnDate, ColumnName, ColumnPrice}
+
+// Other names accepted for columns, so exported files can be imported again
+var columnAliases = map[string]string{
+	"receipt_id": ColumnReceipt,
+}
+
+type Options struct {
+	Format string
+	DryRun bool
+	// Minimum percentage for price changes to be detected, none are detected if 0
+	Threshold float64
+}
+
+type RowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type Report struct {
+	DryRun     bool       `json:"dry_run"`
+	Rows       int        `json:"rows"`
+	Receipts   int        `json:"receipts"`
+	Items      int        `json:"items"`
+	Duplicates int        `json:"duplicates"`
+	Errors     []RowError `json:"errors"`
+}
+
+// Item read from a file row
+type row struct {
+	Line        int
+	Receipt     string
+	Supermarket string
+	Date        time.Time
+	Currency    string
+	Total       *float64
+	Item        model.ReceiptItem
+}
+
+// Receipt built from rows, keeping lines to report errors
+type receiptRows struct {
+	Receipt  model.Receipt
+	Lines    []int
+	HasTotal bool
+}
+
+// Read rows from r in given format, validate them and create a receipt for each group of rows
+// Rows with errors are reported and skipped, and nothing is stored in dry run mode
+func Import(db *sql.DB, user *model.User, r io.Reader, options Options) (*Report, error) {
+	var values []map[string]string
+	var lines []int
+	var err error
+
+	switch options.Format {
+	case FormatCSV:
+		values, lines, err = readCSV(r)
+	case FormatJSON:
+		values, lines, err = readJSON(r)
+	default:
+		return nil, fmt.Errorf("Invalid format %s", options.Format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := Report{DryRun: options.DryRun, Rows: len(values), Errors: []RowError{}}
+
+	rows := []row{}
+	for index, value := range values {
+		parsed, err := parseRow(value, user)
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{lines[index], err.Error()})
+			continue
+		}
+
+		parsed.Line = lines[index]
+		rows = append(rows, *parsed)
+	}
+
+	receipts := groupRows(rows, user, &report)
+
+	// Older receipts first, so price changes are detected in the order they happened
+	sort.SliceStable(receipts, func(i, j int) bool {
+		return receipts[i].Receipt.Date.Before(receipts[j].Receipt.Date)
+	})
+
+	// Receipts found in dry run mode, to detect duplicates inside the file
+	seen := map[string]bool{}
+
+	for _, group := range receipts {
+		receipt := group.Receipt
+
+		if err := model.ValidateReceipt(&receipt); err != nil {
+			report.Errors = append(report.Errors, RowError{group.Lines[0], receiptError(group.Lines, err)})
+			continue
+		}
+
+		if options.DryRun {
+			// Same check as when receipt is created, so both modes report the same duplicates
+			err := model.CheckReceiptExists(db, &receipt)
+			if err != nil && err != model.ErrReceiptExists {
+				return nil, err
+			}
+
+			key := fmt.Sprintf("%s|%s|%v", strings.ToUpper(receipt.Supermarket), receipt.Date.Format("2006-01-02"), receipt.Total)
+
+			if seen[key] || err == model.ErrReceiptExists {
+				report.Duplicates++
+				report.Errors = append(report.Errors, RowError{group.Lines[0], receiptError(group.Lines, model.ErrReceiptExists)})
+				continue
+			}
+
+			seen[key] = true
+		} else {
+			if _, err := model.CreateReceipt(db, &receipt); err != nil {
+				if err == model.ErrReceiptExists {
+					report.Duplicates++
+				}
+
+				report.Errors = append(report.Errors, RowError{group.Lines[0], receiptError(group.Lines, err)})
+				continue
+			}
+
+			if options.Threshold > 0 {
+				if _, err := model.DetectPriceChanges(db, &receipt, options.Threshold); err != nil {
+					log.Printf("Import - Error detecting price changes for receipt %d\n%v", receipt.ID, err)
+				}
+			}
+		}
+
+		report.Receipts++
+		report.Items += len(receipt.Items)
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+
+	return &report, nil
+}
+
+// Return error message for a receipt built from given lines
+func receiptError(lines []int, err error) string {
+	numbers := []string{}
+	for _, line := range lines {
+		numbers = append(numbers, strconv.Itoa(line))
+	}
+
+	return fmt.Sprintf("Receipt in lines %s: %v", strings.Join(numbers, ", "), err)
+}
+
+// Return column name used internally for given header
+func columnName(header string) string {
+	name := strings.ToLower(strings.TrimSpace(header))
+	if alias, ok := columnAliases[name]; ok {
+		return alias
+	}
+
+	return name
+}
+
+// Read CSV rows using first line as header, returning line number of every row
+func readCSV(r io.Reader) ([]map[string]string, []int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading header: %v", err)
+	}
+
+	columns := []string{}
+	for _, name := range header {
+		columns = append(columns, columnName(strings.TrimPrefix(name, "\ufeff")))
+	}
+
+	if err := checkColumns(columns); err != nil {
+		return nil, nil, err
+	}
+
+	values := []map[string]string{}
+	lines := []int{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		value := map[string]string{}
+
+		for index, column := range columns {
+			if index < len(record) {
+				value[column] = strings.TrimSpace(record[index])
+			}
+		}
+
+		values = append(values, value)
+		lines = append(lines, line)
+	}
+
+	return values, lines, nil
+}
+
+// Read a JSON array of rows, returning the position of every row as its line
+func readJSON(r io.Reader) ([]map[string]string, []int, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	objects := []map[string]interface{}{}
+	if err := decoder.Decode(&objects); err != nil {
+		return nil, nil, fmt.Errorf("Error reading JSON: %v", err)
+	}
+
+	values := []map[string]string{}
+	lines := []int{}
+
+	for index, object := range objects {
+		value := map[string]string{}
+		for key, field := range object {
+			if field == nil {
+				continue
+			}
+			value[columnName(key)] = strings.TrimSpace(fmt.Sprint(field))
+		}
+
+		values = append(values, value)
+		lines = append(lines, index+1)
+	}
+
+	return values, lines, nil
+}
+
+// Check header includes required columns
+func checkColumns(columns []string) error {
+	missing := []string{}
+
+	for _, required := range requiredColumns {
+		found := false
+		for _, column := range columns {
+			if column == required {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, required)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing columns %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Parse a decimal number, accepting comma as decimal separator
+func parseNumber(value string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+}
+
+// Parse a date in ISO8601 or day/month/year format, using timezone of user for dates with time
+func parseDate(value string, user *model.User) (time.Time, error) {
+	if date, err := user.ParseDate(value); err == nil {
+		return date, nil
+	}
+
+	return time.Parse("02/01/2006", value)
+}
+
+// Convert row values into an item with its receipt fields
+func parseRow(value map[string]string, user *model.User) (*row, error) {
+	for _, column := range requiredColumns {
+		if len(value[column]) == 0 {
+			return nil, fmt.Errorf("Empty value for %s", column)
+		}
+	}
+
+	parsed := row{
+		Receipt:     value[ColumnReceipt],
+		Supermarket: value[ColumnSupermarket],
+		Currency:    strings.ToUpper(value[ColumnCurrency]),
+		Item:        model.ReceiptItem{Name: value[ColumnName], Quantity: 1},
+	}
+
+	var err error
+
+	parsed.Date, err = parseDate(value[ColumnDate], user)
+	if err != nil {
+		return nil, fmt.Errorf("Error in date format: %v", err)
+	}
+
+	parsed.Item.Price, err = parseNumber(value[ColumnPrice])
+	if err != nil {
+		return nil, fmt.Errorf("Error in price format: %v", err)
+	}
+
+	if len(value[ColumnQuantity]) > 0 {
+		parsed.Item.Quantity, err = parseNumber(value[ColumnQuantity])
+		if err != nil {
+			return nil, fmt.Errorf("Error in quantity format: %v", err)
+		}
+	}
+
+	if len(value[ColumnUnitPrice]) > 0 {
+		parsed.Item.UnitPrice, err = parseNumber(value[ColumnUnitPrice])
+		if err != nil {
+			return nil, fmt.Errorf("Error in unit_price format: %v", err)
+		}
+	}
+
+	if len(value[ColumnTotal]) > 0 {
+		total, err := parseNumber(value[ColumnTotal])
+		if err != nil {
+			return nil, fmt.Errorf("Error in total format: %v", err)
+		}
+		parsed.Total = &total
+	}
+
+	return &parsed, nil
+}
+
+// Group rows into receipts, keeping the order receipts are found in the file
+// Rows which do not match the receipt they belong to are reported
+func groupRows(rows []row, user *model.User, report *Report) []receiptRows {
+	groups := []receiptRows{}
+	index := map[string]int{}
+
+	for _, item := range rows {
+		key := fmt.Sprintf("receipt|%s", item.Receipt)
+		if len(item.Receipt) == 0 {
+			key = fmt.Sprintf("%s|%s", strings.ToUpper(item.Supermarket), item.Date.Format("2006-01-02"))
+		}
+
+		position, ok := index[key]
+		if !ok {
+			groups = append(groups, receiptRows{Receipt: model.Receipt{
+				UserID:      user.ID,
+				Supermarket: item.Supermarket,
+				Date:        item.Date,
+				Currency:    item.Currency,
+				Source:      model.SourceImport,
+			}})
+			position = len(groups) - 1
+			index[key] = position
+		}
+
+		group := &groups[position]
+
+		if !strings.EqualFold(group.Receipt.Supermarket, item.Supermarket) || !group.Receipt.Date.Equal(item.Date) {
+			report.Errors = append(report.Errors, RowError{item.Line, "Supermarket and date do not match the receipt of previous rows"})
+			continue
+		}
+
+		if item.Total != nil {
+			group.Receipt.Total = *item.Total
+			group.HasTotal = true
+		}
+
+		group.Receipt.Items = append(group.Receipt.Items, item.Item)
+		group.Lines = append(group.Lines, item.Line)
+	}
+
+	// Total is the sum of items when file does not include it
+	for position := range groups {
+		group := &groups[position]
+		if group.HasTotal {
+			continue
+		}
+
+		total := 0.0
+		for _, item := range group.Receipt.Items {
+			total += item.Price
+		}
+		group.Receipt.Total = math.Round(total*100) / 100
+	}
+
+	return groups
+}
@@ -0,0 +1,184 @@
+package importer
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const duplicateQuery = "SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts"
+
+const chainQuery = "SELECT name FROM store_chains"
+
+func TestImportCSVDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	data := `supermarket,date,currency,name,quantity,unit_price,price
+Any,2023-02-01,EUR,Leche,2,"1,05","2,10"
+Any,2023-02-01,EUR,Pan,,,"0,90"
+Other,01/01/2023,EUR,Huevos,1,,wrong
+Other,2023-01-15,EUR,Huevos,1,,2.5
+`
+
+	// Receipts are checked oldest first, using store chain names as when they are created
+	mock.ExpectQuery(regexp.QuoteMeta(chainQuery)).
+		WithArgs("other").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta(duplicateQuery)).
+		WithArgs("%Other%", sqlmock.AnyArg(), 2.5, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}).AddRow(3, 1, "Other", time.Now(), "EUR", 2.5))
+
+	mock.ExpectQuery(regexp.QuoteMeta(chainQuery)).
+		WithArgs("any").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Any Chain"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(duplicateQuery)).
+		WithArgs("%Any Chain%", sqlmock.AnyArg(), 3.0, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}))
+
+	report, err := Import(db, &model.User{ID: 1}, strings.NewReader(data), Options{Format: FormatCSV, DryRun: true})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s importing csv", err)
+	}
+
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 4, report.Rows)
+	assert.Equal(t, 1, report.Receipts)
+	assert.Equal(t, 2, report.Items)
+	assert.Equal(t, 1, report.Duplicates)
+	assert.Equal(t, 2, len(report.Errors))
+	assert.Equal(t, 4, report.Errors[0].Line)
+	assert.Contains(t, report.Errors[0].Message, "price")
+	assert.Equal(t, 5, report.Errors[1].Line)
+	assert.Contains(t, report.Errors[1].Message, "Receipt already exists")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportJSONDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	// Rows from the same receipt id are grouped even without total, and invalid receipts are reported
+	data := `[
+		{"receipt_id": 7, "supermarket": "Any", "date": "2023-03-01T00:00:00Z", "total": 4, "name": "Leche", "price": 1.5},
+		{"receipt_id": 7, "supermarket": "Any", "date": "2023-03-01T00:00:00Z", "total": 4, "name": "Pan", "price": 2.5},
+		{"receipt_id": 8, "supermarket": "Any", "date": "2023-03-02", "name": "Pan", "quantity": 0, "price": 1}
+	]`
+
+	mock.ExpectQuery(regexp.QuoteMeta(chainQuery)).
+		WithArgs("any").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta(duplicateQuery)).
+		WithArgs("%Any%", sqlmock.AnyArg(), 4.0, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}))
+
+	report, err := Import(db, &model.User{ID: 1}, strings.NewReader(data), Options{Format: FormatJSON, DryRun: true})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s importing json", err)
+	}
+
+	assert.Equal(t, 1, report.Receipts)
+	assert.Equal(t, 2, report.Items)
+	assert.Equal(t, 1, len(report.Errors))
+	assert.Equal(t, 3, report.Errors[0].Line)
+	assert.Contains(t, report.Errors[0].Message, "quantity")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	data := "supermarket,date,name,price\nAny,2023-02-01,Pan,0.9\n"
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta(duplicateQuery)).
+		WithArgs("%Any%", sqlmock.AnyArg(), 0.9, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}))
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipts")).
+		WithArgs(1, nil, "Any", sqlmock.AnyArg(), "", 0.9, model.SourceImport).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("PAN").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items")).
+		WithArgs(1, 1.0, "Pan", 0.0, 0.9, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Imported values of receipt and its item are kept in its history
+	for i := 0; i < 8; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+			WillReturnResult(sqlmock.NewResult(int64(i+2), 1))
+	}
+
+	mock.ExpectCommit()
+
+	report, err := Import(db, &model.User{ID: 1}, strings.NewReader(data), Options{Format: FormatCSV})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s importing csv", err)
+	}
+
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 1, report.Receipts)
+	assert.Equal(t, 0, len(report.Errors))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportMissingColumns(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = Import(db, &model.User{ID: 1}, strings.NewReader("supermarket,name\nAny,Pan\n"), Options{Format: FormatCSV})
+	assert.NotNil(t, err, "Expected error for missing columns")
+	assert.Contains(t, err.Error(), "date, price")
+
+	_, err = Import(db, &model.User{ID: 1}, strings.NewReader(""), Options{Format: "xml"})
+	assert.NotNil(t, err, "Expected error for invalid format")
+}
@@ -0,0 +1,252 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/storage"
+)
+
+// Status of each file processed
+const (
+	StatusCreated   = "created"
+	StatusDuplicate = "duplicate"
+	StatusFailed    = "failed"
+)
+
+// Default number of files scanned at the same time
+const defaultConcurrency = 4
+
+// Limits of zip archives, so a small archive can not expand to use all memory
+var (
+	maxZipFiles     = 200
+	maxZipFileSize  = uint64(20 << 20)
+	maxZipTotalSize = uint64(200 << 20)
+)
+
+var ErrZipTooLarge = errors.New("Zip archive exceeds allowed size")
+
+// Extensions of files which can be scanned
+var scannableExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".pdf":  true,
+}
+
+// Read a receipt from file content
+type Scanner func(data []byte) (*model.Receipt, error)
+
+type File struct {
+	Name string
+	Data []byte
+}
+
+type Result struct {
+	File      string `json:"file"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	ReceiptID int64  `json:"receipt_id,omitempty"`
+}
+
+// Return number of files scanned at the same time, configured by SCAN_CONCURRENCY
+func Concurrency() int {
+	value := os.Getenv("SCAN_CONCURRENCY")
+	if len(value) == 0 {
+		return defaultConcurrency
+	}
+
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency < 1 {
+		return defaultConcurrency
+	}
+
+	return concurrency
+}
+
+// Check if file can be scanned by its extension
+func IsScannable(name string) bool {
+	return scannableExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// Check if file is a zip archive by its extension
+func IsZip(name string) bool {
+	return strings.ToLower(path.Ext(name)) == ".zip"
+}
+
+// Return every scannable file inside a zip archive, skipping folders and hidden files
+// Returns ErrZipTooLarge if archive has too many files, or any file or all of them are too large once expanded
+func ReadZip(data []byte) ([]File, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []File{}
+	total := uint64(0)
+
+	for _, entry := range reader.File {
+		name := entry.Name
+		base := path.Base(name)
+
+		if entry.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(name, "__MACOSX/") || !IsScannable(name) {
+			continue
+		}
+
+		if len(files) >= maxZipFiles {
+			return nil, fmt.Errorf("%w: more than %d files", ErrZipTooLarge, maxZipFiles)
+		}
+
+		if entry.UncompressedSize64 > maxZipFileSize {
+			return nil, fmt.Errorf("%w: file %s is larger than %d bytes", ErrZipTooLarge, name, maxZipFileSize)
+		}
+
+		f, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		// Size in header can be wrong, so content read is limited too
+		content, err := io.ReadAll(io.LimitReader(f, int64(maxZipFileSize)+1))
+		f.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if uint64(len(content)) > maxZipFileSize {
+			return nil, fmt.Errorf("%w: file %s is larger than %d bytes", ErrZipTooLarge, name, maxZipFileSize)
+		}
+
+		total += uint64(len(content))
+		if total > maxZipTotalSize {
+			return nil, fmt.Errorf("%w: files are larger than %d bytes", ErrZipTooLarge, maxZipTotalSize)
+		}
+
+		files = append(files, File{Name: name, Data: content})
+	}
+
+	return files, nil
+}
+
+// Scan and store a receipt for every file, returning a result for each one in the same order
+// Files are scanned concurrently up to given limit, and receipts are stored one at a time to avoid locking database
+// Receipts are stored in given household, or as personal receipts if household_id is 0
+// Function created is called for every receipt stored
+func ProcessFiles(db *sql.DB, user *model.User, household_id int64, files []File, scan Scanner, concurrency int, created func(receipt *model.Receipt)) []Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]Result, len(files))
+	slots := make(chan struct{}, concurrency)
+
+	var store sync.Mutex
+	var wg sync.WaitGroup
+
+	for index, file := range files {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(index int, file File) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			receipt, err := scanFile(scan, file)
+			if err != nil {
+				results[index] = Result{File: file.Name, Status: StatusFailed, Error: err.Error()}
+				return
+			}
+
+			receipt.UserID = user.ID
+			receipt.HouseholdID = household_id
+
+			store.Lock()
+			defer store.Unlock()
+
+			results[index] = StoreReceipt(db, file, receipt, created)
+		}(index, file)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// Scan a single file and check receipt read is valid
+func scanFile(scan Scanner, file File) (receipt *model.Receipt, err error) {
+	// Scanner can fail with unexpected documents, which must not stop other files
+	defer func() {
+		if r := recover(); r != nil {
+			receipt, err = nil, fmt.Errorf("Error analyzing file: %v", r)
+		}
+	}()
+
+	if !IsScannable(file.Name) {
+		return nil, fmt.Errorf("Unsupported file type %s", path.Ext(file.Name))
+	}
+
+	receipt, err = scan(file.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if receipt == nil {
+		return nil, errors.New("Could not read receipt")
+	}
+
+	if err := model.ValidateReceipt(receipt); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// Store receipt read from file, reporting duplicated receipts
+// Function created is called if receipt is stored
+func StoreReceipt(db *sql.DB, file File, receipt *model.Receipt, created func(receipt *model.Receipt)) Result {
+	if _, err := model.CreateReceipt(db, receipt); err != nil {
+		if err == model.ErrReceiptExists {
+			return Result{File: file.Name, Status: StatusDuplicate, Error: err.Error()}
+		}
+
+		return Result{File: file.Name, Status: StatusFailed, Error: err.Error()}
+	}
+
+	KeepOriginal(db, receipt, file)
+
+	if created != nil {
+		created(receipt)
+	}
+
+	return Result{File: file.Name, Status: StatusCreated, ReceiptID: receipt.ID}
+}
+
+// Keep original file of a stored receipt when STORAGE_DIR is set, so it can be read again later
+// Receipt is already stored, so errors are only logged
+func KeepOriginal(db *sql.DB, receipt *model.Receipt, file File) {
+	if len(storage.Dir()) == 0 {
+		return
+	}
+
+	image_path, err := storage.Save(receipt.UserID, file.Name, file.Data)
+	if err != nil {
+		log.Printf("KeepOriginal - Error saving file %s\n%v", file.Name, err)
+		return
+	}
+
+	if err := model.SetReceiptImage(db, receipt.ID, image_path, int64(len(file.Data))); err != nil {
+		log.Printf("KeepOriginal - Error storing file of receipt %d\n%v", receipt.ID, err)
+	}
+}
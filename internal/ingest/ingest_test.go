@@ -0,0 +1,172 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadZip(t *testing.T) {
+	buffer := bytes.Buffer{}
+	writer := zip.NewWriter(&buffer)
+
+	for _, name := range []string{"tickets/one.jpg", "two.PNG", "notes.txt", "__MACOSX/tickets/._one.jpg", ".hidden.jpg"} {
+		f, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("Unexpected error %s creating zip", err)
+		}
+		f.Write([]byte(name))
+	}
+	writer.Close()
+
+	files, err := ReadZip(buffer.Bytes())
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading zip", err)
+	}
+
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, "tickets/one.jpg", files[0].Name)
+	assert.Equal(t, []byte("tickets/one.jpg"), files[0].Data)
+	assert.Equal(t, "two.PNG", files[1].Name)
+}
+
+func TestReadZipLimits(t *testing.T) {
+	create := func(files int, size int) []byte {
+		buffer := bytes.Buffer{}
+		writer := zip.NewWriter(&buffer)
+
+		for i := 0; i < files; i++ {
+			f, err := writer.Create(fmt.Sprintf("ticket%d.jpg", i))
+			if err != nil {
+				t.Fatalf("Unexpected error %s creating zip", err)
+			}
+			f.Write(bytes.Repeat([]byte("a"), size))
+		}
+		writer.Close()
+
+		return buffer.Bytes()
+	}
+
+	defer func(files int, size uint64, total uint64) {
+		maxZipFiles, maxZipFileSize, maxZipTotalSize = files, size, total
+	}(maxZipFiles, maxZipFileSize, maxZipTotalSize)
+
+	maxZipFiles, maxZipFileSize, maxZipTotalSize = 3, 10, 25
+
+	_, err := ReadZip(create(3, 8))
+	assert.Nil(t, err)
+
+	_, err = ReadZip(create(4, 1))
+	assert.ErrorIs(t, err, ErrZipTooLarge, "Expected error with too many files")
+
+	_, err = ReadZip(create(1, 11))
+	assert.ErrorIs(t, err, ErrZipTooLarge, "Expected error with too large file")
+
+	_, err = ReadZip(create(3, 9))
+	assert.ErrorIs(t, err, ErrZipTooLarge, "Expected error with too large archive")
+}
+
+func TestReadZipInvalid(t *testing.T) {
+	_, err := ReadZip([]byte("not a zip"))
+	assert.NotNil(t, err, "Expected error reading invalid zip")
+}
+
+func TestProcessFiles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
+		WithArgs("%Any%", ts.Format(time.RFC3339), 1.5, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}).AddRow(1, 1, "Any", ts, "EUR", 1.5))
+
+	scan := func(data []byte) (*model.Receipt, error) {
+		switch string(data) {
+		case "wrong":
+			return nil, errors.New("Could not analyze")
+		case "panic":
+			panic("unexpected document")
+		default:
+			return &model.Receipt{Supermarket: "Any", Date: ts, Total: 1.5, Items: []model.ReceiptItem{{Name: "Pan", Quantity: 1, Price: 1.5}}}, nil
+		}
+	}
+
+	files := []File{
+		{Name: "wrong.jpg", Data: []byte("wrong")},
+		{Name: "notes.txt", Data: []byte("notes")},
+		{Name: "duplicate.png", Data: []byte("duplicate")},
+		{Name: "panic.pdf", Data: []byte("panic")},
+	}
+
+	created := 0
+	results := ProcessFiles(db, &model.User{ID: 1}, 0, files, scan, 1, func(receipt *model.Receipt) { created++ })
+
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, StatusFailed, results[0].Status)
+	assert.Equal(t, "Could not analyze", results[0].Error)
+	assert.Equal(t, StatusFailed, results[1].Status)
+	assert.Equal(t, StatusDuplicate, results[2].Status)
+	assert.Equal(t, "duplicate.png", results[2].File)
+	assert.Equal(t, StatusFailed, results[3].Status)
+	assert.Equal(t, 0, created)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessFilesConcurrency(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	var running, max int32
+	var lock sync.Mutex
+
+	scan := func(data []byte) (*model.Receipt, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		lock.Lock()
+		if current > max {
+			max = current
+		}
+		lock.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		return nil, errors.New("Could not analyze")
+	}
+
+	files := []File{}
+	for i := 0; i < 10; i++ {
+		files = append(files, File{Name: "ticket.jpg"})
+	}
+
+	results := ProcessFiles(db, &model.User{ID: 1}, 0, files, scan, 3, nil)
+
+	assert.Equal(t, 10, len(results))
+	assert.LessOrEqual(t, max, int32(3))
+}
@@ -0,0 +1,143 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+)
+
+// Folders where processed files are moved, inside watched folder
+const (
+	DoneFolder   = "done"
+	FailedFolder = "failed"
+)
+
+// Default time a file must be unchanged before processing it, so files still being synced are not read
+const defaultMinAge = 10 * time.Second
+
+// Scan new files found in a folder for a user, moving them to done or failed folders when processed
+// A sidecar log with the same name and .log extension is written next to every moved file
+type Watcher struct {
+	Dir         string
+	DB          *sql.DB
+	User        *model.User
+	Scan        Scanner
+	Concurrency int
+	Interval    time.Duration
+	MinAge      time.Duration
+	Created     func(receipt *model.Receipt)
+}
+
+// Check folder every interval until context is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Poll(); err != nil {
+			log.Printf("Watcher - Error checking folder %s\n%v", w.Dir, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process files ready in folder and return their results
+func (w *Watcher) Poll() ([]Result, error) {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	min_age := w.MinAge
+	if min_age == 0 {
+		min_age = defaultMinAge
+	}
+
+	files := []File{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !IsScannable(name) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		if time.Since(info.ModTime()) < min_age {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(w.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, File{Name: name, Data: data})
+	}
+
+	if len(files) == 0 {
+		return []Result{}, nil
+	}
+
+	results := ProcessFiles(w.DB, w.User, 0, files, w.Scan, w.Concurrency, w.Created)
+
+	for _, result := range results {
+		if err := w.move(result); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// Move processed file to done or failed folder, and write its sidecar log
+// Duplicated receipts are already stored, so they are moved to done folder
+func (w *Watcher) move(result Result) error {
+	folder := DoneFolder
+	if result.Status == StatusFailed {
+		folder = FailedFolder
+	}
+
+	target := filepath.Join(w.Dir, folder)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+
+	destination := filepath.Join(target, result.File)
+
+	// Keep files with the same name processed before
+	if _, err := os.Stat(destination); err == nil {
+		extension := filepath.Ext(result.File)
+		destination = filepath.Join(target, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(result.File, extension), time.Now().UnixNano(), extension))
+	}
+
+	if err := os.Rename(filepath.Join(w.Dir, result.File), destination); err != nil {
+		return err
+	}
+
+	entry := fmt.Sprintf("time=%s status=%s", time.Now().Format(time.RFC3339), result.Status)
+	if result.ReceiptID > 0 {
+		entry = fmt.Sprintf("%s receipt_id=%d", entry, result.ReceiptID)
+	}
+	if len(result.Error) > 0 {
+		entry = fmt.Sprintf("%s error=%q", entry, result.Error)
+	}
+
+	return os.WriteFile(fmt.Sprintf("%s.log", destination), []byte(entry+"\n"), 0644)
+}
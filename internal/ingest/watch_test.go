@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a file in dir with given content and modification time
+func writeFile(t *testing.T, dir string, name string, content string, modified time.Time) {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Unexpected error %s writing %s", err, name)
+	}
+
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("Unexpected error %s changing time of %s", err, name)
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Minute)
+	ts := time.Now()
+
+	writeFile(t, dir, "wrong.jpg", "wrong", old)
+	writeFile(t, dir, "duplicate.jpg", "duplicate", old)
+	writeFile(t, dir, "syncing.jpg", "wrong", time.Now())
+	writeFile(t, dir, "notes.txt", "notes", old)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
+		WithArgs("%Any%", ts.Format(time.RFC3339), 1.5, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}).AddRow(1, 1, "Any", ts, "EUR", 1.5))
+
+	watcher := Watcher{
+		Dir:         dir,
+		DB:          db,
+		User:        &model.User{ID: 1},
+		Concurrency: 1,
+		Scan: func(data []byte) (*model.Receipt, error) {
+			if string(data) == "wrong" {
+				return nil, errors.New("Could not analyze")
+			}
+			return &model.Receipt{Supermarket: "Any", Date: ts, Total: 1.5, Items: []model.ReceiptItem{{Name: "Pan", Quantity: 1, Price: 1.5}}}, nil
+		},
+	}
+
+	results, err := watcher.Poll()
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s polling folder", err)
+	}
+
+	assert.Equal(t, 2, len(results))
+
+	// Recent and not scannable files are kept
+	assert.FileExists(t, filepath.Join(dir, "syncing.jpg"))
+	assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+
+	assert.FileExists(t, filepath.Join(dir, FailedFolder, "wrong.jpg"))
+	assert.FileExists(t, filepath.Join(dir, DoneFolder, "duplicate.jpg"))
+
+	content, err := os.ReadFile(filepath.Join(dir, FailedFolder, "wrong.jpg.log"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading sidecar log", err)
+	}
+
+	assert.True(t, strings.Contains(string(content), "status=failed"))
+	assert.True(t, strings.Contains(string(content), `error="Could not analyze"`))
+
+	content, err = os.ReadFile(filepath.Join(dir, DoneFolder, "duplicate.jpg.log"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading sidecar log", err)
+	}
+
+	assert.True(t, strings.Contains(string(content), "status=duplicate"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWatcherPollKeepsPreviousFiles(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Minute)
+
+	watcher := Watcher{
+		Dir:         dir,
+		DB:          db,
+		User:        &model.User{ID: 1},
+		Concurrency: 1,
+		Scan: func(data []byte) (*model.Receipt, error) {
+			return nil, errors.New("Could not analyze")
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		writeFile(t, dir, "ticket.jpg", "ticket", old)
+
+		if _, err := watcher.Poll(); err != nil {
+			t.Fatalf("Unexpected error %s polling folder", err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, FailedFolder))
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading failed folder", err)
+	}
+
+	// Two files and their logs
+	assert.Equal(t, 4, len(entries))
+}
@@ -0,0 +1,191 @@
+package mailbox
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal IMAP4rev1 client with the commands needed to read unseen emails from a mailbox
+type IMAPClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// Line received from server, with the literal sent after it if any
+type imapResponse struct {
+	Text    string
+	Literal []byte
+}
+
+// Literal size at the end of a line, like {1234}
+var literalExp = regexp.MustCompile(`\{(\d+)\}$`)
+
+// Connect to IMAP server at given address, using TLS if requested
+func DialIMAP(address string, use_tls bool) (*IMAPClient, error) {
+	var conn net.Conn
+	var err error
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	if use_tls {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := &IMAPClient{conn: conn, reader: bufio.NewReader(conn)}
+
+	greeting, err := client.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("Unexpected IMAP greeting: %s", greeting)
+	}
+
+	return client, nil
+}
+
+// Quote string argument, escaping backslashes and quotes
+func quote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return fmt.Sprintf(`"%s"`, value)
+}
+
+func (c *IMAPClient) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Send a command and return untagged responses, or error if server does not answer OK
+func (c *IMAPClient) command(command string) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+
+	c.conn.SetDeadline(time.Now().Add(5 * time.Minute))
+
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+
+	responses := []imapResponse{}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("IMAP command %s failed: %s", strings.Fields(command)[0], status)
+			}
+
+			return responses, nil
+		}
+
+		response := imapResponse{Text: line}
+
+		// Literal content is sent after its size, followed by the rest of the line
+		if match := literalExp.FindStringSubmatch(line); match != nil {
+			size, _ := strconv.Atoi(match[1])
+			response.Literal = make([]byte, size)
+
+			if _, err := io.ReadFull(c.reader, response.Literal); err != nil {
+				return nil, err
+			}
+
+			if _, err := c.readLine(); err != nil {
+				return nil, err
+			}
+		}
+
+		responses = append(responses, response)
+	}
+}
+
+func (c *IMAPClient) Login(username string, password string) error {
+	_, err := c.command(fmt.Sprintf("LOGIN %s %s", quote(username), quote(password)))
+	return err
+}
+
+func (c *IMAPClient) Select(mailbox string) error {
+	_, err := c.command(fmt.Sprintf("SELECT %s", quote(mailbox)))
+	return err
+}
+
+// Return UID of emails not read yet
+func (c *IMAPClient) SearchUnseen() ([]uint32, error) {
+	responses, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+
+	uids := []uint32{}
+
+	for _, response := range responses {
+		if !strings.HasPrefix(response.Text, "* SEARCH") {
+			continue
+		}
+
+		for _, field := range strings.Fields(strings.TrimPrefix(response.Text, "* SEARCH")) {
+			uid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid UID %s", field)
+			}
+			uids = append(uids, uint32(uid))
+		}
+	}
+
+	return uids, nil
+}
+
+// Return full content of email without marking it as read
+func (c *IMAPClient) Fetch(uid uint32) ([]byte, error) {
+	responses, err := c.command(fmt.Sprintf("UID FETCH %d BODY.PEEK[]", uid))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, response := range responses {
+		if response.Literal != nil && strings.Contains(response.Text, "FETCH") {
+			return response.Literal, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Email %d not found", uid)
+}
+
+func (c *IMAPClient) MarkSeen(uid uint32) error {
+	_, err := c.command(fmt.Sprintf(`UID STORE %d +FLAGS (\Seen)`, uid))
+	return err
+}
+
+// Close session and connection
+func (c *IMAPClient) Logout() error {
+	_, err := c.command("LOGOUT")
+	c.conn.Close()
+	return err
+}
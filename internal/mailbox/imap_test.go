@@ -0,0 +1,109 @@
+package mailbox
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Start a local IMAP server answering commands with given responses, and return commands received
+func startIMAPServer(t *testing.T, responses map[string]string) (string, *[]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %s starting server", err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	commands := []string{}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			tag, command, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			commands = append(commands, command)
+
+			for prefix, response := range responses {
+				if strings.HasPrefix(command, prefix) {
+					fmt.Fprint(conn, response)
+				}
+			}
+
+			if command == "LOGIN \"user\" \"wrong\"" {
+				fmt.Fprintf(conn, "%s NO Invalid credentials\r\n", tag)
+				continue
+			}
+
+			fmt.Fprintf(conn, "%s OK done\r\n", tag)
+		}
+	}()
+
+	return listener.Addr().String(), &commands
+}
+
+func TestIMAPClient(t *testing.T) {
+	email := "From: a@example.com\r\n\r\nHello\r\n"
+
+	address, commands := startIMAPServer(t, map[string]string{
+		"UID SEARCH": "* SEARCH 3 7\r\n",
+		"UID FETCH":  fmt.Sprintf("* 1 FETCH (UID 3 BODY[] {%d}\r\n%s)\r\n", len(email), email),
+	})
+
+	client, err := DialIMAP(address, false)
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting", err)
+	}
+
+	assert.Nil(t, client.Login("user", `pa"ss`))
+	assert.Nil(t, client.Select("INBOX"))
+
+	uids, err := client.SearchUnseen()
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{3, 7}, uids)
+
+	content, err := client.Fetch(3)
+	assert.Nil(t, err)
+	assert.Equal(t, email, string(content))
+
+	assert.Nil(t, client.MarkSeen(3))
+	assert.Nil(t, client.Logout())
+
+	assert.Equal(t, []string{
+		`LOGIN "user" "pa\"ss"`,
+		`SELECT "INBOX"`,
+		"UID SEARCH UNSEEN",
+		"UID FETCH 3 BODY.PEEK[]",
+		`UID STORE 3 +FLAGS (\Seen)`,
+		"LOGOUT",
+	}, *commands)
+}
+
+func TestIMAPClientCommandFailed(t *testing.T) {
+	address, _ := startIMAPServer(t, map[string]string{})
+
+	client, err := DialIMAP(address, false)
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting", err)
+	}
+	defer client.Logout()
+
+	err = client.Login("user", "wrong")
+	assert.Equal(t, "IMAP command LOGIN failed: NO Invalid credentials", err.Error())
+}
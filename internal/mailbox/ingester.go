@@ -0,0 +1,172 @@
+package mailbox
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/ingest"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+)
+
+// Create receipts from emails, for the user whose address the email was sent to
+// HTML e-tickets from senders with a template are read directly, and attachments are scanned
+type Ingester struct {
+	DB          *sql.DB
+	Users       map[string]int
+	Templates   []Template
+	Scan        func(user *model.User, data []byte) (*model.Receipt, error)
+	Concurrency int
+	Created     func(user *model.User, receipt *model.Receipt)
+}
+
+// Read users receiving receipts by email from MAIL_USERS, with format address=user_id,address=user_id
+func UsersFromEnv() (map[string]int, error) {
+	users := map[string]int{}
+
+	for _, entry := range strings.Split(os.Getenv("MAIL_USERS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		address, id, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("Invalid value for MAIL_USERS: %s", entry)
+		}
+
+		user_id, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid user for address %s: %v", address, err)
+		}
+
+		users[strings.ToLower(strings.TrimSpace(address))] = user_id
+	}
+
+	return users, nil
+}
+
+// Return user owning the first recipient with a known address
+func (i *Ingester) findUser(message *Message) (*model.User, error) {
+	for _, recipient := range message.Recipients {
+		user_id, ok := i.Users[recipient]
+		if !ok {
+			continue
+		}
+
+		user, err := model.FindUserById(i.DB, user_id)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting user %d for address %s: %v", user_id, recipient, err)
+		}
+
+		return user, nil
+	}
+
+	return nil, fmt.Errorf("No user found for recipients %s", strings.Join(message.Recipients, ", "))
+}
+
+// Create receipts from an email, returning a result for every receipt found
+func (i *Ingester) Process(r io.Reader) ([]ingest.Result, error) {
+	message, err := ParseMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := i.findUser(message)
+	if err != nil {
+		return nil, err
+	}
+
+	created := func(receipt *model.Receipt) {
+		if i.Created != nil {
+			i.Created(user, receipt)
+		}
+	}
+
+	results := []ingest.Result{}
+
+	template := FindTemplate(i.Templates, message.From)
+
+	for index, content := range message.HTML {
+		// Emails without attachments from unknown senders can not be read
+		if template == nil {
+			if len(message.Attachments) == 0 {
+				results = append(results, ingest.Result{File: message.Subject, Status: ingest.StatusFailed, Error: fmt.Sprintf("No template found for sender %s", message.From)})
+			}
+			break
+		}
+
+		file := ingest.File{Name: fmt.Sprintf("%s #%d", message.Subject, index+1)}
+
+		receipt, err := template.Parse(content)
+		if err == nil {
+			receipt.UserID = user.ID
+			err = model.ValidateReceipt(receipt)
+		}
+
+		if err != nil {
+			// HTML parts besides the e-ticket, like newsletters, are ignored when a receipt was already read
+			if len(message.HTML) == 1 {
+				results = append(results, ingest.Result{File: file.Name, Status: ingest.StatusFailed, Error: err.Error()})
+			}
+			continue
+		}
+
+		results = append(results, ingest.StoreReceipt(i.DB, file, receipt, created))
+	}
+
+	if len(message.Attachments) > 0 {
+		scan := func(data []byte) (*model.Receipt, error) {
+			receipt, err := i.Scan(user, data)
+			if receipt != nil {
+				receipt.Source = model.SourceEmail
+			}
+			return receipt, err
+		}
+
+		results = append(results, ingest.ProcessFiles(i.DB, user, 0, message.Attachments, scan, i.Concurrency, created)...)
+	}
+
+	if len(results) == 0 {
+		results = append(results, ingest.Result{File: message.Subject, Status: ingest.StatusFailed, Error: "No receipt found in email"})
+	}
+
+	return results, nil
+}
+
+// Create receipts from unseen emails in selected mailbox, marking them as seen once processed
+// Emails which can not be processed are marked as seen too, so they are not read again every time
+func (i *Ingester) PollIMAP(client *IMAPClient) ([]ingest.Result, error) {
+	uids, err := client.SearchUnseen()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ingest.Result{}
+
+	for _, uid := range uids {
+		content, err := client.Fetch(uid)
+		if err != nil {
+			return results, err
+		}
+
+		email_results, err := i.Process(bytes.NewReader(content))
+		if err != nil {
+			log.Printf("PollIMAP - Error processing email %d\n%v", uid, err)
+			email_results = []ingest.Result{{File: fmt.Sprintf("email %d", uid), Status: ingest.StatusFailed, Error: err.Error()}}
+		}
+
+		results = append(results, email_results...)
+
+		if err := client.MarkSeen(uid); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,128 @@
+package mailbox
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/ingest"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsersFromEnv(t *testing.T) {
+	t.Setenv("MAIL_USERS", "Receipts@example.com=1, family@example.com=2")
+
+	users, err := UsersFromEnv()
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading users", err)
+	}
+
+	assert.Equal(t, map[string]int{"receipts@example.com": 1, "family@example.com": 2}, users)
+}
+
+func TestUsersFromEnvInvalid(t *testing.T) {
+	t.Setenv("MAIL_USERS", "receipts@example.com")
+
+	_, err := UsersFromEnv()
+	assert.NotNil(t, err, "Expected error reading invalid users")
+}
+
+func TestIngesterProcess(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	date := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at FROM users WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at"}).AddRow(1, "uid", nil, nil, nil, nil, nil, nil, nil, nil))
+
+	// Receipt read from HTML already exists
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
+		WithArgs("%Super%", date.Format(time.RFC3339), 2.5, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}).AddRow(1, 1, "Super", date, "EUR", 2.5))
+
+	scanned := 0
+
+	ingester := Ingester{
+		DB:          db,
+		Users:       map[string]int{"receipts@example.com": 1},
+		Templates:   []Template{testTemplate},
+		Concurrency: 1,
+		Scan: func(user *model.User, data []byte) (*model.Receipt, error) {
+			scanned++
+			return nil, errors.New("Could not analyze")
+		},
+	}
+
+	results, err := ingester.Process(strings.NewReader(testEmail))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s processing email", err)
+	}
+
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, ingest.StatusDuplicate, results[0].Status)
+	assert.Equal(t, ingest.StatusFailed, results[1].Status)
+	assert.Equal(t, "ticket.pdf", results[1].File)
+	assert.Equal(t, 1, scanned)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIngesterProcessNoTemplate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at FROM users WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at"}).AddRow(1, "uid", nil, nil, nil, nil, nil, nil, nil, nil))
+
+	ingester := Ingester{DB: db, Users: map[string]int{"receipts@example.com": 1}}
+
+	email := "From: news@unknown.example\r\nTo: receipts@example.com\r\nSubject: Offers\r\nContent-Type: text/html\r\n\r\n<p>Offers</p>\r\n"
+
+	results, err := ingester.Process(strings.NewReader(email))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s processing email", err)
+	}
+
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, ingest.StatusFailed, results[0].Status)
+	assert.Equal(t, "No template found for sender news@unknown.example", results[0].Error)
+}
+
+func TestIngesterProcessUnknownRecipient(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ingester := Ingester{DB: db, Users: map[string]int{"receipts@example.com": 1}}
+
+	_, err = ingester.Process(strings.NewReader("From: a@example.com\r\nTo: other@example.com\r\n\r\nHello\r\n"))
+
+	assert.Equal(t, "No user found for recipients other@example.com", err.Error())
+}
@@ -0,0 +1,156 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/ingest"
+	"golang.org/x/net/html/charset"
+)
+
+// Parts of an email useful to create receipts
+type Message struct {
+	From        string
+	Recipients  []string
+	Subject     string
+	HTML        []string
+	Attachments []ingest.File
+}
+
+// Headers where the address receipts are sent to can be found, forwarded emails keep the original one in Delivered-To
+var recipientHeaders = []string{"Delivered-To", "X-Original-To", "To", "Cc"}
+
+// Read an email in RFC 5322 format, like .eml files, keeping HTML bodies and scannable attachments
+func ParseMessage(r io.Reader) (*Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+	message := Message{Recipients: []string{}, HTML: []string{}, Attachments: []ingest.File{}}
+
+	if subject, err := decoder.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		message.Subject = subject
+	}
+
+	if from, err := msg.Header.AddressList("From"); err == nil && len(from) > 0 {
+		message.From = strings.ToLower(from[0].Address)
+	}
+
+	for _, header := range recipientHeaders {
+		addresses, err := msg.Header.AddressList(header)
+		if err != nil {
+			continue
+		}
+
+		for _, address := range addresses {
+			message.Recipients = append(message.Recipients, strings.ToLower(address.Address))
+		}
+	}
+
+	if err := message.readPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// Read a message part, walking through nested multipart parts
+func (message *Message) readPart(content_type string, encoding string, disposition string, body io.Reader) error {
+	if len(content_type) == 0 {
+		content_type = "text/plain"
+	}
+
+	media_type, params, err := mime.ParseMediaType(content_type)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(media_type, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := message.readPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(decodeTransfer(body, encoding))
+	if err != nil {
+		return err
+	}
+
+	if name := partFileName(params, disposition); len(name) > 0 {
+		if ingest.IsScannable(name) {
+			message.Attachments = append(message.Attachments, ingest.File{Name: name, Data: content})
+		}
+		return nil
+	}
+
+	if media_type == "text/html" {
+		html, err := decodeCharset(content, params["charset"])
+		if err != nil {
+			return err
+		}
+		message.HTML = append(message.HTML, html)
+	}
+
+	return nil
+}
+
+// Return reader decoding given content transfer encoding
+func decodeTransfer(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// Convert content in given charset to UTF-8
+func decodeCharset(content []byte, label string) (string, error) {
+	if len(label) == 0 {
+		return string(content), nil
+	}
+
+	reader, err := charset.NewReaderLabel(label, bytes.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("Unsupported charset %s", label)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	return string(decoded), err
+}
+
+// Return attachment file name from disposition or content type params
+func partFileName(params map[string]string, disposition string) string {
+	if len(disposition) > 0 {
+		if _, disposition_params, err := mime.ParseMediaType(disposition); err == nil && len(disposition_params["filename"]) > 0 {
+			return disposition_params["filename"]
+		}
+	}
+
+	return params["name"]
+}
@@ -0,0 +1,65 @@
+package mailbox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testEmail = "From: Super Tickets <tickets@super.example>\r\n" +
+	"To: someone@example.com\r\n" +
+	"Delivered-To: receipts@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Tu_ticket_de_compra?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Ticket\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<div class=3D\"date\">01/02/2024</div>\r\n" +
+	"<div class=3D\"item\"><span class=3D\"name\">Pi=F1a</span><span class=3D\"price\">2,50 =80</span></div>\r\n" +
+	"<div class=3D\"total\">2,50</div>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"ticket.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"ticket.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"notes\r\n" +
+	"--outer--\r\n"
+
+func TestParseMessage(t *testing.T) {
+	message, err := ParseMessage(strings.NewReader(testEmail))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s parsing email", err)
+	}
+
+	assert.Equal(t, "tickets@super.example", message.From)
+	assert.Equal(t, "Tu ticket de compra", message.Subject)
+	assert.Equal(t, []string{"receipts@example.com", "someone@example.com"}, message.Recipients)
+	assert.Equal(t, 1, len(message.HTML))
+	assert.Contains(t, message.HTML[0], "Piña")
+	assert.Equal(t, 1, len(message.Attachments))
+	assert.Equal(t, "ticket.pdf", message.Attachments[0].Name)
+	assert.Equal(t, []byte("%PDF-1.4\n"), message.Attachments[0].Data)
+}
+
+func TestParseMessageInvalid(t *testing.T) {
+	_, err := ParseMessage(strings.NewReader("not an email"))
+	assert.NotNil(t, err, "Expected error parsing invalid email")
+}
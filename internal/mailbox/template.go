@@ -0,0 +1,211 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"golang.org/x/net/html"
+)
+
+// Describe how to read an HTML e-ticket sent by a supermarket chain, finding values by element class
+// Receipts from senders with a template are read directly, without using OCR
+type Template struct {
+	Name           string   `json:"name"`
+	Senders        []string `json:"senders"`
+	Supermarket    string   `json:"supermarket"`
+	Currency       string   `json:"currency"`
+	DateClass      string   `json:"date_class"`
+	DateLayout     string   `json:"date_layout"`
+	TotalClass     string   `json:"total_class"`
+	ItemClass      string   `json:"item_class"`
+	NameClass      string   `json:"name_class"`
+	QuantityClass  string   `json:"quantity_class"`
+	UnitPriceClass string   `json:"unit_price_class"`
+	PriceClass     string   `json:"price_class"`
+}
+
+// Amount with decimals, like 1,25 or 1.25
+var amountExp = regexp.MustCompile(`-?\d+(?:[.,]\d+)?`)
+
+// Read templates from a JSON file with an array of templates
+func LoadTemplates(path string) ([]Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []Template{}
+	if err := json.Unmarshal(content, &templates); err != nil {
+		return nil, fmt.Errorf("Error reading templates from %s: %v", path, err)
+	}
+
+	return templates, nil
+}
+
+// Check if email was sent by one of template senders, which can be full addresses or domains
+func (t *Template) Matches(from string) bool {
+	from = strings.ToLower(from)
+
+	for _, sender := range t.Senders {
+		sender = strings.ToLower(sender)
+
+		if from == sender || strings.HasSuffix(from, "@"+strings.TrimPrefix(sender, "@")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return first template matching sender
+func FindTemplate(templates []Template, from string) *Template {
+	for index := range templates {
+		if templates[index].Matches(from) {
+			return &templates[index]
+		}
+	}
+
+	return nil
+}
+
+// Read receipt from HTML content using template classes
+func (t *Template) Parse(content string) (*model.Receipt, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := model.Receipt{Supermarket: t.Supermarket, Currency: t.Currency, Source: model.SourceEmail}
+
+	date_text := findText(doc, t.DateClass)
+	if len(date_text) == 0 {
+		return nil, errors.New("Date not found")
+	}
+
+	layout := t.DateLayout
+	if len(layout) == 0 {
+		layout = "02/01/2006"
+	}
+
+	receipt.Date, err = time.Parse(layout, date_text)
+	if err != nil {
+		return nil, fmt.Errorf("Error in date format: %v", err)
+	}
+
+	for index, node := range findAll(doc, t.ItemClass) {
+		item := model.ReceiptItem{Name: findText(node, t.NameClass), Quantity: 1}
+
+		item.Price, err = parseAmount(findText(node, t.PriceClass))
+		if err != nil {
+			return nil, fmt.Errorf("Error in price of item #%d: %v", index, err)
+		}
+
+		if len(t.QuantityClass) > 0 {
+			if quantity := findText(node, t.QuantityClass); len(quantity) > 0 {
+				item.Quantity, err = parseAmount(quantity)
+				if err != nil {
+					return nil, fmt.Errorf("Error in quantity of item #%d: %v", index, err)
+				}
+			}
+		}
+
+		if len(t.UnitPriceClass) > 0 {
+			if unit_price := findText(node, t.UnitPriceClass); len(unit_price) > 0 {
+				item.UnitPrice, err = parseAmount(unit_price)
+				if err != nil {
+					return nil, fmt.Errorf("Error in unit price of item #%d: %v", index, err)
+				}
+			}
+		}
+
+		receipt.Items = append(receipt.Items, item)
+	}
+
+	if len(receipt.Items) == 0 {
+		return nil, errors.New("Items not found")
+	}
+
+	receipt.Total, err = parseAmount(findText(doc, t.TotalClass))
+	if err != nil {
+		return nil, fmt.Errorf("Error in total: %v", err)
+	}
+
+	return &receipt, nil
+}
+
+// Parse first amount found in text, ignoring currency symbols
+func parseAmount(text string) (float64, error) {
+	amount := amountExp.FindString(text)
+	if len(amount) == 0 {
+		return 0, fmt.Errorf("Amount not found in %q", text)
+	}
+
+	return strconv.ParseFloat(strings.Replace(amount, ",", ".", 1), 64)
+}
+
+// Check if element has given class
+func hasClass(node *html.Node, class string) bool {
+	if node.Type != html.ElementNode || len(class) == 0 {
+		return false
+	}
+
+	for _, attr := range node.Attr {
+		if attr.Key == "class" {
+			for _, name := range strings.Fields(attr.Val) {
+				if name == class {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Return every element below node with given class
+func findAll(node *html.Node, class string) []*html.Node {
+	found := []*html.Node{}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if hasClass(child, class) {
+			found = append(found, child)
+			continue
+		}
+
+		found = append(found, findAll(child, class)...)
+	}
+
+	return found
+}
+
+// Return text of first element below node with given class, with spaces collapsed
+func findText(node *html.Node, class string) string {
+	found := findAll(node, class)
+	if len(found) == 0 {
+		return ""
+	}
+
+	return strings.Join(strings.Fields(text(found[0])), " ")
+}
+
+// Return text inside node and its children
+func text(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+
+	var builder strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(text(child))
+		builder.WriteString(" ")
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,87 @@
+package mailbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var testTemplate = Template{
+	Name:        "Super",
+	Senders:     []string{"super.example"},
+	Supermarket: "Super",
+	Currency:    "EUR",
+	DateClass:   "date",
+	TotalClass:  "total",
+	ItemClass:   "item",
+	NameClass:   "name",
+	PriceClass:  "price",
+}
+
+func TestTemplateMatches(t *testing.T) {
+	template := Template{Senders: []string{"@super.example", "tickets@other.example"}}
+
+	assert.True(t, template.Matches("tickets@super.example"))
+	assert.True(t, template.Matches("Tickets@Other.example"))
+	assert.False(t, template.Matches("news@other.example"))
+	assert.False(t, template.Matches("tickets@notsuper.example"))
+}
+
+func TestFindTemplate(t *testing.T) {
+	templates := []Template{{Name: "Other", Senders: []string{"other.example"}}, testTemplate}
+
+	assert.Equal(t, "Super", FindTemplate(templates, "tickets@super.example").Name)
+	assert.Nil(t, FindTemplate(templates, "tickets@unknown.example"))
+}
+
+func TestTemplateParse(t *testing.T) {
+	content := `<html><body>
+		<p class="date">01/02/2024</p>
+		<table>
+			<tr class="item"><td class="name">Piña  natural</td><td class="price">2,50 €</td></tr>
+			<tr class="item odd"><td class="name">Pan</td><td class="price">1.20</td></tr>
+		</table>
+		<p>Total: <b class="total">3,70 €</b></p>
+	</body></html>`
+
+	receipt, err := testTemplate.Parse(content)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s parsing receipt", err)
+	}
+
+	assert.Equal(t, "Super", receipt.Supermarket)
+	assert.Equal(t, "EUR", receipt.Currency)
+	assert.Equal(t, model.SourceEmail, receipt.Source)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), receipt.Date)
+	assert.Equal(t, 3.70, receipt.Total)
+	assert.Equal(t, 2, len(receipt.Items))
+	assert.Equal(t, "Piña natural", receipt.Items[0].Name)
+	assert.Equal(t, 2.50, receipt.Items[0].Price)
+	assert.Equal(t, 1.0, receipt.Items[0].Quantity)
+	assert.Equal(t, 1.20, receipt.Items[1].Price)
+}
+
+func TestTemplateParseMissingItems(t *testing.T) {
+	_, err := testTemplate.Parse(`<p class="date">01/02/2024</p><p class="total">1</p>`)
+	assert.Equal(t, "Items not found", err.Error())
+}
+
+func TestLoadTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	os.WriteFile(path, []byte(`[{"name": "Super", "senders": ["super.example"], "item_class": "item"}]`), 0644)
+
+	templates, err := LoadTemplates(path)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s loading templates", err)
+	}
+
+	assert.Equal(t, 1, len(templates))
+	assert.Equal(t, "Super", templates[0].Name)
+	assert.Equal(t, "item", templates[0].ItemClass)
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"database/sql"
+)
+
+// Return every change made by user to receipts, including receipts of households
+func FindReceiptChangesByUser(db *sql.DB, user_id int64) (*[]ReceiptChange, error) {
+	rows, err := db.Query(`SELECT id, receipt_id, receipt_item_id, action, field, old_value, new_value, change_date FROM receipt_changes
+		WHERE user_id = ? ORDER BY change_date, id`, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	changes := []ReceiptChange{}
+
+	for rows.Next() {
+		change := ReceiptChange{UserID: user_id}
+		var item_id sql.NullInt64
+		var field, old_value, new_value sql.NullString
+
+		if err := rows.Scan(&change.ID, &change.ReceiptID, &item_id, &change.Action, &field, &old_value, &new_value, &change.Date); err != nil {
+			return nil, err
+		}
+
+		change.ReceiptItemID = item_id.Int64
+		change.Field = field.String
+		change.OldValue = old_value.String
+		change.NewValue = new_value.String
+		changes = append(changes, change)
+	}
+
+	return &changes, rows.Err()
+}
+
+// Return path of original files kept for receipts created by user, by receipt id
+func FindReceiptImagesForUser(db *sql.DB, user_id int64) (map[int64]string, error) {
+	rows, err := db.Query("SELECT id, image_path FROM receipts WHERE user_id = ? AND image_path IS NOT NULL AND image_path <> '' ORDER BY id", user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	images := map[int64]string{}
+
+	for rows.Next() {
+		var receipt_id int64
+		var image_path string
+		if err := rows.Scan(&receipt_id, &image_path); err != nil {
+			return nil, err
+		}
+
+		images[receipt_id] = image_path
+	}
+
+	return images, rows.Err()
+}
+
+// Delete user and everything belonging to them, returning sql.ErrNoRows if user does not exist
+// Receipts created by user are deleted, even in households, while changes made to receipts of other users,
+// invites and scans, which count for instance budget, are kept without user. Households left without members are deleted, and households left
+// without owner get their oldest member as owner
+func DeleteUserAccount(db *sql.DB, user_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT household_id FROM household_members WHERE user_id = ?", user_id)
+	if err != nil {
+		return err
+	}
+
+	household_ids := []int64{}
+	for rows.Next() {
+		var household_id int64
+		if err := rows.Scan(&household_id); err != nil {
+			rows.Close()
+			return err
+		}
+		household_ids = append(household_ids, household_id)
+	}
+	rows.Close()
+
+	const own_receipts = "SELECT id FROM receipts WHERE user_id = ?"
+
+	statements := []struct {
+		query      string
+		parameters []interface{}
+	}{
+		{"DELETE FROM receipt_items WHERE receipt_id IN (" + own_receipts + ")", []interface{}{user_id}},
+		{"DELETE FROM price_changes WHERE user_id = ? OR receipt_id IN (" + own_receipts + ")", []interface{}{user_id, user_id}},
+		{"DELETE FROM receipt_changes WHERE receipt_id IN (" + own_receipts + ")", []interface{}{user_id}},
+		{"UPDATE receipt_changes SET user_id = 0 WHERE user_id = ?", []interface{}{user_id}},
+		{"DELETE FROM receipts WHERE user_id = ?", []interface{}{user_id}},
+		{"DELETE FROM household_members WHERE user_id = ?", []interface{}{user_id}},
+		{"UPDATE invites SET created_by = 0 WHERE created_by = ?", []interface{}{user_id}},
+		{"UPDATE invites SET used_by = 0 WHERE used_by = ?", []interface{}{user_id}},
+		{"UPDATE scans SET user_id = 0 WHERE user_id = ?", []interface{}{user_id}},
+		{"DELETE FROM user_identities WHERE user_id = ?", []interface{}{user_id}},
+		{"DELETE FROM sessions WHERE user_id = ?", []interface{}{user_id}},
+		{"DELETE FROM api_tokens WHERE user_id = ?", []interface{}{user_id}},
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.parameters...); err != nil {
+			return err
+		}
+	}
+
+	for _, household_id := range household_ids {
+		var members, owners int64
+		if err := tx.QueryRow("SELECT COUNT(*), COUNT(CASE WHEN role = ? THEN 1 END) FROM household_members WHERE household_id = ?", RoleOwner, household_id).Scan(&members, &owners); err != nil {
+			return err
+		}
+
+		if members == 0 {
+			if _, err := tx.Exec("UPDATE receipts SET household_id = NULL WHERE household_id = ?", household_id); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("DELETE FROM households WHERE id = ?", household_id); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if owners == 0 {
+			if _, err := tx.Exec("UPDATE household_members SET role = ? WHERE household_id = ? AND user_id = (SELECT user_id FROM household_members WHERE household_id = ? ORDER BY joined_date LIMIT 1)",
+				RoleOwner, household_id, household_id); err != nil {
+				return err
+			}
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM users WHERE id = ?", user_id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Expect statements deleting or anonymizing data of user 3
+func expectDeleteUserData(mock sqlmock.Sqlmock) {
+	for _, query := range []string{
+		"DELETE FROM receipt_items WHERE receipt_id IN (SELECT id FROM receipts WHERE user_id = ?)",
+		"DELETE FROM price_changes WHERE user_id = ? OR receipt_id IN (SELECT id FROM receipts WHERE user_id = ?)",
+		"DELETE FROM receipt_changes WHERE receipt_id IN (SELECT id FROM receipts WHERE user_id = ?)",
+		"UPDATE receipt_changes SET user_id = 0 WHERE user_id = ?",
+		"DELETE FROM receipts WHERE user_id = ?",
+		"DELETE FROM household_members WHERE user_id = ?",
+		"UPDATE invites SET created_by = 0 WHERE created_by = ?",
+		"UPDATE invites SET used_by = 0 WHERE used_by = ?",
+		"UPDATE scans SET user_id = 0 WHERE user_id = ?",
+		"DELETE FROM user_identities WHERE user_id = ?",
+		"DELETE FROM sessions WHERE user_id = ?",
+		"DELETE FROM api_tokens WHERE user_id = ?",
+	} {
+		mock.ExpectExec(regexp.QuoteMeta(query)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
+
+func TestDeleteUserAccount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT household_id FROM household_members WHERE user_id = ?")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"household_id"}).AddRow(1).AddRow(2).AddRow(4))
+
+	expectDeleteUserData(mock)
+
+	counts := regexp.QuoteMeta("SELECT COUNT(*), COUNT(CASE WHEN role = ? THEN 1 END) FROM household_members WHERE household_id = ?")
+
+	// Household without members is deleted
+	mock.ExpectQuery(counts).WithArgs(RoleOwner, 1).WillReturnRows(sqlmock.NewRows([]string{"members", "owners"}).AddRow(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET household_id = NULL WHERE household_id = ?")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM households WHERE id = ?")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Household without owner gets a new one
+	mock.ExpectQuery(counts).WithArgs(RoleOwner, 2).WillReturnRows(sqlmock.NewRows([]string{"members", "owners"}).AddRow(2, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE household_members SET role = ? WHERE household_id = ?")).
+		WithArgs(RoleOwner, 2, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Household with other owners is kept
+	mock.ExpectQuery(counts).WithArgs(RoleOwner, 4).WillReturnRows(sqlmock.NewRows([]string{"members", "owners"}).AddRow(2, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = ?")).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, DeleteUserAccount(db, 3))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteUserAccountNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT household_id FROM household_members WHERE user_id = ?")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"household_id"}))
+
+	expectDeleteUserData(mock)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = ?")).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	assert.Equal(t, sql.ErrNoRows, DeleteUserAccount(db, 3))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Roles of users
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
+var (
+	ErrInvalidUserRole = errors.New("Invalid user role")
+	ErrUserDisabled    = errors.New("User is disabled")
+)
+
+// User with the storage and scans used, shown to administrators
+type UserUsage struct {
+	User
+	Receipts     int64   `json:"receipts"`
+	Scans        int64   `json:"scans"`
+	Pages        int64   `json:"pages"`
+	Cost         float64 `json:"cost"`
+	StorageBytes int64   `json:"storage_bytes"`
+}
+
+// Return every user with their usage, including disabled users
+// Scans are every file analyzed by Textract, even if receipt could not be stored
+func FindAllUsersWithUsage(db *sql.DB) (*[]UserUsage, error) {
+	columns := "users." + strings.ReplaceAll(userColumns, ", ", ", users.")
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT %s, COUNT(receipts.id), COALESCE(SUM(receipts.image_size), 0),
+		COALESCE(scan_usage.scans, 0), COALESCE(scan_usage.pages, 0), COALESCE(scan_usage.cost, 0)
+		FROM users LEFT JOIN receipts ON receipts.user_id = users.id AND receipts.deleted_at IS NULL
+		LEFT JOIN (SELECT user_id, COUNT(*) AS scans, SUM(pages) AS pages, SUM(cost) AS cost FROM scans GROUP BY user_id) scan_usage ON scan_usage.user_id = users.id
+		GROUP BY users.id ORDER BY users.id`, columns))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []UserUsage{}
+
+	for rows.Next() {
+		usage := UserUsage{}
+		user, err := scanUser(rows, &usage.Receipts, &usage.StorageBytes, &usage.Scans, &usage.Pages, &usage.Cost)
+		if err != nil {
+			return nil, err
+		}
+
+		usage.User = *user
+		users = append(users, usage)
+	}
+
+	return &users, rows.Err()
+}
+
+// Change role of user, returning sql.ErrNoRows if user does not exist
+func SetUserRole(db *sql.DB, user_id int64, role string) error {
+	if role != UserRoleUser && role != UserRoleAdmin {
+		return ErrInvalidUserRole
+	}
+
+	res, err := db.Exec("UPDATE users SET role = ? WHERE id = ?", role, user_id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Disable or enable user, returning sql.ErrNoRows if user does not exist
+// Disabled users can not log in nor use their tokens, but their data is kept
+func SetUserDisabled(db *sql.DB, user_id int64, disabled bool) error {
+	var disabled_at sql.NullTime
+	if disabled {
+		disabled_at = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	res, err := db.Exec("UPDATE users SET disabled_at = ? WHERE id = ?", disabled_at, user_id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
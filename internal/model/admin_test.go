@@ -0,0 +1,76 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindAllUsersWithUsage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	disabled_at := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT users.id, users.google_uid, users.email, users.name, users.picture_url, users.locale, users.currency, users.timezone, users.role, users.disabled_at, COUNT(receipts.id)")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at", "receipts", "storage_bytes", "scans", "pages", "cost"}).
+			AddRow(1, "12345", "admin@example.com", "Admin", nil, nil, nil, nil, "admin", nil, 4, 2048, 3, 5, 0.05).
+			AddRow(2, nil, "user@example.com", "User", nil, nil, nil, nil, nil, disabled_at, 0, 0, 0, 0, 0))
+
+	users, err := FindAllUsersWithUsage(db)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting users", err)
+	}
+
+	assert.Equal(t, 2, len(*users))
+	assert.Equal(t, UserRoleAdmin, (*users)[0].Role)
+	assert.Equal(t, int64(4), (*users)[0].Receipts)
+	assert.Equal(t, int64(3), (*users)[0].Scans)
+	assert.Equal(t, int64(5), (*users)[0].Pages)
+	assert.Equal(t, 0.05, (*users)[0].Cost)
+	assert.Equal(t, int64(2048), (*users)[0].StorageBytes)
+	assert.Equal(t, UserRoleUser, (*users)[1].Role)
+	assert.NotNil(t, (*users)[1].DisabledAt)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetUserRoleInvalid(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	assert.ErrorIs(t, SetUserRole(db, 1, "owner"), ErrInvalidUserRole)
+}
+
+func TestSetUserDisabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET disabled_at = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, SetUserDisabled(db, 2, true))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scopes of API tokens
+const (
+	// Read receipts, products and stats
+	ScopeRead = "read"
+
+	// Upload and import receipts
+	ScopeUpload = "upload"
+
+	// Export receipts
+	ScopeExport = "export"
+
+	// Use administration endpoints, only for administrators
+	ScopeAdmin = "admin"
+)
+
+// Prefix of API tokens, which tells them apart from session tokens
+const APITokenPrefix = "sbt_"
+
+var ErrInvalidAPIToken = errors.New("Invalid or expired API token")
+
+// Token created by a user for scripts and automations
+type APIToken struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"-"`
+	Name         string     `json:"name"`
+	Scopes       []string   `json:"scopes"`
+	CreatedDate  time.Time  `json:"created_date"`
+	ExpiresDate  *time.Time `json:"expires_date"`
+	LastUsedDate *time.Time `json:"last_used_date"`
+}
+
+// Check if token has given scope
+func (token *APIToken) HasScope(scope string) bool {
+	for _, value := range token.Scopes {
+		if value == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeUpload || scope == ScopeExport || scope == ScopeAdmin
+}
+
+func scanAPIToken(token *APIToken, scopes string, expires_date sql.NullTime, last_used_date sql.NullTime) {
+	token.Scopes = strings.Split(scopes, ",")
+
+	if expires_date.Valid {
+		token.ExpiresDate = &expires_date.Time
+	}
+
+	if last_used_date.Valid {
+		token.LastUsedDate = &last_used_date.Time
+	}
+}
+
+// Create an API token for user, returning it with the token value, which is not stored and can not be read again
+func CreateAPIToken(db *sql.DB, user_id int64, name string, scopes []string, expires_date *time.Time) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return nil, "", errors.New("Token name can not be empty")
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", errors.New("Token needs at least one scope")
+	}
+
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", fmt.Errorf("Invalid scope %s", scope)
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+
+	value := APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	token := APIToken{UserID: user_id, Name: name, Scopes: scopes, CreatedDate: time.Now(), ExpiresDate: expires_date}
+
+	res, err := db.Exec("INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_date, expires_date) VALUES (?, ?, ?, ?, ?, ?)",
+		token.UserID, token.Name, hashToken(value), strings.Join(token.Scopes, ","), token.CreatedDate, token.ExpiresDate)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &token, value, nil
+}
+
+// Return API tokens of user, without their values
+func FindAPITokensForUser(db *sql.DB, user_id int64) (*[]APIToken, error) {
+	rows, err := db.Query("SELECT id, name, scopes, created_date, expires_date, last_used_date FROM api_tokens WHERE user_id = ? ORDER BY id", user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tokens := []APIToken{}
+
+	for rows.Next() {
+		token := APIToken{UserID: user_id}
+		var scopes string
+		var expires_date, last_used_date sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedDate, &expires_date, &last_used_date); err != nil {
+			return nil, err
+		}
+
+		scanAPIToken(&token, scopes, expires_date, last_used_date)
+		tokens = append(tokens, token)
+	}
+
+	return &tokens, rows.Err()
+}
+
+// Return API token for given value if it is not expired, and store when it was used
+func FindAPIToken(db *sql.DB, value string) (*APIToken, error) {
+	token := APIToken{}
+	var scopes string
+	var expires_date, last_used_date sql.NullTime
+
+	err := db.QueryRow("SELECT id, user_id, name, scopes, created_date, expires_date, last_used_date FROM api_tokens WHERE token_hash = ?", hashToken(value)).
+		Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.CreatedDate, &expires_date, &last_used_date)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	scanAPIToken(&token, scopes, expires_date, last_used_date)
+
+	if token.ExpiresDate != nil && time.Now().After(*token.ExpiresDate) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	now := time.Now()
+	token.LastUsedDate = &now
+
+	if _, err := db.Exec("UPDATE api_tokens SET last_used_date = ? WHERE id = ?", now, token.ID); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Delete an API token of user, returning sql.ErrNoRows if it does not exist
+func DeleteAPIToken(db *sql.DB, token_id int64, user_id int64) error {
+	res, err := db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", token_id, user_id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
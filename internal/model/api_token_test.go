@@ -0,0 +1,106 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_date, expires_date) VALUES (?, ?, ?, ?, ?, ?)")).
+		WithArgs(1, "Notebook", sqlmock.AnyArg(), "read,export", sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	token, value, err := CreateAPIToken(db, 1, " Notebook ", []string{ScopeRead, ScopeExport}, nil)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating token", err)
+	}
+
+	assert.Equal(t, int64(3), token.ID)
+	assert.True(t, strings.HasPrefix(value, APITokenPrefix))
+	assert.True(t, token.HasScope(ScopeExport))
+	assert.False(t, token.HasScope(ScopeUpload))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateAPITokenInvalidScope(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, _, err = CreateAPIToken(db, 1, "Script", []string{"write"}, nil)
+	assert.NotNil(t, err)
+
+	_, _, err = CreateAPIToken(db, 1, "Script", []string{}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestFindAPIToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, name, scopes, created_date, expires_date, last_used_date FROM api_tokens WHERE token_hash = ?")).
+		WithArgs(hashToken("sbt_token")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "scopes", "created_date", "expires_date", "last_used_date"}).
+			AddRow(3, 1, "Script", "upload", time.Now(), time.Now().Add(time.Hour), nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_tokens SET last_used_date = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	token, err := FindAPIToken(db, "sbt_token")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s finding token", err)
+	}
+
+	assert.Equal(t, int64(1), token.UserID)
+	assert.Equal(t, []string{ScopeUpload}, token.Scopes)
+	assert.NotNil(t, token.LastUsedDate)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindAPITokenExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, name, scopes, created_date, expires_date, last_used_date FROM api_tokens WHERE token_hash = ?")).
+		WithArgs(hashToken("sbt_token")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "scopes", "created_date", "expires_date", "last_used_date"}).
+			AddRow(3, 1, "Script", "upload", time.Now(), time.Now().Add(-time.Hour), nil))
+
+	_, err = FindAPIToken(db, "sbt_token")
+	assert.Equal(t, ErrInvalidAPIToken, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type BasketItem struct {
+	ProductID int64   `json:"product_id"`
+	Product   string  `json:"product"`
+	Quantity  float64 `json:"quantity"`
+}
+
+type StorePrice struct {
+	ProductID int64     `json:"product_id"`
+	Product   string    `json:"product"`
+	Quantity  float64   `json:"quantity"`
+	UnitPrice float64   `json:"unit_price"`
+	Cost      float64   `json:"cost"`
+	Date      time.Time `json:"date"`
+}
+
+type StoreBasket struct {
+	Supermarket string       `json:"supermarket"`
+	Total       float64      `json:"total"`
+	Complete    bool         `json:"complete"`
+	Items       []StorePrice `json:"items"`
+	Missing     []BasketItem `json:"missing"`
+	OldestPrice time.Time    `json:"oldest_price"`
+	NewestPrice time.Time    `json:"newest_price"`
+	AgeDays     int          `json:"age_days"`
+}
+
+// Return products bought in more receipts since given date, with average quantity bought each time
+func FindUsualBasketForUser(db *sql.DB, user *User, since time.Time, size int64) ([]BasketItem, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT products.id, products.name, SUM(receipt_items.quantity) / COUNT(DISTINCT receipts.id) FROM receipt_items
+		INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+		INNER JOIN products ON products.id = receipt_items.product_id
+		WHERE `+receiptReadAccess+` AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND DATE(receipts.receipt_date) >= DATE(?)
+		GROUP BY products.id ORDER BY COUNT(DISTINCT receipts.id) DESC, products.name LIMIT %d`, size), user.ID, since.Format(time.RFC3339))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []BasketItem{}
+
+	for rows.Next() {
+		item := BasketItem{}
+		if err := rows.Scan(&item.ProductID, &item.Product, &item.Quantity); err != nil {
+			return nil, err
+		}
+
+		if item.Quantity <= 0 {
+			item.Quantity = 1
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Return cost of given basket in every supermarket using the latest price known for each product
+// Stores with every product come first, sorted by total cost
+func CompareBasketForUser(db *sql.DB, user *User, basket []BasketItem) (*[]StoreBasket, error) {
+	stores := []StoreBasket{}
+
+	if len(basket) == 0 {
+		return &stores, nil
+	}
+
+	var parameters []interface{}
+	parameters = append(parameters, user.ID)
+
+	placeholders := []string{}
+	for _, item := range basket {
+		placeholders = append(placeholders, "?")
+		parameters = append(parameters, item.ProductID)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT receipts.supermarket, receipt_items.product_id, products.name, receipts.receipt_date, receipt_items.quantity, receipt_items.unit_price, receipt_items.price
+		FROM receipt_items
+		INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+		INNER JOIN products ON products.id = receipt_items.product_id
+		WHERE `+receiptReadAccess+` AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND receipt_items.product_id IN (%s)
+		ORDER BY receipts.receipt_date DESC, receipt_items.id DESC`, strings.Join(placeholders, ", ")), parameters...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// Latest price for each supermarket and product, rows are sorted newest first
+	latest := map[string]map[int64]StorePrice{}
+	names := map[int64]string{}
+	supermarkets := []string{}
+
+	for rows.Next() {
+		var supermarket string
+		var date time.Time
+		item := ReceiptItem{}
+
+		if err := rows.Scan(&supermarket, &item.ProductID, &item.Name, &date, &item.Quantity, &item.UnitPrice, &item.Price); err != nil {
+			return nil, err
+		}
+
+		names[item.ProductID] = item.Name
+
+		if _, ok := latest[supermarket]; !ok {
+			latest[supermarket] = map[int64]StorePrice{}
+			supermarkets = append(supermarkets, supermarket)
+		}
+
+		if _, ok := latest[supermarket][item.ProductID]; ok {
+			continue
+		}
+
+		latest[supermarket][item.ProductID] = StorePrice{ProductID: item.ProductID, Product: item.Name, UnitPrice: item.EffectiveUnitPrice(), Date: date}
+	}
+
+	now := time.Now()
+
+	for _, supermarket := range supermarkets {
+		store := StoreBasket{Supermarket: supermarket, Items: []StorePrice{}, Missing: []BasketItem{}}
+
+		for _, item := range basket {
+			price, ok := latest[supermarket][item.ProductID]
+			if !ok {
+				if len(item.Product) == 0 {
+					item.Product = names[item.ProductID]
+				}
+				store.Missing = append(store.Missing, item)
+				continue
+			}
+
+			price.Quantity = item.Quantity
+			price.Cost = round2(price.UnitPrice * item.Quantity)
+			store.Total += price.Cost
+			store.Items = append(store.Items, price)
+
+			if store.OldestPrice.IsZero() || price.Date.Before(store.OldestPrice) {
+				store.OldestPrice = price.Date
+			}
+
+			if price.Date.After(store.NewestPrice) {
+				store.NewestPrice = price.Date
+			}
+		}
+
+		store.Total = round2(store.Total)
+		store.Complete = len(store.Missing) == 0
+		store.AgeDays = int(math.Floor(now.Sub(store.OldestPrice).Hours() / 24))
+
+		stores = append(stores, store)
+	}
+
+	sort.SliceStable(stores, func(i, j int) bool {
+		if stores[i].Complete != stores[j].Complete {
+			return stores[i].Complete
+		}
+
+		if len(stores[i].Missing) != len(stores[j].Missing) {
+			return len(stores[i].Missing) < len(stores[j].Missing)
+		}
+
+		return stores[i].Total < stores[j].Total
+	})
+
+	return &stores, nil
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindUsualBasketForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	since := time.Now().AddDate(0, -3, 0)
+
+	mock.ExpectQuery(regexp.QuoteMeta("GROUP BY products.id ORDER BY COUNT(DISTINCT receipts.id) DESC, products.name LIMIT 2")).
+		WithArgs(1, since.Format(time.RFC3339)).
+		WillReturnRows(mock.NewRows([]string{"id", "name", "quantity"}).
+			AddRow(1, "LECHE", 6.0).
+			AddRow(2, "PAN", 0.0))
+
+	basket, err := FindUsualBasketForUser(db, &user, since, 2)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting usual basket", err)
+	}
+
+	assert.Equal(t, 2, len(basket))
+	assert.Equal(t, 6.0, basket[0].Quantity)
+	assert.Equal(t, 1.0, basket[1].Quantity, "Quantity should be at least 1")
+}
+
+func TestCompareBasketForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	ts := time.Now()
+	old_ts := ts.AddDate(0, 0, -10)
+
+	rows := mock.NewRows([]string{"supermarket", "product_id", "name", "receipt_date", "quantity", "unit_price", "price"}).
+		AddRow("Expensive", 1, "LECHE", ts, 1, 1.5, 1.5).
+		AddRow("Cheap", 1, "LECHE", ts, 2, 0, 2.0).
+		AddRow("Cheap", 2, "PAN", old_ts, 1, 0.8, 0.8).
+		AddRow("Cheap", 1, "LECHE", old_ts, 1, 0.5, 0.5).
+		AddRow("Incomplete", 2, "PAN", ts, 1, 0.1, 0.1).
+		AddRow("Expensive", 2, "PAN", old_ts, 1, 1.0, 1.0)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND receipt_items.product_id IN (?, ?)")).
+		WithArgs(1, 1, 2).
+		WillReturnRows(rows)
+
+	basket := []BasketItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 1}}
+	stores, err := CompareBasketForUser(db, &user, basket)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s comparing basket", err)
+	}
+
+	assert.Equal(t, 3, len(*stores))
+
+	cheap := (*stores)[0]
+	assert.Equal(t, "Cheap", cheap.Supermarket)
+	assert.Equal(t, 2.8, cheap.Total, "Latest price should be used")
+	assert.True(t, cheap.Complete)
+	assert.Equal(t, 10, cheap.AgeDays)
+
+	assert.Equal(t, "Expensive", (*stores)[1].Supermarket)
+	assert.Equal(t, 4.0, (*stores)[1].Total)
+
+	incomplete := (*stores)[2]
+	assert.False(t, incomplete.Complete)
+	assert.Equal(t, "LECHE", incomplete.Missing[0].Product)
+}
+
+func TestCompareEmptyBasket(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	stores, err := CompareBasketForUser(db, &User{ID: 1}, []BasketItem{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s comparing basket", err)
+	}
+
+	assert.Equal(t, 0, len(*stores))
+}
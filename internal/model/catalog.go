@@ -0,0 +1,225 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Store chain, whose name is used for receipts of supermarkets matching its pattern
+// Pattern is matched in any part of supermarket name without case, like "mercadona" for "MERCADONA S.A."
+type StoreChain struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// Category which can be set to products
+type Category struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Return name of store chain matching supermarket, or supermarket if none matches
+// Longest patterns are checked first, as they are more specific
+func FindStoreChainName(db queryer, supermarket string) (string, error) {
+	var name string
+	err := db.QueryRow("SELECT name FROM store_chains WHERE ? LIKE '%' || pattern || '%' ORDER BY LENGTH(pattern) DESC LIMIT 1", strings.ToLower(supermarket)).Scan(&name)
+	if err == sql.ErrNoRows {
+		return supermarket, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func FindAllStoreChains(db *sql.DB) (*[]StoreChain, error) {
+	rows, err := db.Query("SELECT id, name, pattern FROM store_chains ORDER BY name, pattern")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	chains := []StoreChain{}
+
+	for rows.Next() {
+		chain := StoreChain{}
+		if err := rows.Scan(&chain.ID, &chain.Name, &chain.Pattern); err != nil {
+			return nil, err
+		}
+
+		chains = append(chains, chain)
+	}
+
+	return &chains, rows.Err()
+}
+
+// Create a store chain and rename receipts already stored whose supermarket matches its pattern
+// Return number of receipts renamed
+func CreateStoreChain(db *sql.DB, chain *StoreChain) (int64, error) {
+	chain.Name = strings.TrimSpace(chain.Name)
+	chain.Pattern = strings.ToLower(strings.TrimSpace(chain.Pattern))
+
+	if len(chain.Name) == 0 || len(chain.Pattern) == 0 {
+		return 0, errors.New("Store chain name and pattern can not be empty")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO store_chains (name, pattern) VALUES (?, ?)", chain.Name, chain.Pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	chain.ID, err = res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err = tx.Exec("UPDATE receipts SET supermarket = ? WHERE LOWER(supermarket) LIKE ? AND supermarket <> ?", chain.Name, "%"+chain.Pattern+"%", chain.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	renamed, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return renamed, tx.Commit()
+}
+
+// Delete a store chain, receipts already renamed keep its name
+func DeleteStoreChain(db *sql.DB, chain_id int64) error {
+	res, err := db.Exec("DELETE FROM store_chains WHERE id = ?", chain_id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func FindAllCategories(db *sql.DB) (*[]Category, error) {
+	rows, err := db.Query("SELECT id, name FROM categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	categories := []Category{}
+
+	for rows.Next() {
+		category := Category{}
+		if err := rows.Scan(&category.ID, &category.Name); err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, category)
+	}
+
+	return &categories, rows.Err()
+}
+
+func CreateCategory(db *sql.DB, category *Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if len(category.Name) == 0 {
+		return errors.New("Category name can not be empty")
+	}
+
+	res, err := db.Exec("INSERT INTO categories (name) VALUES (?)", category.Name)
+	if err != nil {
+		return err
+	}
+
+	category.ID, err = res.LastInsertId()
+	return err
+}
+
+// Rename a category, and products with its name
+func RenameCategory(db *sql.DB, category_id int64, name string) error {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return errors.New("Category name can not be empty")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow("SELECT name FROM categories WHERE id = ?", category_id).Scan(&current); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE categories SET name = ? WHERE id = ?", name, category_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE products SET category = ? WHERE category = ?", name, current); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete a category, products with its name are left without category
+func DeleteCategory(db *sql.DB, category_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var name string
+	if err := tx.QueryRow("SELECT name FROM categories WHERE id = ?", category_id).Scan(&name); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM categories WHERE id = ?", category_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE products SET category = NULL WHERE category = ?", name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Check category can be set to products, any category is allowed until categories are created
+// Empty category removes category of products, so it is always allowed
+func CheckCategory(db *sql.DB, name string) error {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return nil
+	}
+
+	var count, matching int64
+	if err := db.QueryRow("SELECT COUNT(*), COUNT(CASE WHEN name = ? THEN 1 END) FROM categories", name).Scan(&count, &matching); err != nil {
+		return err
+	}
+
+	if count > 0 && matching == 0 {
+		return errors.New("Unknown category " + name)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindStoreChainName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs("mercadona s.a. c/ mayor").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Mercadona"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs("corner shop").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	name, err := FindStoreChainName(db, "MERCADONA S.A. C/ Mayor")
+	assert.Nil(t, err)
+	assert.Equal(t, "Mercadona", name)
+
+	name, err = FindStoreChainName(db, "Corner shop")
+	assert.Nil(t, err)
+	assert.Equal(t, "Corner shop", name)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateStoreChain(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO store_chains (name, pattern) VALUES (?, ?)")).
+		WithArgs("Mercadona", "mercadona").
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET supermarket = ? WHERE LOWER(supermarket) LIKE ? AND supermarket <> ?")).
+		WithArgs("Mercadona", "%mercadona%", "Mercadona").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+
+	chain := StoreChain{Name: " Mercadona ", Pattern: "MERCADONA"}
+	renamed, err := CreateStoreChain(db, &chain)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating store chain", err)
+	}
+
+	assert.Equal(t, int64(3), chain.ID)
+	assert.Equal(t, int64(5), renamed)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRenameCategory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM categories WHERE id = ?")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Fruit"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE categories SET name = ? WHERE id = ?")).
+		WithArgs("Fruit and vegetables", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET category = ? WHERE category = ?")).
+		WithArgs("Fruit and vegetables", "Fruit").
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+
+	assert.Nil(t, RenameCategory(db, 2, "Fruit and vegetables"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCheckCategory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	query := regexp.QuoteMeta("SELECT COUNT(*), COUNT(CASE WHEN name = ? THEN 1 END) FROM categories")
+
+	// Any category is allowed until categories are created
+	mock.ExpectQuery(query).WithArgs("Snacks").WillReturnRows(sqlmock.NewRows([]string{"count", "matching"}).AddRow(0, 0))
+	mock.ExpectQuery(query).WithArgs("Snacks").WillReturnRows(sqlmock.NewRows([]string{"count", "matching"}).AddRow(3, 0))
+	mock.ExpectQuery(query).WithArgs("Fruit").WillReturnRows(sqlmock.NewRows([]string{"count", "matching"}).AddRow(3, 1))
+
+	assert.Nil(t, CheckCategory(db, "Snacks"))
+	assert.NotNil(t, CheckCategory(db, "Snacks"))
+	assert.Nil(t, CheckCategory(db, "Fruit"))
+	assert.Nil(t, CheckCategory(db, ""))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Receipt item with the receipt it belongs to, as exported to files
+type ExportRow struct {
+	ReceiptID   int64     `json:"receipt_id"`
+	Supermarket string    `json:"supermarket"`
+	Date        time.Time `json:"date"`
+	Currency    string    `json:"currency"`
+	Total       float64   `json:"total"`
+	Source      string    `json:"source"`
+	ItemID      int64     `json:"item_id"`
+	Name        string    `json:"name"`
+	Product     string    `json:"product"`
+	Category    string    `json:"category"`
+	Quantity    float64   `json:"quantity"`
+	UnitPrice   float64   `json:"unit_price"`
+	Price       float64   `json:"price"`
+}
+
+// Call given function for every item of receipts owned by user, filtered like receipts list
+// Rows are read one by one, so large histories are not loaded into memory
+func ExportReceiptItemsForUser(db *sql.DB, user *User, filters *ReceiptFilter, fn func(row *ExportRow) error) error {
+	var parameters []interface{}
+	parameters = append(parameters, user.ID)
+
+	conditions := []string{receiptReadAccess, "receipts.deleted_at IS NULL", "receipt_items.deleted_at IS NULL"}
+
+	if filters != nil {
+		// Item, keeping every item from receipts which include it
+		if len(filters.Item) > 0 {
+			conditions = append(conditions, "receipts.id IN (SELECT receipt_id FROM receipt_items WHERE name LIKE ? AND deleted_at IS NULL)")
+			parameters = append(parameters, fmt.Sprintf("%%%s%%", filters.Item))
+		}
+
+		filter_conditions, filter_parameters, err := receiptFilterConditions(filters)
+		if err != nil {
+			return err
+		}
+
+		conditions = append(conditions, filter_conditions...)
+		parameters = append(parameters, filter_parameters...)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT receipts.id, receipts.supermarket, receipts.receipt_date, receipts.currency, receipts.total, receipts.source,
+		receipt_items.id, receipt_items.name, products.name, products.category, receipt_items.quantity, receipt_items.unit_price, receipt_items.price
+		FROM receipt_items
+		INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+		LEFT JOIN products ON products.id = receipt_items.product_id
+		WHERE %s ORDER BY receipts.receipt_date, receipts.id, receipt_items.id`, strings.Join(conditions, " AND ")), parameters...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		row := ExportRow{}
+		var currency, source, product, category sql.NullString
+
+		if err := rows.Scan(&row.ReceiptID, &row.Supermarket, &row.Date, &currency, &row.Total, &source,
+			&row.ItemID, &row.Name, &product, &category, &row.Quantity, &row.UnitPrice, &row.Price); err != nil {
+			return err
+		}
+
+		row.Currency = currency.String
+		row.Source = source.String
+		row.Product = product.String
+		row.Category = category.String
+
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
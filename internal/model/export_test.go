@@ -0,0 +1,44 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportReceiptItemsForUserWithFilters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND receipts.id IN (SELECT receipt_id FROM receipt_items WHERE name LIKE ? AND deleted_at IS NULL) AND supermarket like ? ORDER BY receipts.receipt_date, receipts.id, receipt_items.id")).
+		WithArgs(1, "%Leche%", "%Any%").
+		WillReturnRows(sqlmock.NewRows([]string{"receipt_id", "supermarket", "receipt_date", "currency", "total", "source", "item_id", "name", "product", "category", "quantity", "unit_price", "price"}).
+			AddRow(1, "Any", ts, nil, 3.5, nil, 1, "Leche", "LECHE", nil, 2, 1.0, 2.0))
+
+	rows := []ExportRow{}
+	err = ExportReceiptItemsForUser(db, &User{ID: 1}, &ReceiptFilter{Supermarket: "Any", Item: "Leche"}, func(row *ExportRow) error {
+		rows = append(rows, *row)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s exporting items", err)
+	}
+
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "LECHE", rows[0].Product)
+	assert.Equal(t, "", rows[0].Currency)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
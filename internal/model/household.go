@@ -0,0 +1,317 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Roles of household members
+const (
+	// Manages members and receipts
+	RoleOwner = "owner"
+
+	// Creates and edits receipts
+	RoleMember = "member"
+
+	// Only reads receipts and stats
+	RoleViewer = "viewer"
+)
+
+// Receipts a user can read: their own personal receipts and receipts of households they belong to
+// Receipts created in a household are only reached through membership, so removed members lose access to them
+// Condition has a single parameter for user id, and can be used where receipts table is in the query
+const receiptReadAccess = "? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)"
+
+// Receipts a user can change: their own personal receipts and receipts of households where they are owner or member
+const receiptWriteAccess = "? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member'))"
+
+var (
+	ErrInvalidRole        = errors.New("Invalid role, must be owner, member or viewer")
+	ErrHouseholdForbidden = errors.New("Household role does not allow this action")
+	ErrLastOwner          = errors.New("Household must have at least one owner")
+)
+
+// Group of users sharing receipts
+type Household struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	Role        string            `json:"role"`
+	CreatedDate time.Time         `json:"created_date"`
+	Members     []HouseholdMember `json:"members,omitempty"`
+}
+
+type HouseholdMember struct {
+	UserID     int64     `json:"user_id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	JoinedDate time.Time `json:"joined_date"`
+}
+
+func validRole(role string) bool {
+	return role == RoleOwner || role == RoleMember || role == RoleViewer
+}
+
+// Create a household with given user as owner
+func CreateHousehold(db *sql.DB, name string, user_id int64) (*Household, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return nil, errors.New("Household name can not be empty")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	household := Household{Name: name, Role: RoleOwner, CreatedDate: time.Now()}
+
+	res, err := tx.Exec("INSERT INTO households (name, created_date) VALUES (?, ?)", household.Name, household.CreatedDate)
+	if err != nil {
+		return nil, err
+	}
+
+	household.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("INSERT INTO household_members (household_id, user_id, role, joined_date) VALUES (?, ?, ?, ?)", household.ID, user_id, RoleOwner, household.CreatedDate); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &household, nil
+}
+
+// Return households given user belongs to, with the role of the user
+func FindHouseholdsForUser(db *sql.DB, user_id int64) (*[]Household, error) {
+	rows, err := db.Query(`SELECT households.id, households.name, households.created_date, household_members.role FROM households
+		INNER JOIN household_members ON household_members.household_id = households.id
+		WHERE household_members.user_id = ? ORDER BY households.name`, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	households := []Household{}
+
+	for rows.Next() {
+		household := Household{}
+		if err := rows.Scan(&household.ID, &household.Name, &household.CreatedDate, &household.Role); err != nil {
+			return nil, err
+		}
+
+		households = append(households, household)
+	}
+
+	return &households, rows.Err()
+}
+
+// Return role of user in household, or sql.ErrNoRows if user is not a member
+func FindHouseholdRole(db queryer, household_id int64, user_id int64) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?", household_id, user_id).Scan(&role)
+	return role, err
+}
+
+// Check user can create and edit receipts in household, returning sql.ErrNoRows if user is not a member
+func CheckHouseholdWriteAccess(db queryer, household_id int64, user_id int64) error {
+	role, err := FindHouseholdRole(db, household_id, user_id)
+	if err != nil {
+		return err
+	}
+
+	if role == RoleViewer {
+		return ErrHouseholdForbidden
+	}
+
+	return nil
+}
+
+// Return household with its members if given user belongs to it, or sql.ErrNoRows if not
+func FindHouseholdForUser(db *sql.DB, household_id int64, user_id int64) (*Household, error) {
+	household := Household{}
+
+	err := db.QueryRow(`SELECT households.id, households.name, households.created_date, household_members.role FROM households
+		INNER JOIN household_members ON household_members.household_id = households.id
+		WHERE households.id = ? AND household_members.user_id = ?`, household_id, user_id).
+		Scan(&household.ID, &household.Name, &household.CreatedDate, &household.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT users.id, users.name, users.email, household_members.role, household_members.joined_date FROM household_members
+		INNER JOIN users ON users.id = household_members.user_id
+		WHERE household_members.household_id = ? ORDER BY household_members.joined_date, users.id`, household_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		member := HouseholdMember{}
+		var name, email sql.NullString
+		if err := rows.Scan(&member.UserID, &name, &email, &member.Role, &member.JoinedDate); err != nil {
+			return nil, err
+		}
+
+		member.Name = name.String
+		member.Email = email.String
+		household.Members = append(household.Members, member)
+	}
+
+	return &household, rows.Err()
+}
+
+// Check user is owner of household, returning sql.ErrNoRows if user is not a member
+func checkHouseholdOwner(db queryer, household_id int64, user_id int64) error {
+	role, err := FindHouseholdRole(db, household_id, user_id)
+	if err != nil {
+		return err
+	}
+
+	if role != RoleOwner {
+		return ErrHouseholdForbidden
+	}
+
+	return nil
+}
+
+// Check household keeps an owner if given member stops being owner
+func checkOtherOwners(db queryer, household_id int64, member_id int64) error {
+	var owners int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM household_members WHERE household_id = ? AND user_id <> ? AND role = ?", household_id, member_id, RoleOwner).Scan(&owners); err != nil {
+		return err
+	}
+
+	if owners == 0 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+// Add user with given email to household, only owners can add members
+func AddHouseholdMember(db *sql.DB, household_id int64, user_id int64, email string, role string) (*HouseholdMember, error) {
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	if err := checkHouseholdOwner(db, household_id, user_id); err != nil {
+		return nil, err
+	}
+
+	member := HouseholdMember{Role: role, JoinedDate: time.Now()}
+	var name sql.NullString
+
+	err := db.QueryRow("SELECT id, name, email FROM users WHERE LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).Scan(&member.UserID, &name, &member.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("User not found for email")
+		}
+		return nil, err
+	}
+
+	member.Name = name.String
+
+	if _, err := FindHouseholdRole(db, household_id, member.UserID); err == nil {
+		return nil, errors.New("User is already a member of household")
+	}
+
+	if _, err := db.Exec("INSERT INTO household_members (household_id, user_id, role, joined_date) VALUES (?, ?, ?, ?)", household_id, member.UserID, member.Role, member.JoinedDate); err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// Change role of a member, only owners can change roles
+func UpdateHouseholdMember(db *sql.DB, household_id int64, user_id int64, member_id int64, role string) error {
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+
+	if err := checkHouseholdOwner(db, household_id, user_id); err != nil {
+		return err
+	}
+
+	if role != RoleOwner {
+		if err := checkOtherOwners(db, household_id, member_id); err != nil {
+			return err
+		}
+	}
+
+	res, err := db.Exec("UPDATE household_members SET role = ? WHERE household_id = ? AND user_id = ?", role, household_id, member_id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Remove a member from household, owners can remove anyone and members can leave
+// Receipts created by the member are kept in household, and member can not read nor change them anymore
+func RemoveHouseholdMember(db *sql.DB, household_id int64, user_id int64, member_id int64) error {
+	if member_id != user_id {
+		if err := checkHouseholdOwner(db, household_id, user_id); err != nil {
+			return err
+		}
+	}
+
+	role, err := FindHouseholdRole(db, household_id, member_id)
+	if err != nil {
+		return err
+	}
+
+	if role == RoleOwner {
+		if err := checkOtherOwners(db, household_id, member_id); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec("DELETE FROM household_members WHERE household_id = ? AND user_id = ?", household_id, member_id)
+	return err
+}
+
+// Delete household, only owners can delete it
+// Receipts of the household are kept as personal receipts of users who created them
+func DeleteHousehold(db *sql.DB, household_id int64, user_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := checkHouseholdOwner(tx, household_id, user_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE receipts SET household_id = NULL WHERE household_id = ?", household_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM household_members WHERE household_id = ?", household_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM households WHERE id = ?", household_id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHousehold(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO households (name, created_date) VALUES (?, ?)")).
+		WithArgs("Home", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO household_members (household_id, user_id, role, joined_date) VALUES (?, ?, ?, ?)")).
+		WithArgs(2, 1, RoleOwner, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	household, err := CreateHousehold(db, " Home ", 1)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating household", err)
+	}
+
+	assert.Equal(t, int64(2), household.ID)
+	assert.Equal(t, "Home", household.Name)
+	assert.Equal(t, RoleOwner, household.Role)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateHouseholdEmptyName(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = CreateHousehold(db, " ", 1)
+	assert.NotNil(t, err)
+}
+
+func TestCheckHouseholdWriteAccessViewer(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(RoleViewer))
+
+	assert.Equal(t, ErrHouseholdForbidden, CheckHouseholdWriteAccess(db, 2, 3))
+}
+
+func TestAddHouseholdMember(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(RoleOwner))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, email FROM users WHERE LOWER(email) = ?")).
+		WithArgs("jane@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(3, "Jane", "Jane@example.com"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO household_members (household_id, user_id, role, joined_date) VALUES (?, ?, ?, ?)")).
+		WithArgs(2, 3, RoleViewer, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	member, err := AddHouseholdMember(db, 2, 1, " Jane@example.com", RoleViewer)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s adding member", err)
+	}
+
+	assert.Equal(t, int64(3), member.UserID)
+	assert.Equal(t, "Jane", member.Name)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddHouseholdMemberNotOwner(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(RoleMember))
+
+	_, err = AddHouseholdMember(db, 2, 1, "jane@example.com", RoleMember)
+	assert.Equal(t, ErrHouseholdForbidden, err)
+}
+
+func TestAddHouseholdMemberInvalidRole(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = AddHouseholdMember(db, 2, 1, "jane@example.com", "admin")
+	assert.Equal(t, ErrInvalidRole, err)
+}
+
+func TestUpdateHouseholdMemberLastOwner(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(RoleOwner))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM household_members WHERE household_id = ? AND user_id <> ? AND role = ?")).
+		WithArgs(2, 1, RoleOwner).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	err = UpdateHouseholdMember(db, 2, 1, 1, RoleMember)
+	assert.Equal(t, ErrLastOwner, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRemoveHouseholdMemberLeave(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(RoleMember))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := RemoveHouseholdMember(db, 2, 3, 3); err != nil {
+		t.Fatalf("Unexpected error %s removing member", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteHousehold(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(RoleOwner))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET household_id = NULL WHERE household_id = ?")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM household_members WHERE household_id = ?")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM households WHERE id = ?")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := DeleteHousehold(db, 2, 1); err != nil {
+		t.Fatalf("Unexpected error %s deleting household", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"fmt"
+)
+
+// Issuer of Google ID tokens, used to link users who log in with Google
+const GoogleIssuer = "https://accounts.google.com"
+
+// Link user with subject of an OpenID Connect issuer
+func CreateUserIdentity(db queryer, user_id int64, issuer string, subject string) error {
+	_, err := db.Exec("INSERT INTO user_identities (user_id, issuer, subject) VALUES (?, ?, ?)", user_id, issuer, subject)
+	return err
+}
+
+// Return user linked with given issuer and subject, or sql.ErrNoRows if there is none
+func FindUserByIdentity(db queryer, issuer string, subject string) (*User, error) {
+	return scanUser(db.QueryRow(fmt.Sprintf("SELECT %s FROM users WHERE id = (SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?)", userColumns), issuer, subject))
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Single use code to register a new user
+type Invite struct {
+	ID          int64      `json:"id"`
+	Code        string     `json:"code"`
+	CreatedBy   int64      `json:"created_by"`
+	CreatedDate time.Time  `json:"created_date"`
+	UsedBy      *int64     `json:"used_by,omitempty"`
+	UsedDate    *time.Time `json:"used_date,omitempty"`
+}
+
+// Error returned when an invite code does not exist or was already used
+var ErrInvalidInvite = errors.New("Invalid invite code")
+
+// Return a random code, easy to type
+func newInviteCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// Create a new invite code by given user
+func CreateInvite(db *sql.DB, created_by int64) (*Invite, error) {
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	invite := Invite{Code: code, CreatedBy: created_by, CreatedDate: time.Now()}
+
+	res, err := db.Exec("INSERT INTO invites (code, created_by, created_date) VALUES (?, ?, ?)", invite.Code, invite.CreatedBy, invite.CreatedDate)
+	if err != nil {
+		return nil, err
+	}
+
+	invite.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// Return every invite, newest first
+func FindAllInvites(db *sql.DB) ([]Invite, error) {
+	rows, err := db.Query("SELECT id, code, created_by, created_date, used_by, used_date FROM invites ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []Invite{}
+
+	for rows.Next() {
+		invite := Invite{}
+		var used_by sql.NullInt64
+		var used_date sql.NullTime
+
+		if err := rows.Scan(&invite.ID, &invite.Code, &invite.CreatedBy, &invite.CreatedDate, &used_by, &used_date); err != nil {
+			return nil, err
+		}
+
+		if used_by.Valid {
+			invite.UsedBy = &used_by.Int64
+		}
+
+		if used_date.Valid {
+			invite.UsedDate = &used_date.Time
+		}
+
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+// Delete an invite not used yet, returning sql.ErrNoRows if there is no such invite
+func DeleteInvite(db *sql.DB, invite_id int64) error {
+	res, err := db.Exec("DELETE FROM invites WHERE id = ? AND used_by IS NULL", invite_id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Mark invite code as used by given user, so it can not be used again
+func UseInvite(db queryer, code string, user_id int64) error {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	res, err := db.Exec("UPDATE invites SET used_by = ?, used_date = ? WHERE code = ? AND used_by IS NULL", user_id, time.Now(), code)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrInvalidInvite
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateInvite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO invites (code, created_by, created_date) VALUES (?, ?, ?)")).
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	invite, err := CreateInvite(db, 1)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating invite", err)
+	}
+
+	assert.Equal(t, int64(3), invite.ID)
+	assert.Equal(t, 16, len(invite.Code))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindAllInvites(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, code, created_by, created_date, used_by, used_date FROM invites ORDER BY id DESC")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "created_by", "created_date", "used_by", "used_date"}).
+			AddRow(2, "CODE2", 1, ts, nil, nil).
+			AddRow(1, "CODE1", 1, ts, 5, ts))
+
+	invites, err := FindAllInvites(db)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting invites", err)
+	}
+
+	assert.Equal(t, 2, len(invites))
+	assert.Nil(t, invites[0].UsedBy)
+	assert.Equal(t, int64(5), *invites[1].UsedBy)
+	assert.Equal(t, ts, *invites[1].UsedDate)
+}
+
+func TestDeleteInviteNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM invites WHERE id = ? AND used_by IS NULL")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, sql.ErrNoRows, DeleteInvite(db, 1))
+}
+
+func TestUseInvite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE invites SET used_by = ?, used_date = ? WHERE code = ? AND used_by IS NULL")).
+		WithArgs(2, sqlmock.AnyArg(), "ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE invites SET used_by = ?, used_date = ? WHERE code = ? AND used_by IS NULL")).
+		WithArgs(3, sqlmock.AnyArg(), "ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, UseInvite(db, " abcd ", 2))
+	assert.Equal(t, ErrInvalidInvite, UseInvite(db, "ABCD", 3))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -19,18 +19,32 @@ type ReceiptItem struct {
 	Quantity  float64 `db:"quantity"`
 	Price     float64 `db:"price"`
 	UnitPrice float64 `db:"unit_price"`
+	ProductID int64   `db:"product_id"`
 }
 
 type Receipt struct {
 	ID          int64     `db:"id"`
 	UserID      int64     `db:"user_id"`
+	HouseholdID int64     `db:"household_id"`
 	Supermarket string    `db:"supermarket"`
 	Date        time.Time `db:"receipt_date"`
 	Total       float64   `db:"total"`
 	Currency    string    `db:"currency"`
+	Source      string    `db:"source"`
 	Items       []ReceiptItem
 }
 
+// Sources a receipt can be created from
+const (
+	SourceScan   = "scan"
+	SourceManual = "manual"
+	SourceImport = "import"
+	SourceEmail  = "email"
+)
+
+// Returned when creating a receipt with the same supermarket, date and total than other receipt of the user
+var ErrReceiptExists = errors.New("Receipt already exists")
+
 type ReceiptFilter struct {
 	Supermarket string
 	Page        int64
@@ -38,11 +52,21 @@ type ReceiptFilter struct {
 	MinDate     *time.Time
 	MaxDate     *time.Time
 	Item        string
+	HouseholdID int64
+	MemberID    int64
 }
 
 type User struct {
-	ID        int64  `db:"id"`
-	GoogleUID string `db:"google_uid"`
+	ID         int64      `db:"id" json:"id"`
+	GoogleUID  string     `db:"google_uid" json:"-"`
+	Email      string     `db:"email" json:"email"`
+	Name       string     `db:"name" json:"name"`
+	PictureURL string     `db:"picture_url" json:"picture_url"`
+	Locale     string     `db:"locale" json:"locale"`
+	Currency   string     `db:"currency" json:"currency"`
+	Timezone   string     `db:"timezone" json:"timezone"`
+	Role       string     `db:"role" json:"role"`
+	DisabledAt *time.Time `db:"disabled_at" json:"disabled_at,omitempty"`
 }
 
 func NewDB() (*sql.DB, error) {
@@ -88,43 +112,298 @@ func InitDB(db *sql.DB) error {
 		quantity float,
 		price decimal(6, 2),
 		unit_price decimal(6, 2)
+	);
+
+	CREATE TABLE IF NOT EXISTS products (
+		id INTEGER NOT NULL PRIMARY KEY,
+		name varchar(255) UNIQUE
+	);
+
+	CREATE TABLE IF NOT EXISTS price_changes (
+		id INTEGER NOT NULL PRIMARY KEY,
+		user_id int,
+		product_id int,
+		receipt_id int,
+		receipt_item_id int,
+		supermarket varchar(255),
+		previous_price decimal(6, 2),
+		price decimal(6, 2),
+		change_percent float,
+		previous_date date,
+		change_date date
+	);
+
+	CREATE TABLE IF NOT EXISTS receipt_changes (
+		id INTEGER NOT NULL PRIMARY KEY,
+		receipt_id int,
+		receipt_item_id int,
+		user_id int,
+		action varchar(16),
+		field varchar(32),
+		old_value varchar(255),
+		new_value varchar(255),
+		change_date datetime
+	);
+
+	CREATE TABLE IF NOT EXISTS invites (
+		id INTEGER NOT NULL PRIMARY KEY,
+		code varchar(64) UNIQUE,
+		created_by int,
+		created_date datetime,
+		used_by int,
+		used_date datetime
+	);
+
+	CREATE TABLE IF NOT EXISTS households (
+		id INTEGER NOT NULL PRIMARY KEY,
+		name varchar(255),
+		created_date datetime
+	);
+
+	CREATE TABLE IF NOT EXISTS household_members (
+		household_id int,
+		user_id int,
+		role varchar(16),
+		joined_date datetime,
+		UNIQUE(household_id, user_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id INTEGER NOT NULL PRIMARY KEY,
+		user_id int,
+		issuer varchar(255),
+		subject varchar(255),
+		UNIQUE(issuer, subject)
+	);
+
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER NOT NULL PRIMARY KEY,
+		user_id int,
+		token_hash varchar(64) UNIQUE,
+		previous_token_hash varchar(64),
+		user_agent varchar(255),
+		ip varchar(64),
+		created_date datetime,
+		last_used_date datetime,
+		expires_date datetime,
+		revoked_at datetime
+	);
+
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER NOT NULL PRIMARY KEY,
+		user_id int,
+		name varchar(255),
+		token_hash varchar(64) UNIQUE,
+		scopes varchar(255),
+		created_date datetime,
+		expires_date datetime,
+		last_used_date datetime
+	);
+
+	CREATE TABLE IF NOT EXISTS store_chains (
+		id INTEGER NOT NULL PRIMARY KEY,
+		name varchar(255),
+		pattern varchar(255) UNIQUE
+	);
+
+	CREATE TABLE IF NOT EXISTS categories (
+		id INTEGER NOT NULL PRIMARY KEY,
+		name varchar(255) UNIQUE
+	);
+
+	CREATE TABLE IF NOT EXISTS scans (
+		id INTEGER NOT NULL PRIMARY KEY,
+		user_id int,
+		source varchar(16),
+		pages int,
+		cost decimal(8, 4),
+		scan_date datetime
 	);`
 
 	if _, err := db.Exec(create); err != nil {
 		return err
 	}
 
+	// Columns added after the first release, tables created before need to be altered
+	if err := addColumnIfNotExists(db, "receipt_items", "product_id", "int"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "products", "category", "varchar(255)"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "products", "package_size", "float"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "products", "package_unit", "varchar(8)"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "receipts", "source", "varchar(16)"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "receipts", "deleted_at", "datetime"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "receipt_items", "deleted_at", "datetime"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "receipts", "household_id", "int"); err != nil {
+		return err
+	}
+
+	for _, column := range []string{"email", "name", "picture_url", "locale", "currency", "timezone", "username", "password_hash", "role"} {
+		if err := addColumnIfNotExists(db, "users", column, "varchar(255)"); err != nil {
+			return err
+		}
+	}
+
+	if err := addColumnIfNotExists(db, "users", "disabled_at", "datetime"); err != nil {
+		return err
+	}
+
+	// Original files of scanned receipts, kept to read them again
+	if err := addColumnIfNotExists(db, "receipts", "image_path", "varchar(255)"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "receipts", "image_size", "int"); err != nil {
+		return err
+	}
+
+	// Usernames are used for local login, and can not be repeated
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS users_username ON users (username)"); err != nil {
+		return err
+	}
+
+	// Link users created before identities existed with their Google account
+	if _, err := db.Exec("INSERT OR IGNORE INTO user_identities (user_id, issuer, subject) SELECT id, ?, google_uid FROM users WHERE google_uid IS NOT NULL AND google_uid <> ''", GoogleIssuer); err != nil {
+		return err
+	}
+
+	// Link items stored before products existed
+	if err := LinkReceiptItemsToProducts(db); err != nil {
+		return err
+	}
+
+	// Parse package sizes for products stored before sizes existed
+	if err := FillProductPackageSizes(db); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Find user by given ID and return User instance or error
-func FindUserById(db *sql.DB, user_id int) (*User, error) {
-	row := db.QueryRow("SELECT * FROM users WHERE id = ?", user_id)
+// Add a column to given table only if it does not exist yet
+func addColumnIfNotExists(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt_value sql.NullString
+
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt_value, &pk); err != nil {
+			return err
+		}
+
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Columns read for users, profile columns can be empty for users created before they were added
+const userColumns = "id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at"
+
+// Row or rows to read a user from
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+// Read user from row with userColumns, followed by given extra columns
+func scanUser(row rowScanner, extra ...interface{}) (*User, error) {
 	user := User{}
-	if err := row.Scan(&user.ID, &user.GoogleUID); err != nil {
+	var google_uid, email, name, picture_url, locale, currency, timezone, role sql.NullString
+	var disabled_at sql.NullTime
+
+	dest := append([]interface{}{&user.ID, &google_uid, &email, &name, &picture_url, &locale, &currency, &timezone, &role, &disabled_at}, extra...)
+	if err := row.Scan(dest...); err != nil {
 		return nil, err
 	}
 
+	user.GoogleUID = google_uid.String
+	user.Email = email.String
+	user.Name = name.String
+	user.PictureURL = picture_url.String
+	user.Locale = locale.String
+	user.Currency = currency.String
+	user.Timezone = timezone.String
+
+	// Users created before roles existed are regular users
+	user.Role = role.String
+	if len(user.Role) == 0 {
+		user.Role = UserRoleUser
+	}
+
+	if disabled_at.Valid {
+		user.DisabledAt = &disabled_at.Time
+	}
+
 	return &user, nil
 }
 
+// Find user by given ID and return User instance or error
+func FindUserById(db *sql.DB, user_id int) (*User, error) {
+	return scanUser(db.QueryRow(fmt.Sprintf("SELECT %s FROM users WHERE id = ?", userColumns), user_id))
+}
+
 // Check if given google id user exists in database
 func FindUserByGoogleUid(db *sql.DB, google_uid string) (*User, error) {
-	row := db.QueryRow("SELECT * FROM users WHERE google_uid = ?", google_uid)
+	user, err := scanUser(db.QueryRow(fmt.Sprintf("SELECT %s FROM users WHERE google_uid = ?", userColumns), google_uid))
 
-	user := User{}
+	if err != nil {
+		// Missing users are expected for new users, which can be registered
+		if err != sql.ErrNoRows {
+			log.Printf("FindUserByGoogleUid - Error scanning row for google_uid: %s\n%v", google_uid, err)
+		}
+		return nil, err
+	}
+	return user, nil
+}
 
-	if err := row.Scan(&user.ID, &user.GoogleUID); err != nil {
-		log.Printf("FindUserByGoogleUid - Error scanning row for google_uid: %s\n%v", google_uid, err)
-		return nil, fmt.Errorf("FindUserByGoogleUid - Error scanning row for google_uid: %s\n%v", google_uid, err)
+// Create a new user for given google id, which is empty for users of other providers
+func CreateUser(db queryer, google_uid string) (*User, error) {
+	res, err := db.Exec("INSERT INTO users (google_uid) VALUES (?)", sql.NullString{String: google_uid, Valid: len(google_uid) > 0})
+	if err != nil {
+		return nil, err
 	}
-	return &user, nil
+
+	user_id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{ID: user_id, GoogleUID: google_uid}, nil
 }
 
 // Check if exists a receipt for given supermarket, date and amount (these values should be unique)
-func FindReceiptBySupermarketDateAmount(db *sql.DB, supermarket string, date time.Time, total float64) (*Receipt, error) {
-	row := db.QueryRow("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts WHERE supermarket LIKE ? AND DATE(receipt_date) = DATE(?) AND total = ?", fmt.Sprintf("%%%s%%", supermarket), date.Format(time.RFC3339), total)
+// Receipt with exclude_id is skipped, so an edited receipt is not found as a copy of itself
+func FindReceiptBySupermarketDateAmount(db queryer, supermarket string, date time.Time, total float64, exclude_id int64) (*Receipt, error) {
+	row := db.QueryRow("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts WHERE supermarket LIKE ? AND DATE(receipt_date) = DATE(?) AND total = ? AND id <> ? AND deleted_at IS NULL", fmt.Sprintf("%%%s%%", supermarket), date.Format(time.RFC3339), total, exclude_id)
 
 	receipt := Receipt{}
 	var currency sql.NullString
@@ -138,17 +417,68 @@ func FindReceiptBySupermarketDateAmount(db *sql.DB, supermarket string, date tim
 	return &receipt, nil
 }
 
-// Create a new receipt in the database and return record ID or error if could not be created
-func CreateReceipt(db *sql.DB, receipt *Receipt) (*Receipt, error) {
-	// Check if receipt already exists
-	ereceipt, err := FindReceiptBySupermarketDateAmount(db, receipt.Supermarket, receipt.Date, receipt.Total)
+// Check receipt has the values required to be stored, whatever source it comes from
+func ValidateReceipt(receipt *Receipt) error {
+	if len(strings.TrimSpace(receipt.Supermarket)) == 0 {
+		return errors.New("Supermarket can not be empty")
+	}
+
+	if receipt.Date.IsZero() {
+		return errors.New("Date can not be empty")
+	}
+
+	if receipt.Date.After(time.Now().AddDate(0, 0, 1)) {
+		return errors.New("Date can not be in the future")
+	}
+
+	if receipt.Total < 0 {
+		return errors.New("Total can not be negative")
+	}
+
+	if len(receipt.Currency) > 0 && len(receipt.Currency) != 3 {
+		return fmt.Errorf("Invalid currency %s", receipt.Currency)
+	}
+
+	for index := range receipt.Items {
+		if err := validateReceiptItem(&receipt.Items[index]); err != nil {
+			return fmt.Errorf("Item #%d: %v", index, err)
+		}
+	}
+
+	return nil
+}
+
+// Set supermarket of receipt to the store chain name when it matches one, and return ErrReceiptExists if user already has it
+// Receipt itself is not taken as a duplicate when it has an ID, so it can be checked before updating it
+func CheckReceiptExists(db queryer, receipt *Receipt) error {
+	supermarket, err := FindStoreChainName(db, receipt.Supermarket)
+	if err != nil {
+		return err
+	}
+	receipt.Supermarket = supermarket
+
+	ereceipt, err := FindReceiptBySupermarketDateAmount(db, receipt.Supermarket, receipt.Date, receipt.Total, receipt.ID)
 
 	if err != nil && err != sql.ErrNoRows {
-		return nil, err
+		return err
 	}
 
 	if ereceipt != nil && ereceipt.UserID == receipt.UserID {
-		return nil, errors.New("Receipt already exists")
+		return ErrReceiptExists
+	}
+
+	return nil
+}
+
+// Create a new receipt in the database and return record ID or error if could not be created
+func CreateReceipt(db *sql.DB, receipt *Receipt) (*Receipt, error) {
+	if err := CheckReceiptExists(db, receipt); err != nil {
+		return nil, err
+	}
+
+	// Receipts are scanned unless other source is set
+	if len(receipt.Source) == 0 {
+		receipt.Source = SourceScan
 	}
 
 	tx, err := db.Begin()
@@ -159,7 +489,16 @@ func CreateReceipt(db *sql.DB, receipt *Receipt) (*Receipt, error) {
 	defer tx.Rollback()
 
 	// Create receipt
-	res, err := db.Exec("INSERT INTO receipts (user_id, supermarket, receipt_date, currency, total) VALUES (?, ?, ?, ?, ?)", receipt.UserID, receipt.Supermarket, receipt.Date.Format(time.RFC3339), receipt.Currency, receipt.Total)
+	// Receipts without household are personal
+	var household_id sql.NullInt64
+	if receipt.HouseholdID > 0 {
+		if err := CheckHouseholdWriteAccess(tx, receipt.HouseholdID, receipt.UserID); err != nil {
+			return nil, err
+		}
+		household_id = sql.NullInt64{Int64: receipt.HouseholdID, Valid: true}
+	}
+
+	res, err := tx.Exec("INSERT INTO receipts (user_id, household_id, supermarket, receipt_date, currency, total, source) VALUES (?, ?, ?, ?, ?, ?, ?)", receipt.UserID, household_id, receipt.Supermarket, receipt.Date.Format(time.RFC3339), receipt.Currency, receipt.Total, receipt.Source)
 	if err != nil {
 		return nil, err
 	}
@@ -170,27 +509,116 @@ func CreateReceipt(db *sql.DB, receipt *Receipt) (*Receipt, error) {
 	}
 	receipt.ID = id
 
-	// Create receipt items
+	// Keep track of how receipt was created, to compare it with later changes
+	if err := recordReceiptChange(tx, &ReceiptChange{ReceiptID: id, UserID: receipt.UserID, Action: ActionCreate, Field: "source", NewValue: receipt.Source}); err != nil {
+		return nil, err
+	}
+
+	if err := insertReceiptItems(tx, receipt); err != nil {
+		return nil, err
+	}
+
+	// Values read from receipt, like OCR results, are kept to compare them with later changes
+	for _, field := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"supermarket", receipt.Supermarket},
+		{"date", receipt.Date},
+		{"currency", receipt.Currency},
+		{"total", receipt.Total},
+	} {
+		change := ReceiptChange{ReceiptID: id, UserID: receipt.UserID, Action: ActionCreate, Field: field.name, NewValue: formatChangeValue(field.value)}
+		if err := recordReceiptChange(tx, &change); err != nil {
+			return nil, err
+		}
+	}
+
+	for index := range receipt.Items {
+		if err := recordItemValues(tx, id, receipt.UserID, ActionCreate, &receipt.Items[index]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// Create items of receipt, linking them to their products
+func insertReceiptItems(tx queryer, receipt *Receipt) error {
 	for index, item := range receipt.Items {
+		// Link item to its product, creating it the first time is bought
+		product_id, err := FindOrCreateProduct(tx, item.Name)
+		if err != nil {
+			return err
+		}
+
 		// Create receipt item
-		res, err := db.Exec("INSERT INTO receipt_items (receipt_id, quantity, name, unit_price, price) VALUES (?, ?, ?, ?, ?)",
-			id, item.Quantity, item.Name, item.UnitPrice, item.Price)
+		res, err := tx.Exec("INSERT INTO receipt_items (receipt_id, quantity, name, unit_price, price, product_id) VALUES (?, ?, ?, ?, ?, ?)",
+			receipt.ID, item.Quantity, item.Name, item.UnitPrice, item.Price, product_id)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		item_id, err := res.LastInsertId()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// Update item ID in receipt object
 		receipt.Items[index].ID = item_id
+		receipt.Items[index].ReceiptID = receipt.ID
+		receipt.Items[index].ProductID = product_id
 	}
 
-	tx.Commit()
-	return receipt, nil
+	return nil
+}
+
+// Return SQL conditions and parameters for supermarket, household, member and date filters
+func receiptFilterConditions(filters *ReceiptFilter) ([]string, []interface{}, error) {
+	var conditions []string
+	var parameters []interface{}
+
+	// Supermarket
+	if len(filters.Supermarket) > 0 {
+		parameters = append(parameters, fmt.Sprintf("%%%s%%", filters.Supermarket))
+		conditions = append(conditions, "supermarket like ?")
+	}
+
+	// Household and member who created receipts
+	if filters.HouseholdID > 0 {
+		parameters = append(parameters, filters.HouseholdID)
+		conditions = append(conditions, "receipts.household_id = ?")
+	}
+
+	if filters.MemberID > 0 {
+		parameters = append(parameters, filters.MemberID)
+		conditions = append(conditions, "receipts.user_id = ?")
+	}
+
+	// Date
+	if filters.MinDate != nil {
+		parameters = append(parameters, filters.MinDate)
+		conditions = append(conditions, "DATE(receipt_date) >= DATE(?)")
+
+		// Set max date if present
+		if filters.MaxDate != nil {
+
+			// Avoid setting max date before min date
+			if filters.MaxDate.Before(*filters.MinDate) {
+				return nil, nil, errors.New("MaxDate can not no lower than MinDate")
+			}
+
+			conditions = append(conditions, "DATE(receipt_date) <= DATE(?)")
+			parameters = append(parameters, filters.MaxDate)
+		}
+	}
+
+	return conditions, parameters, nil
 }
 
 func FindAllReceiptsForUser(db *sql.DB, user *User, filters *ReceiptFilter) (*[]Receipt, error) {
@@ -199,7 +627,7 @@ func FindAllReceiptsForUser(db *sql.DB, user *User, filters *ReceiptFilter) (*[]
 
 	sql := "SELECT id, supermarket, receipt_date, total FROM receipts"
 	var joins []string
-	var conditions []string
+	conditions := []string{"receipts.deleted_at IS NULL"}
 
 	var limit, offset string
 
@@ -209,18 +637,12 @@ func FindAllReceiptsForUser(db *sql.DB, user *User, filters *ReceiptFilter) (*[]
 		// Item
 		// Handle this filter first of all because needs to use a JOIN
 		if filters.Item != "" {
-	        sql = "SELECT receipts.id, supermarket, receipt_date, total FROM receipts"
+			sql = "SELECT receipts.id, supermarket, receipt_date, total FROM receipts"
 			joins = append(joins, "INNER JOIN receipt_items ON receipt_items.receipt_id = receipts.id")
-			conditions = append(conditions, "receipt_items.name LIKE ?")
+			conditions = append(conditions, "receipt_items.name LIKE ?", "receipt_items.deleted_at IS NULL")
 			parameters = append(parameters, fmt.Sprintf("%%%s%%", filters.Item))
 		}
 
-		// Supermarket
-		if len(filters.Supermarket) > 0 {
-			parameters = append(parameters, fmt.Sprintf("%%%s%%", filters.Supermarket))
-			conditions = append(conditions, "supermarket like ?")
-		}
-
 		// Page and per page
 		if filters.Page > 0 && filters.PerPage > 0 {
 			limit = fmt.Sprintf("LIMIT %d", filters.PerPage)
@@ -229,32 +651,23 @@ func FindAllReceiptsForUser(db *sql.DB, user *User, filters *ReceiptFilter) (*[]
 			}
 		}
 
-		// Date
-		if filters.MinDate != nil {
-			parameters = append(parameters, filters.MinDate)
-			conditions = append(conditions, "DATE(receipt_date) >= DATE(?)")
-
-			// Set max date if present
-			if filters.MaxDate != nil {
-
-				// Avoid setting max date before min date
-				if filters.MaxDate.Before(*filters.MinDate) {
-					return nil, errors.New("MaxDate can not no lower than MinDate")
-				}
-
-				conditions = append(conditions, "DATE(receipt_date) <= DATE(?)")
-				parameters = append(parameters, filters.MaxDate)
-			}
+		// Supermarket and date
+		filter_conditions, filter_parameters, err := receiptFilterConditions(filters)
+		if err != nil {
+			return nil, err
 		}
+
+		conditions = append(conditions, filter_conditions...)
+		parameters = append(parameters, filter_parameters...)
 	}
 
 	sql = fmt.Sprintf("%s %s", sql, strings.Join(joins, ""))
 
 	if len(conditions) == 0 {
-		sql = fmt.Sprintf("%s WHERE user_id = ?", sql)
+		sql = fmt.Sprintf("%s WHERE %s", sql, receiptReadAccess)
 	} else {
 		query_conditions := strings.Join(conditions, " AND ")
-		sql = fmt.Sprintf("%s WHERE user_id = ? AND %s", sql, query_conditions)
+		sql = fmt.Sprintf("%s WHERE %s AND %s", sql, receiptReadAccess, query_conditions)
 	}
 
 	sql = fmt.Sprintf("%s ORDER BY receipt_date DESC %s %s", sql, limit, offset)
@@ -280,29 +693,34 @@ func FindAllReceiptsForUser(db *sql.DB, user *User, filters *ReceiptFilter) (*[]
 
 func FindReceiptForUser(db *sql.DB, receipt_id int, user_id int) (*Receipt, error) {
 	// Get receipt information filtering by given user
-	row := db.QueryRow("SELECT id, supermarket, receipt_date, currency, total FROM receipts WHERE id = ? AND user_id = ?", receipt_id, user_id)
+	row := db.QueryRow("SELECT id, user_id, household_id, supermarket, receipt_date, currency, total, source FROM receipts WHERE id = ? AND "+receiptReadAccess+" AND deleted_at IS NULL", receipt_id, user_id)
 
 	receipt := Receipt{}
 
-	var currency sql.NullString
+	var currency, source sql.NullString
+	var household_id sql.NullInt64
 
-	err := row.Scan(&receipt.ID, &receipt.Supermarket, &receipt.Date, &currency, &receipt.Total)
+	err := row.Scan(&receipt.ID, &receipt.UserID, &household_id, &receipt.Supermarket, &receipt.Date, &currency, &receipt.Total, &source)
+	receipt.HouseholdID = household_id.Int64
 	receipt.Currency = currency.String
+	receipt.Source = source.String
 
 	if err != nil {
 		return nil, err
 	}
 
 	// Get receipt items
-	rows, err := db.Query("SELECT id, quantity, name, unit_price, price FROM receipt_items WHERE receipt_id = ? ORDER BY quantity DESC", receipt_id)
+	rows, err := db.Query("SELECT id, quantity, name, unit_price, price, product_id FROM receipt_items WHERE receipt_id = ? AND deleted_at IS NULL ORDER BY quantity DESC", receipt_id)
 
 	if err != nil {
 		return nil, err
 	}
 
 	for rows.Next() {
-		item := ReceiptItem{}
-		rows.Scan(&item.ID, &item.Quantity, &item.Name, &item.UnitPrice, &item.Price)
+		item := ReceiptItem{ReceiptID: receipt.ID}
+		var product_id sql.NullInt64
+		rows.Scan(&item.ID, &item.Quantity, &item.Name, &item.UnitPrice, &item.Price, &product_id)
+		item.ProductID = product_id.Int64
 		receipt.Items = append(receipt.Items, item)
 	}
 	return &receipt, nil
@@ -18,9 +18,9 @@ func TestUserFindByIdNotFound(t *testing.T) {
 	}
 
 	defer db.Close()
-	mock.ExpectQuery("SELECT \\* FROM users WHERE id = ?").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at FROM users WHERE id = ?")).
 		WithArgs(2).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at"}))
 
 	user, _ := FindUserById(db, 2)
 
@@ -40,10 +40,10 @@ func TestUserFindByIdSuccess(t *testing.T) {
 	}
 
 	defer db.Close()
-	rows := sqlmock.NewRows([]string{"id", "name"}).
-		AddRow(1, "User 1")
+	rows := sqlmock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at"}).
+		AddRow(1, "12345", "user@example.com", "User 1", nil, "es", "EUR", nil, nil, nil)
 
-	mock.ExpectQuery("SELECT \\* FROM users WHERE id = ?").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at FROM users WHERE id = ?")).
 		WithArgs(1).
 		WillReturnRows(rows)
 
@@ -57,6 +57,11 @@ func TestUserFindByIdSuccess(t *testing.T) {
 		t.Fatalf("Unexpected error: %s", err)
 	}
 
+	assert.Equal(t, "user@example.com", user.Email)
+	assert.Equal(t, "User 1", user.Name)
+	assert.Equal(t, "", user.PictureURL)
+	assert.Equal(t, "EUR", user.Currency)
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
@@ -70,9 +75,9 @@ func TestFindUserByGoogleIdNotFound(t *testing.T) {
 
 	defer db.Close()
 
-	rows := mock.NewRows([]string{"id", "google_uid"})
+	rows := mock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at"})
 
-	mock.ExpectQuery("SELECT \\* FROM users WHERE google_uid = ?").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at FROM users WHERE google_uid = ?")).
 		WithArgs("12345").
 		WillReturnRows(rows)
 
@@ -95,9 +100,9 @@ func TestFindUserByGoogleIdFound(t *testing.T) {
 
 	defer db.Close()
 
-	rows := mock.NewRows([]string{"id", "google_uid"}).AddRow(1, "12345")
+	rows := mock.NewRows([]string{"id", "google_uid", "email", "name", "picture_url", "locale", "currency", "timezone", "role", "disabled_at"}).AddRow(1, "12345", nil, nil, nil, nil, nil, nil, nil, nil)
 
-	mock.ExpectQuery("SELECT \\* FROM users").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, google_uid, email, name, picture_url, locale, currency, timezone, role, disabled_at FROM users")).
 		WithArgs("12345").
 		WillReturnRows(rows)
 
@@ -124,10 +129,10 @@ func TestFindReceiptBySupermarketDateAmountNotFound(t *testing.T) {
 	rows := mock.NewRows([]string{"id", "supermarket", "date", "currency", "total"})
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
-		WithArgs("%other%", ts.Format(time.RFC3339), 543.21).
+		WithArgs("%other%", ts.Format(time.RFC3339), 543.21, 0).
 		WillReturnRows(rows)
 
-	receipt, err := FindReceiptBySupermarketDateAmount(db, "other", ts, 543.21)
+	receipt, err := FindReceiptBySupermarketDateAmount(db, "other", ts, 543.21, 0)
 
 	if receipt != nil {
 		t.Fatalf("Receipt should not be nil for not existing params")
@@ -155,10 +160,10 @@ func TestFindReceiptBySupermarketDateAmountFound(t *testing.T) {
 		AddRow(1, 1, "Any", ts, "EUR", 123.45)
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
-		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45).
+		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45, 0).
 		WillReturnRows(rows)
 
-	receipt, err := FindReceiptBySupermarketDateAmount(db, "Any", ts, 123.45)
+	receipt, err := FindReceiptBySupermarketDateAmount(db, "Any", ts, 123.45, 0)
 
 	if err != nil && err != sql.ErrNoRows {
 		t.Fatalf("Unexpected error: %s", err)
@@ -189,8 +194,12 @@ func TestCreateReceipt(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, 1, "Any", ts, "EUR", 123.45)
 
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
-		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45).
+		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45, 0).
 		WillReturnRows(receipt_rows)
 
 	mock.ExpectBegin()
@@ -223,8 +232,12 @@ func TestCreateReceiptWithNullCurrency(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, 1, "Any", ts, nil, 123.45)
 
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
-		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45).
+		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45, 0).
 		WillReturnRows(receipt_rows)
 
 	mock.ExpectBegin()
@@ -257,8 +270,12 @@ func TestCreateDuplicatedReceiptForDifferentUser(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, 1, "Any", ts, "EUR", 123.45)
 
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
-		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45).
+		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45, 0).
 		WillReturnRows(receipt_rows)
 
 	mock.ExpectBegin()
@@ -270,18 +287,38 @@ func TestCreateDuplicatedReceiptForDifferentUser(t *testing.T) {
 
 	// Insert receipt
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipts")).
-		WithArgs(2, "Any", ts.Format(time.RFC3339), "EUR", 123.45).
+		WithArgs(2, nil, "Any", ts.Format(time.RFC3339), "EUR", 123.45, SourceScan).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, nil, 2, ActionCreate, "source", "", SourceScan, sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	// Insert receipt items
-	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items ")).
-		WithArgs(1, 1.0, "Item 1", 11.0, 10.0).
+	// Insert receipt items, creating products the first time
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("ITEM 1").
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO products")).
+		WithArgs("ITEM 1", 0.0, "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items")).
-		WithArgs(1, 2.0, "Item 2", 22.0, 20.0).
+		WithArgs(1, 1.0, "Item 1", 11.0, 10.0, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("ITEM 2").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items")).
+		WithArgs(1, 2.0, "Item 2", 22.0, 20.0, 2).
 		WillReturnResult(sqlmock.NewResult(2, 1))
 
+	expectReceiptValues(mock, 1, 1, receipt)
+
+	mock.ExpectCommit()
+
 	created_receipt, err := CreateReceipt(db, &receipt)
 
 	if created_receipt == nil {
@@ -292,7 +329,11 @@ func TestCreateDuplicatedReceiptForDifferentUser(t *testing.T) {
 		t.Fatalf("Unexpected error creating receipt: %s", err)
 	}
 
-	mock.ExpectCommit()
+	assert.Equal(t, int64(2), created_receipt.Items[1].ProductID, "Item should be linked to existing product")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
 }
 
 func TestCreateNonDuplicatedReceipt(t *testing.T) {
@@ -310,8 +351,12 @@ func TestCreateNonDuplicatedReceipt(t *testing.T) {
 
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"})
 
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
-		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45).
+		WithArgs("%Any%", ts.Format(time.RFC3339), 123.45, 0).
 		WillReturnRows(receipt_rows)
 
 	mock.ExpectBegin()
@@ -323,18 +368,38 @@ func TestCreateNonDuplicatedReceipt(t *testing.T) {
 
 	// Insert receipt
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipts")).
-		WithArgs(2, "Any", ts.Format(time.RFC3339), "EUR", 123.45).
+		WithArgs(2, nil, "Any", ts.Format(time.RFC3339), "EUR", 123.45, SourceScan).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, nil, 2, ActionCreate, "source", "", SourceScan, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Insert receipt items, creating products the first time
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("ITEM 1").
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO products")).
+		WithArgs("ITEM 1", 0.0, "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	// Insert receipt items
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items")).
-		WithArgs(1, 1.0, "Item 1", 11.0, 10.0).
+		WithArgs(1, 1.0, "Item 1", 11.0, 10.0, 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("ITEM 2").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2))
+
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items")).
-		WithArgs(1, 2.0, "Item 2", 22.0, 20.0).
+		WithArgs(1, 2.0, "Item 2", 22.0, 20.0, 2).
 		WillReturnResult(sqlmock.NewResult(2, 1))
 
+	expectReceiptValues(mock, 1, 1, receipt)
+
+	mock.ExpectCommit()
+
 	created_receipt, err := CreateReceipt(db, &receipt)
 
 	if created_receipt == nil {
@@ -345,7 +410,11 @@ func TestCreateNonDuplicatedReceipt(t *testing.T) {
 		t.Fatalf("Unexpected error creating receipt: %s", err)
 	}
 
-	mock.ExpectCommit()
+	assert.Equal(t, int64(2), created_receipt.Items[1].ProductID, "Item should be linked to existing product")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
 }
 
 func TestFindAllReceiptsForUser(t *testing.T) {
@@ -365,7 +434,7 @@ func TestFindAllReceiptsForUser(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)")).
 		WithArgs(user_id).
 		WillReturnRows(receipt_rows)
 
@@ -390,7 +459,7 @@ func TestFindAllReceiptsForUserEmptyResults(t *testing.T) {
 
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)")).
 		WithArgs(user_id).
 		WillReturnRows(receipt_rows)
 
@@ -415,17 +484,17 @@ func TestFindReceiptForUser(t *testing.T) {
 	receipt_id := 1
 	user_id := 2
 
-	receipt_row := mock.NewRows([]string{"id", "supermarket", "date", "currency", "total"}).
-		AddRow(receipt_id, "Any", ts, "EUR", 123.45)
+	receipt_row := mock.NewRows([]string{"id", "user_id", "household_id", "supermarket", "date", "currency", "total", "source"}).
+		AddRow(receipt_id, user_id, nil, "Any", ts, "EUR", 123.45, SourceScan)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, currency, total FROM receipts WHERE id = ? AND user_id = ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, household_id, supermarket, receipt_date, currency, total, source FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)")).
 		WithArgs(receipt_id, user_id).
 		WillReturnRows(receipt_row)
 
 	items_rows := mock.NewRows([]string{"id", "receipt_id", "quantity", "name", "unit_price", "price"}).
 		AddRow(1, receipt_id, 1, "Any", 2, 3)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, quantity, name, unit_price, price FROM receipt_items WHERE receipt_id = ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, quantity, name, unit_price, price, product_id FROM receipt_items WHERE receipt_id = ?")).
 		WithArgs(receipt_id).
 		WillReturnRows(items_rows)
 
@@ -455,17 +524,17 @@ func TestFindReceiptNotFoundForUser(t *testing.T) {
 	user_id := 1
 	other_user_id := 2
 
-	receipt_row := mock.NewRows([]string{"id", "supermarket", "date", "currency", "total"}).
-		AddRow(receipt_id, "Any", ts, "EUR", 123.45)
+	receipt_row := mock.NewRows([]string{"id", "user_id", "household_id", "supermarket", "date", "currency", "total", "source"}).
+		AddRow(receipt_id, user_id, nil, "Any", ts, "EUR", 123.45, SourceScan)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, currency, total FROM receipts WHERE id = ? AND user_id = ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, household_id, supermarket, receipt_date, currency, total, source FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)")).
 		WithArgs(receipt_id, user_id).
 		WillReturnRows(receipt_row)
 
 	items_rows := mock.NewRows([]string{"id", "receipt_id", "quantity", "name", "unit_price", "price"}).
 		AddRow(1, receipt_id, 1, "Any", 2, 3)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, quantity, name, unit_price, price FROM receipt_items WHERE receipt_id = ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, quantity, name, unit_price, price, product_id FROM receipt_items WHERE receipt_id = ?")).
 		WithArgs(receipt_id).
 		WillReturnRows(items_rows)
 
@@ -496,7 +565,7 @@ func TestFindAllReceiptsForUserFilterBySupermarket(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ? AND supermarket like ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND supermarket like ?")).
 		WithArgs(user_id, fmt.Sprintf("%%%s%%", supermarket)).
 		WillReturnRows(receipt_rows)
 
@@ -528,7 +597,7 @@ func TestFindAllReceiptsForUserFilterByPageOne(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ? ORDER BY receipt_date DESC LIMIT 1")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL ORDER BY receipt_date DESC LIMIT 1")).
 		WithArgs(user_id).
 		WillReturnRows(receipt_rows)
 
@@ -560,7 +629,7 @@ func TestFindAllReceiptsForUserFilterByPageTwoOrMore(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ? ORDER BY receipt_date DESC LIMIT 5 OFFSET 5")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL ORDER BY receipt_date DESC LIMIT 5 OFFSET 5")).
 		WithArgs(user_id).
 		WillReturnRows(receipt_rows)
 
@@ -592,7 +661,7 @@ func TestFindAllReceiptsForUserFilterByMinDate(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ? AND DATE(receipt_date) >= DATE(?) ORDER BY receipt_date DESC LIMIT 1")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND DATE(receipt_date) >= DATE(?) ORDER BY receipt_date DESC LIMIT 1")).
 		WithArgs(user_id, ts).
 		WillReturnRows(receipt_rows)
 
@@ -626,7 +695,7 @@ func TestFindAllReceiptsForUserFilterByMaxDate(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ? AND DATE(receipt_date) >= DATE(?) AND DATE(receipt_date) <= DATE(?) ORDER BY receipt_date DESC LIMIT 1")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND DATE(receipt_date) >= DATE(?) AND DATE(receipt_date) <= DATE(?) ORDER BY receipt_date DESC LIMIT 1")).
 		WithArgs(user_id, ts_min, ts_max).
 		WillReturnRows(receipt_rows)
 
@@ -660,7 +729,7 @@ func TestFindAllReceiptsForUserFilterByMaxDateBeforeMinDate(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE user_id = ? AND receipt_date >= ? AND receipt_date <= ? ORDER BY receipt_date DESC LIMIT 1")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, supermarket, receipt_date, total FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipt_date >= ? AND receipt_date <= ? ORDER BY receipt_date DESC LIMIT 1")).
 		WithArgs(user_id, ts_min, ts_max).
 		WillReturnRows(receipt_rows)
 
@@ -696,7 +765,7 @@ func TestFindAllReceiptsForUserFilterByItem(t *testing.T) {
 	receipt_rows := mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}).
 		AddRow(1, user_id, "Any", ts, "EUR", 123.45)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT receipts.id, supermarket, receipt_date, total FROM receipts INNER JOIN receipt_items ON receipt_items.receipt_id = receipts.id WHERE user_id = ? AND receipt_items.name LIKE ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT receipts.id, supermarket, receipt_date, total FROM receipts INNER JOIN receipt_items ON receipt_items.receipt_id = receipts.id WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND receipt_items.name LIKE ? AND receipt_items.deleted_at IS NULL")).
 		WithArgs(user_id, fmt.Sprintf("%%%s%%", item)).
 		WillReturnRows(receipt_rows)
 
@@ -708,3 +777,64 @@ func TestFindAllReceiptsForUserFilterByItem(t *testing.T) {
 		t.Fatalf("Unexpected error %s getting receipts for user", err)
 	}
 }
+
+func TestCreateManualReceipt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
+		WithArgs("%Market%", ts.Format(time.RFC3339), 3.5, 0).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "supermarket", "date", "currency", "total"}))
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipts (user_id, household_id, supermarket, receipt_date, currency, total, source)")).
+		WithArgs(1, nil, "Market", ts.Format(time.RFC3339), "EUR", 3.5, SourceManual).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, nil, 1, ActionCreate, "source", "", SourceManual, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	receipt := Receipt{UserID: 1, Supermarket: "Market", Date: ts, Currency: "EUR", Total: 3.5, Source: SourceManual}
+	expectReceiptValues(mock, 1, 1, receipt)
+
+	mock.ExpectCommit()
+
+	created_receipt, err := CreateReceipt(db, &receipt)
+
+	if err != nil {
+		t.Fatalf("Unexpected error creating receipt: %s", err)
+	}
+
+	assert.Equal(t, SourceManual, created_receipt.Source)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestValidateReceipt(t *testing.T) {
+	ts := time.Now()
+	items := []ReceiptItem{{Name: "Pan", Quantity: 1, Price: 1}}
+
+	assert.Nil(t, ValidateReceipt(&Receipt{Supermarket: "Any", Date: ts, Currency: "EUR", Total: 1, Items: items}))
+
+	assert.NotNil(t, ValidateReceipt(&Receipt{Supermarket: " ", Date: ts, Total: 1}), "Supermarket is required")
+	assert.NotNil(t, ValidateReceipt(&Receipt{Supermarket: "Any", Total: 1}), "Date is required")
+	assert.NotNil(t, ValidateReceipt(&Receipt{Supermarket: "Any", Date: ts.AddDate(0, 1, 0), Total: 1}), "Date can not be in the future")
+	assert.NotNil(t, ValidateReceipt(&Receipt{Supermarket: "Any", Date: ts, Total: -1}), "Total can not be negative")
+	assert.NotNil(t, ValidateReceipt(&Receipt{Supermarket: "Any", Date: ts, Currency: "EURO", Total: 1}), "Currency must have 3 letters")
+	assert.NotNil(t, ValidateReceipt(&Receipt{Supermarket: "Any", Date: ts, Total: 1, Items: []ReceiptItem{{Name: "Pan", Price: 1}}}), "Item quantity is required")
+}
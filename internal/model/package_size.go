@@ -0,0 +1,76 @@
+package model
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Units used to store package sizes: grams, millilitres and units
+const (
+	UnitGrams       = "g"
+	UnitMillilitres = "ml"
+	UnitUnits       = "u"
+)
+
+// Weight or volume, optionally multiplied by number of units, like 500G, 1,5L or 6X1L
+var packageSizeExp = regexp.MustCompile(`\b(?:(\d+)\s*X\s*)?(\d+(?:[.,]\d+)?)\s*(KGS|KG|GRS|GR|G|LTS|LT|ML|CL|L)\b`)
+
+// Number of units, like PACK 6 or 12 UDS
+var packageUnitsExp = regexp.MustCompile(`\bPACK\s*(\d+)\b|\b(\d+)\s*(?:UNIDADES|UNID|UDS|UD|U)\b`)
+
+// Parse package size from product name, returning size converted to grams, millilitres or units
+// Third value is false if name does not contain any size
+func ParsePackageSize(name string) (float64, string, bool) {
+	name = NormalizeProductName(name)
+
+	if match := packageSizeExp.FindStringSubmatch(name); match != nil {
+		size, err := strconv.ParseFloat(strings.Replace(match[2], ",", ".", -1), 64)
+		if err != nil || size <= 0 {
+			return 0, "", false
+		}
+
+		if len(match[1]) > 0 {
+			units, err := strconv.ParseFloat(match[1], 64)
+			if err == nil && units > 0 {
+				size = size * units
+			}
+		}
+
+		switch match[3] {
+		case "KGS", "KG":
+			return round2(size * 1000), UnitGrams, true
+		case "GRS", "GR", "G":
+			return round2(size), UnitGrams, true
+		case "LTS", "LT", "L":
+			return round2(size * 1000), UnitMillilitres, true
+		case "CL":
+			return round2(size * 10), UnitMillilitres, true
+		case "ML":
+			return round2(size), UnitMillilitres, true
+		}
+	}
+
+	if match := packageUnitsExp.FindStringSubmatch(name); match != nil {
+		value := match[1]
+		if len(value) == 0 {
+			value = match[2]
+		}
+
+		units, err := strconv.ParseFloat(value, 64)
+		if err == nil && units > 0 {
+			return units, UnitUnits, true
+		}
+	}
+
+	return 0, "", false
+}
+
+// Return product name without package size, so the same product can be found when its size changes
+func StripPackageSize(name string) string {
+	name = NormalizeProductName(name)
+	name = packageSizeExp.ReplaceAllString(name, "")
+	name = packageUnitsExp.ReplaceAllString(name, "")
+
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePackageSize(t *testing.T) {
+	cases := []struct {
+		name string
+		size float64
+		unit string
+	}{
+		{"ARROZ REDONDO 1KG", 1000, UnitGrams},
+		{"Galletas 500G", 500, UnitGrams},
+		{"PATATAS 2,5 KG", 2500, UnitGrams},
+		{"QUESO 250 GR", 250, UnitGrams},
+		{"ACEITE OLIVA 1,5L", 1500, UnitMillilitres},
+		{"CERVEZA 6X33CL", 1980, UnitMillilitres},
+		{"LECHE 6 X 1L", 6000, UnitMillilitres},
+		{"YOGUR NATURAL PACK 6", 6, UnitUnits},
+		{"HUEVOS 12 UDS", 12, UnitUnits},
+	}
+
+	for _, c := range cases {
+		size, unit, ok := ParsePackageSize(c.name)
+
+		assert.True(t, ok, "Size should be found in %s", c.name)
+		assert.Equal(t, c.size, size, "Wrong size for %s", c.name)
+		assert.Equal(t, c.unit, unit, "Wrong unit for %s", c.name)
+	}
+}
+
+func TestParsePackageSizeNotFound(t *testing.T) {
+	for _, name := range []string{"PAN DE PUEBLO", "ITEM 1", "GALLETAS MARIA"} {
+		_, _, ok := ParsePackageSize(name)
+		assert.False(t, ok, "Size should not be found in %s", name)
+	}
+}
+
+func TestStripPackageSize(t *testing.T) {
+	assert.Equal(t, "ARROZ REDONDO", StripPackageSize("Arroz redondo 1KG"))
+	assert.Equal(t, "ARROZ REDONDO", StripPackageSize("ARROZ REDONDO 900 G"))
+	assert.Equal(t, "YOGUR NATURAL", StripPackageSize("YOGUR NATURAL PACK 6"))
+}
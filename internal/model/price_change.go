@@ -0,0 +1,217 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type PriceChange struct {
+	ID            int64     `db:"id" json:"id"`
+	UserID        int64     `db:"user_id" json:"-"`
+	ProductID     int64     `db:"product_id" json:"product_id"`
+	Product       string    `db:"name" json:"product"`
+	ReceiptID     int64     `db:"receipt_id" json:"receipt_id"`
+	ReceiptItemID int64     `db:"receipt_item_id" json:"receipt_item_id"`
+	Supermarket   string    `db:"supermarket" json:"supermarket"`
+	PreviousPrice float64   `db:"previous_price" json:"previous_price"`
+	Price         float64   `db:"price" json:"price"`
+	ChangePercent float64   `db:"change_percent" json:"change_percent"`
+	PreviousDate  time.Time `db:"previous_date" json:"previous_date"`
+	Date          time.Time `db:"change_date" json:"date"`
+}
+
+type PriceChangeFilter struct {
+	Product     string
+	Supermarket string
+	Direction   string
+	MinDate     *time.Time
+	MaxDate     *time.Time
+	Page        int64
+	PerPage     int64
+}
+
+// Return price paid for a single unit of the item
+// Some receipts have not unit price, so it is calculated from price and quantity
+func (item *ReceiptItem) EffectiveUnitPrice() float64 {
+	if item.UnitPrice > 0 {
+		return item.UnitPrice
+	}
+
+	if item.Quantity > 0 {
+		return item.Price / item.Quantity
+	}
+
+	return item.Price
+}
+
+// Compare each item from given receipt against the last time the same product was bought in the same supermarket
+// Every change with an absolute percentage equal or greater than threshold is stored and returned
+func DetectPriceChanges(db *sql.DB, receipt *Receipt, threshold float64) ([]PriceChange, error) {
+	changes := []PriceChange{}
+
+	for _, item := range receipt.Items {
+		if item.ProductID == 0 {
+			continue
+		}
+
+		row := db.QueryRow(`SELECT receipts.receipt_date, receipt_items.quantity, receipt_items.unit_price, receipt_items.price FROM receipt_items
+			INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+			WHERE receipts.user_id = ? AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND receipts.supermarket = ? AND receipt_items.product_id = ? AND receipts.id <> ? AND DATE(receipts.receipt_date) <= DATE(?)
+			ORDER BY receipts.receipt_date DESC, receipt_items.id DESC LIMIT 1`,
+			receipt.UserID, receipt.Supermarket, item.ProductID, receipt.ID, receipt.Date.Format(time.RFC3339))
+
+		previous := ReceiptItem{}
+		var previous_date time.Time
+		err := row.Scan(&previous_date, &previous.Quantity, &previous.UnitPrice, &previous.Price)
+
+		// First time product is bought in this supermarket, nothing to compare with
+		if err == sql.ErrNoRows {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		previous_price := previous.EffectiveUnitPrice()
+		price := item.EffectiveUnitPrice()
+
+		if previous_price <= 0 {
+			continue
+		}
+
+		change_percent := math.Round((price-previous_price)/previous_price*10000) / 100
+		if math.Abs(change_percent) < threshold || change_percent == 0 {
+			continue
+		}
+
+		change := PriceChange{
+			UserID:        receipt.UserID,
+			ProductID:     item.ProductID,
+			Product:       NormalizeProductName(item.Name),
+			ReceiptID:     receipt.ID,
+			ReceiptItemID: item.ID,
+			Supermarket:   receipt.Supermarket,
+			PreviousPrice: previous_price,
+			Price:         price,
+			ChangePercent: change_percent,
+			PreviousDate:  previous_date,
+			Date:          receipt.Date,
+		}
+
+		res, err := db.Exec("INSERT INTO price_changes (user_id, product_id, receipt_id, receipt_item_id, supermarket, previous_price, price, change_percent, previous_date, change_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			change.UserID, change.ProductID, change.ReceiptID, change.ReceiptItemID, change.Supermarket, change.PreviousPrice, change.Price, change.ChangePercent, change.PreviousDate.Format(time.RFC3339), change.Date.Format(time.RFC3339))
+		if err != nil {
+			return nil, err
+		}
+
+		change.ID, err = res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// Return list of price changes detected for given user, newest first
+func FindAllPriceChangesForUser(db *sql.DB, user *User, filters *PriceChangeFilter) (*[]PriceChange, error) {
+	var parameters []interface{}
+	parameters = append(parameters, user.ID)
+
+	var conditions []string
+	var limit, offset string
+
+	if filters != nil {
+		// Product
+		if len(filters.Product) > 0 {
+			parameters = append(parameters, fmt.Sprintf("%%%s%%", NormalizeProductName(filters.Product)))
+			conditions = append(conditions, "products.name LIKE ?")
+		}
+
+		// Supermarket
+		if len(filters.Supermarket) > 0 {
+			parameters = append(parameters, fmt.Sprintf("%%%s%%", filters.Supermarket))
+			conditions = append(conditions, "price_changes.supermarket LIKE ?")
+		}
+
+		// Direction
+		switch filters.Direction {
+		case "":
+		case "up":
+			conditions = append(conditions, "price_changes.change_percent > 0")
+		case "down":
+			conditions = append(conditions, "price_changes.change_percent < 0")
+		default:
+			return nil, fmt.Errorf("Invalid direction %s", filters.Direction)
+		}
+
+		// Date
+		if filters.MinDate != nil {
+			parameters = append(parameters, filters.MinDate)
+			conditions = append(conditions, "DATE(price_changes.change_date) >= DATE(?)")
+
+			if filters.MaxDate != nil {
+				if filters.MaxDate.Before(*filters.MinDate) {
+					return nil, errors.New("MaxDate can not no lower than MinDate")
+				}
+
+				parameters = append(parameters, filters.MaxDate)
+				conditions = append(conditions, "DATE(price_changes.change_date) <= DATE(?)")
+			}
+		}
+
+		// Page and per page
+		if filters.Page > 0 && filters.PerPage > 0 {
+			limit = fmt.Sprintf("LIMIT %d", filters.PerPage)
+			if filters.Page > 1 {
+				offset = fmt.Sprintf("OFFSET %d", (filters.Page-1)*(filters.PerPage))
+			}
+		}
+	}
+
+	query := `SELECT price_changes.id, price_changes.product_id, products.name, price_changes.receipt_id, price_changes.receipt_item_id, price_changes.supermarket,
+		price_changes.previous_price, price_changes.price, price_changes.change_percent, price_changes.previous_date, price_changes.change_date
+		FROM price_changes INNER JOIN products ON products.id = price_changes.product_id WHERE price_changes.user_id = ?`
+
+	if len(conditions) > 0 {
+		query = fmt.Sprintf("%s AND %s", query, strings.Join(conditions, " AND "))
+	}
+
+	query = fmt.Sprintf("%s ORDER BY price_changes.change_date DESC, price_changes.id DESC %s %s", query, limit, offset)
+
+	rows, err := db.Query(query, parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	changes := []PriceChange{}
+
+	for rows.Next() {
+		change := PriceChange{UserID: user.ID}
+		if err := rows.Scan(&change.ID, &change.ProductID, &change.Product, &change.ReceiptID, &change.ReceiptItemID, &change.Supermarket,
+			&change.PreviousPrice, &change.Price, &change.ChangePercent, &change.PreviousDate, &change.Date); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return &changes, nil
+}
+
+// Remove price changes detected for given receipt and detect them again, used when receipt is corrected
+func RefreshPriceChanges(db *sql.DB, receipt *Receipt, threshold float64) ([]PriceChange, error) {
+	if _, err := db.Exec("DELETE FROM price_changes WHERE receipt_id = ?", receipt.ID); err != nil {
+		return nil, err
+	}
+
+	return DetectPriceChanges(db, receipt, threshold)
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveUnitPrice(t *testing.T) {
+	assert.Equal(t, 1.5, (&ReceiptItem{Quantity: 2, Price: 3, UnitPrice: 1.5}).EffectiveUnitPrice())
+	assert.Equal(t, 2.0, (&ReceiptItem{Quantity: 2, Price: 4}).EffectiveUnitPrice())
+	assert.Equal(t, 4.0, (&ReceiptItem{Price: 4}).EffectiveUnitPrice())
+}
+
+func TestDetectPriceChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+	previous_ts := ts.Add(-24 * 7 * time.Hour)
+
+	items := []ReceiptItem{
+		{ID: 1, Name: "Leche", Quantity: 1, Price: 1.2, UnitPrice: 1.2, ProductID: 1},
+		{ID: 2, Name: "Pan", Quantity: 1, Price: 1.01, UnitPrice: 1.01, ProductID: 2},
+		{ID: 3, Name: "Huevos", Quantity: 1, Price: 2, UnitPrice: 2, ProductID: 3},
+	}
+	receipt := Receipt{ID: 5, UserID: 1, Supermarket: "Any", Date: ts, Items: items}
+
+	query := regexp.QuoteMeta("SELECT receipts.receipt_date, receipt_items.quantity, receipt_items.unit_price, receipt_items.price FROM receipt_items")
+
+	// Price rise above threshold
+	mock.ExpectQuery(query).
+		WithArgs(1, "Any", 1, 5, ts.Format(time.RFC3339)).
+		WillReturnRows(mock.NewRows([]string{"receipt_date", "quantity", "unit_price", "price"}).AddRow(previous_ts, 1, 1.0, 1.0))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO price_changes")).
+		WithArgs(1, 1, 5, 1, "Any", 1.0, 1.2, 20.0, previous_ts.Format(time.RFC3339), ts.Format(time.RFC3339)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Price change below threshold
+	mock.ExpectQuery(query).
+		WithArgs(1, "Any", 2, 5, ts.Format(time.RFC3339)).
+		WillReturnRows(mock.NewRows([]string{"receipt_date", "quantity", "unit_price", "price"}).AddRow(previous_ts, 1, 1.0, 1.0))
+
+	// Never bought before
+	mock.ExpectQuery(query).
+		WithArgs(1, "Any", 3, 5, ts.Format(time.RFC3339)).
+		WillReturnRows(mock.NewRows([]string{"receipt_date", "quantity", "unit_price", "price"}))
+
+	changes, err := DetectPriceChanges(db, &receipt, 5)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s detecting price changes", err)
+	}
+
+	assert.Equal(t, 1, len(changes), "Only one price change expected")
+	assert.Equal(t, "LECHE", changes[0].Product)
+	assert.Equal(t, 20.0, changes[0].ChangePercent)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindAllPriceChangesForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+	user := User{ID: 1}
+
+	rows := mock.NewRows([]string{"id", "product_id", "name", "receipt_id", "receipt_item_id", "supermarket", "previous_price", "price", "change_percent", "previous_date", "change_date"}).
+		AddRow(1, 1, "LECHE", 5, 1, "Any", 1.0, 1.2, 20.0, ts, ts)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE price_changes.user_id = ? AND products.name LIKE ? AND price_changes.change_percent > 0 ORDER BY price_changes.change_date DESC, price_changes.id DESC LIMIT 10")).
+		WithArgs(1, "%LECHE%").
+		WillReturnRows(rows)
+
+	filters := PriceChangeFilter{Product: "leche", Direction: "up", Page: 1, PerPage: 10}
+	changes, err := FindAllPriceChangesForUser(db, &user, &filters)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting price changes", err)
+	}
+
+	assert.Equal(t, 1, len(*changes))
+	assert.Equal(t, "LECHE", (*changes)[0].Product)
+}
+
+func TestFindAllPriceChangesForUserInvalidDirection(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	filters := PriceChangeFilter{Direction: "sideways"}
+	_, err = FindAllPriceChangesForUser(db, &User{ID: 1}, &filters)
+
+	assert.NotNil(t, err, "Expected error for invalid direction")
+}
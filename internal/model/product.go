@@ -0,0 +1,221 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Product struct {
+	ID          int64   `db:"id" json:"id"`
+	Name        string  `db:"name" json:"name"`
+	Category    string  `db:"category" json:"category"`
+	PackageSize float64 `db:"package_size" json:"package_size"`
+	PackageUnit string  `db:"package_unit" json:"package_unit"`
+}
+
+// Common interface for *sql.DB and *sql.Tx, so queries can run inside or outside a transaction
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// OCR returns accented vowels inconsistently, so they are removed to match the same product
+var accentReplacer = strings.NewReplacer("Á", "A", "À", "A", "É", "E", "È", "E", "Í", "I", "Ï", "I", "Ó", "O", "Ò", "O", "Ú", "U", "Ü", "U", "Ç", "C")
+
+// Return the name used to identify the same product across receipts
+// Name is uppercased, without accents and with repeated spaces removed
+func NormalizeProductName(name string) string {
+	name = strings.ToUpper(strings.Join(strings.Fields(name), " "))
+	return accentReplacer.Replace(name)
+}
+
+// Find product for given item name or create it if it does not exist, and return product ID
+func FindOrCreateProduct(db queryer, name string) (int64, error) {
+	normalized := NormalizeProductName(name)
+
+	var id int64
+	err := db.QueryRow("SELECT id FROM products WHERE name = ?", normalized).Scan(&id)
+
+	if err == nil {
+		return id, nil
+	}
+
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// Package size is taken from name when available
+	size, unit, _ := ParsePackageSize(normalized)
+
+	res, err := db.Exec("INSERT INTO products (name, package_size, package_unit) VALUES (?, ?, ?)", normalized, size, unit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// Set package size parsed from name for products created before sizes were stored
+func FillProductPackageSizes(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, name FROM products WHERE package_size IS NULL")
+	if err != nil {
+		return err
+	}
+
+	products := []Product{}
+	for rows.Next() {
+		product := Product{}
+		if err := rows.Scan(&product.ID, &product.Name); err != nil {
+			rows.Close()
+			return err
+		}
+		products = append(products, product)
+	}
+	rows.Close()
+
+	for _, product := range products {
+		size, unit, _ := ParsePackageSize(product.Name)
+		if _, err := db.Exec("UPDATE products SET package_size = ?, package_unit = ? WHERE id = ?", size, unit, product.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Link every receipt item without product to the product matching its name
+func LinkReceiptItemsToProducts(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, name FROM receipt_items WHERE product_id IS NULL")
+	if err != nil {
+		return err
+	}
+
+	items := []ReceiptItem{}
+	for rows.Next() {
+		item := ReceiptItem{}
+		var name sql.NullString
+		if err := rows.Scan(&item.ID, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		item.Name = name.String
+		items = append(items, item)
+	}
+	rows.Close()
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, item := range items {
+		product_id, err := FindOrCreateProduct(tx, item.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("UPDATE receipt_items SET product_id = ? WHERE id = ?", product_id, item.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Return list of products bought by given user, optionally filtered by name
+func FindAllProductsForUser(db *sql.DB, user *User, name string) (*[]Product, error) {
+	var parameters []interface{}
+	parameters = append(parameters, user.ID)
+
+	query := `SELECT DISTINCT products.id, products.name, products.category, products.package_size, products.package_unit FROM products
+		INNER JOIN receipt_items ON receipt_items.product_id = products.id
+		INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+		WHERE ` + receiptReadAccess + ` AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL`
+
+	if len(name) > 0 {
+		query = fmt.Sprintf("%s AND products.name LIKE ?", query)
+		parameters = append(parameters, fmt.Sprintf("%%%s%%", NormalizeProductName(name)))
+	}
+
+	query = fmt.Sprintf("%s ORDER BY products.name", query)
+
+	rows, err := db.Query(query, parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	products := []Product{}
+
+	for rows.Next() {
+		product := Product{}
+		var category, package_unit sql.NullString
+		var package_size sql.NullFloat64
+		if err := rows.Scan(&product.ID, &product.Name, &category, &package_size, &package_unit); err != nil {
+			return nil, err
+		}
+		product.Category = category.String
+		product.PackageSize = package_size.Float64
+		product.PackageUnit = package_unit.String
+		products = append(products, product)
+	}
+
+	return &products, nil
+}
+
+// Set category for given product, used in statistics of every user
+func UpdateProductCategory(db *sql.DB, product_id int64, category string) error {
+	res, err := db.Exec("UPDATE products SET category = ? WHERE id = ?", strings.TrimSpace(category), product_id)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Set package size for given product, for products whose name does not include it
+// Size is used to detect shrinkflation for every user
+func UpdateProductPackageSize(db *sql.DB, product_id int64, size float64, unit string) error {
+	if size < 0 {
+		return errors.New("Package size can not be negative")
+	}
+
+	if unit != UnitGrams && unit != UnitMillilitres && unit != UnitUnits {
+		return fmt.Errorf("Invalid package unit %s", unit)
+	}
+
+	res, err := db.Exec("UPDATE products SET package_size = ?, package_unit = ? WHERE id = ?", size, unit, product_id)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
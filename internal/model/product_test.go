@@ -0,0 +1,190 @@
+package model
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeProductName(t *testing.T) {
+	assert.Equal(t, "LECHE ENTERA", NormalizeProductName("  leche   entera "))
+	assert.Equal(t, "PLATANO DE CANARIAS", NormalizeProductName("Plátano de Canarias"))
+	assert.Equal(t, "PIÑA", NormalizeProductName("piña"))
+}
+
+func TestFindOrCreateProductExisting(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("LECHE ENTERA").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(3))
+
+	product_id, err := FindOrCreateProduct(db, "Leche entera")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s finding product", err)
+	}
+
+	assert.Equal(t, int64(3), product_id)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindOrCreateProductNew(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("LECHE ENTERA 1,5L").
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO products (name, package_size, package_unit) VALUES (?, ?, ?)")).
+		WithArgs("LECHE ENTERA 1,5L", 1500.0, UnitMillilitres).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	product_id, err := FindOrCreateProduct(db, "leche entera 1,5L")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating product", err)
+	}
+
+	assert.Equal(t, int64(7), product_id)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLinkReceiptItemsToProducts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name FROM receipt_items WHERE product_id IS NULL")).
+		WillReturnRows(mock.NewRows([]string{"id", "name"}).AddRow(10, "pan"))
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("PAN").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipt_items SET product_id = ? WHERE id = ?")).
+		WithArgs(2, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	if err := LinkReceiptItemsToProducts(db); err != nil {
+		t.Fatalf("Unexpected error %s linking items", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindAllProductsForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+
+	rows := mock.NewRows([]string{"id", "name", "category", "package_size", "package_unit"}).
+		AddRow(1, "LECHE ENTERA 1L", "dairy", 1000.0, UnitMillilitres).
+		AddRow(2, "LECHE SEMI", nil, nil, nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND products.name LIKE ? ORDER BY products.name")).
+		WithArgs(1, "%LECHE%").
+		WillReturnRows(rows)
+
+	products, err := FindAllProductsForUser(db, &user, "leche")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting products", err)
+	}
+
+	assert.Equal(t, 2, len(*products))
+	assert.Equal(t, "dairy", (*products)[0].Category)
+	assert.Equal(t, 1000.0, (*products)[0].PackageSize)
+	assert.Equal(t, "", (*products)[1].Category)
+}
+
+func TestUpdateProductCategoryNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET category = ? WHERE id = ?")).
+		WithArgs("dairy", 5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = UpdateProductCategory(db, 5, " dairy ")
+
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestFillProductPackageSizes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name FROM products WHERE package_size IS NULL")).
+		WillReturnRows(mock.NewRows([]string{"id", "name"}).AddRow(1, "ARROZ 1KG").AddRow(2, "PAN"))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET package_size = ?, package_unit = ? WHERE id = ?")).
+		WithArgs(1000.0, UnitGrams, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET package_size = ?, package_unit = ? WHERE id = ?")).
+		WithArgs(0.0, "", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := FillProductPackageSizes(db); err != nil {
+		t.Fatalf("Unexpected error %s filling package sizes", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateProductPackageSizeInvalidUnit(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	err = UpdateProductPackageSize(db, 1, 500, "oz")
+
+	assert.NotNil(t, err, "Expected error for invalid unit")
+}
@@ -0,0 +1,216 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type ReceiptChange struct {
+	ID            int64     `db:"id" json:"id"`
+	ReceiptID     int64     `db:"receipt_id" json:"receipt_id"`
+	ReceiptItemID int64     `db:"receipt_item_id" json:"receipt_item_id,omitempty"`
+	UserID        int64     `db:"user_id" json:"user_id"`
+	Action        string    `db:"action" json:"action"`
+	Field         string    `db:"field" json:"field,omitempty"`
+	OldValue      string    `db:"old_value" json:"old_value,omitempty"`
+	NewValue      string    `db:"new_value" json:"new_value,omitempty"`
+	Date          time.Time `db:"change_date" json:"date"`
+}
+
+// Actions recorded in receipt history
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionReparse = "reparse"
+)
+
+// Return value as stored in receipt history
+func formatChangeValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format("2006-01-02")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Store a change made by given user to a receipt or one of its items
+func recordReceiptChange(db queryer, change *ReceiptChange) error {
+	if change.Date.IsZero() {
+		change.Date = time.Now().UTC()
+	}
+
+	var item_id interface{}
+	if change.ReceiptItemID > 0 {
+		item_id = change.ReceiptItemID
+	}
+
+	res, err := db.Exec("INSERT INTO receipt_changes (receipt_id, receipt_item_id, user_id, action, field, old_value, new_value, change_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		change.ReceiptID, item_id, change.UserID, change.Action, change.Field, change.OldValue, change.NewValue, change.Date.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	change.ID, err = res.LastInsertId()
+	return err
+}
+
+// Store a field update only if its value changed
+func recordFieldChange(db queryer, receipt_id int64, item_id int64, user_id int64, field string, old_value interface{}, new_value interface{}) error {
+	old_string, new_string := formatChangeValue(old_value), formatChangeValue(new_value)
+	if old_string == new_string {
+		return nil
+	}
+
+	return recordReceiptChange(db, &ReceiptChange{ReceiptID: receipt_id, ReceiptItemID: item_id, UserID: user_id, Action: ActionUpdate, Field: field, OldValue: old_string, NewValue: new_string})
+}
+
+// Store values of a new item, so values read from the receipt can be compared with later changes
+func recordItemValues(db queryer, receipt_id int64, user_id int64, action string, item *ReceiptItem) error {
+	for _, field := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"name", item.Name},
+		{"quantity", item.Quantity},
+		{"unit_price", item.UnitPrice},
+		{"price", item.Price},
+	} {
+		change := ReceiptChange{ReceiptID: receipt_id, ReceiptItemID: item.ID, UserID: user_id, Action: action, Field: field.name, NewValue: formatChangeValue(field.value)}
+		if err := recordReceiptChange(db, &change); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return every change made to given receipt and its items, oldest first
+// Deleted receipts still have history, so it can be checked before restoring them
+func FindReceiptHistoryForUser(db *sql.DB, receipt_id int64, user_id int64) (*[]ReceiptChange, error) {
+	var id int64
+	if err := db.QueryRow("SELECT id FROM receipts WHERE id = ? AND "+receiptReadAccess, receipt_id, user_id).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT id, receipt_id, receipt_item_id, user_id, action, field, old_value, new_value, change_date FROM receipt_changes
+		WHERE receipt_id = ? ORDER BY change_date, id`, receipt_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	changes := []ReceiptChange{}
+
+	for rows.Next() {
+		change := ReceiptChange{}
+		var item_id sql.NullInt64
+		var field, old_value, new_value sql.NullString
+
+		if err := rows.Scan(&change.ID, &change.ReceiptID, &item_id, &change.UserID, &change.Action, &field, &old_value, &new_value, &change.Date); err != nil {
+			return nil, err
+		}
+
+		change.ReceiptItemID = item_id.Int64
+		change.Field = field.String
+		change.OldValue = old_value.String
+		change.NewValue = new_value.String
+		changes = append(changes, change)
+	}
+
+	return &changes, nil
+}
+
+// Restore a deleted receipt owned by user
+func RestoreReceipt(db *sql.DB, receipt_id int64, user_id int64) (*Receipt, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE receipts SET deleted_at = NULL WHERE id = ? AND "+receiptWriteAccess+" AND deleted_at IS NOT NULL", receipt_id, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := recordReceiptChange(tx, &ReceiptChange{ReceiptID: receipt_id, UserID: user_id, Action: ActionRestore}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return FindReceiptForUser(db, int(receipt_id), int(user_id))
+}
+
+// Restore a deleted item from receipt owned by user, and recalculate receipt total
+func RestoreReceiptItem(db *sql.DB, receipt_id int64, item_id int64, user_id int64) (*ReceiptItem, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := checkReceiptAccess(tx, receipt_id, user_id); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec("UPDATE receipt_items SET deleted_at = NULL WHERE id = ? AND receipt_id = ? AND deleted_at IS NOT NULL", item_id, receipt_id)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	item := ReceiptItem{ID: item_id, ReceiptID: receipt_id}
+	var product_id sql.NullInt64
+
+	err = tx.QueryRow("SELECT name, quantity, unit_price, price, product_id FROM receipt_items WHERE id = ?", item_id).
+		Scan(&item.Name, &item.Quantity, &item.UnitPrice, &item.Price, &product_id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.ProductID = product_id.Int64
+
+	if err := recordReceiptChange(tx, &ReceiptChange{ReceiptID: receipt_id, ReceiptItemID: item_id, UserID: user_id, Action: ActionRestore}); err != nil {
+		return nil, err
+	}
+
+	if err := recalculateReceiptTotal(tx, receipt_id, user_id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Expect a create or reparse change to be recorded for every value of given item
+func expectItemValues(mock sqlmock.Sqlmock, receipt_id int64, item_id int64, user_id int64, action string, item ReceiptItem) {
+	for _, field := range [][]interface{}{{"name", item.Name}, {"quantity", item.Quantity}, {"unit_price", item.UnitPrice}, {"price", item.Price}} {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+			WithArgs(receipt_id, item_id, user_id, action, field[0], "", formatChangeValue(field[1]), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+}
+
+// Expect values of a new receipt and its items to be recorded, items having consecutive ids from first_item_id
+func expectReceiptValues(mock sqlmock.Sqlmock, receipt_id int64, first_item_id int64, receipt Receipt) {
+	for _, field := range [][]interface{}{{"supermarket", receipt.Supermarket}, {"date", receipt.Date}, {"currency", receipt.Currency}, {"total", receipt.Total}} {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+			WithArgs(receipt_id, nil, receipt.UserID, ActionCreate, field[0], "", formatChangeValue(field[1]), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	for index, item := range receipt.Items {
+		expectItemValues(mock, receipt_id, first_item_id+int64(index), receipt.UserID, ActionCreate, item)
+	}
+}
+
+func TestFindReceiptHistoryForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_changes WHERE receipt_id = ? ORDER BY change_date, id")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"id", "receipt_id", "receipt_item_id", "user_id", "action", "field", "old_value", "new_value", "change_date"}).
+			AddRow(1, 1, nil, 2, ActionCreate, "source", "", SourceScan, ts).
+			AddRow(2, 1, 5, 2, ActionUpdate, "price", "1.2", "1.25", ts))
+
+	changes, err := FindReceiptHistoryForUser(db, 1, 2)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting receipt history", err)
+	}
+
+	assert.Equal(t, 2, len(*changes))
+	assert.Equal(t, int64(0), (*changes)[0].ReceiptItemID)
+	assert.Equal(t, int64(5), (*changes)[1].ReceiptItemID)
+	assert.Equal(t, "1.2", (*changes)[1].OldValue)
+	assert.Equal(t, "1.25", (*changes)[1].NewValue)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindReceiptHistoryForOtherUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)")).
+		WithArgs(1, 3).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	_, err = FindReceiptHistoryForUser(db, 1, 3)
+
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRestoreReceiptNotDeleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET deleted_at = NULL WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member')) AND deleted_at IS NOT NULL")).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectRollback()
+
+	_, err = RestoreReceipt(db, 1, 2)
+
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRestoreReceiptItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member')) AND deleted_at IS NULL")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipt_items SET deleted_at = NULL WHERE id = ? AND receipt_id = ? AND deleted_at IS NOT NULL")).
+		WithArgs(5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, quantity, unit_price, price, product_id FROM receipt_items WHERE id = ?")).
+		WithArgs(5).
+		WillReturnRows(mock.NewRows([]string{"name", "quantity", "unit_price", "price", "product_id"}).AddRow("Pan", 1, 1.2, 1.2, 4))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, 5, 2, ActionRestore, "", "", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT total FROM receipts WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"total"}).AddRow(2.0))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_items WHERE receipt_id = ? AND deleted_at IS NULL")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"total"}).AddRow(3.2))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET total = ? WHERE id = ?")).
+		WithArgs(3.2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, nil, 2, ActionUpdate, "total", "2", "3.2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	mock.ExpectCommit()
+
+	item, err := RestoreReceiptItem(db, 1, 5, 2)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s restoring item", err)
+	}
+
+	assert.Equal(t, "Pan", item.Name)
+	assert.Equal(t, int64(4), item.ProductID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
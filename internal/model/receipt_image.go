@@ -0,0 +1,102 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Store path and size of original file receipt was read from
+func SetReceiptImage(db *sql.DB, receipt_id int64, image_path string, image_size int64) error {
+	_, err := db.Exec("UPDATE receipts SET image_path = ?, image_size = ? WHERE id = ?", image_path, image_size, receipt_id)
+	return err
+}
+
+// Return path of original file of receipt, or sql.ErrNoRows if it was not kept
+func FindReceiptImage(db *sql.DB, receipt_id int64) (string, error) {
+	var image_path sql.NullString
+	if err := db.QueryRow("SELECT image_path FROM receipts WHERE id = ? AND deleted_at IS NULL", receipt_id).Scan(&image_path); err != nil {
+		return "", err
+	}
+
+	if len(image_path.String) == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return image_path.String, nil
+}
+
+// Replace values and items of a receipt with the ones read again from its original file
+// Previous items are marked as deleted, and changes are recorded for given user
+func ReparseReceipt(db *sql.DB, receipt_id int64, user_id int64, parsed *Receipt) (*Receipt, error) {
+	supermarket, err := FindStoreChainName(db, parsed.Supermarket)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	current := Receipt{ID: receipt_id}
+	var currency sql.NullString
+
+	err = tx.QueryRow("SELECT user_id, supermarket, receipt_date, currency, total FROM receipts WHERE id = ? AND deleted_at IS NULL", receipt_id).
+		Scan(&current.UserID, &current.Supermarket, &current.Date, &currency, &current.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	current.Currency = currency.String
+
+	if _, err := tx.Exec("UPDATE receipts SET supermarket = ?, receipt_date = ?, currency = ?, total = ? WHERE id = ?",
+		supermarket, parsed.Date.Format(time.RFC3339), parsed.Currency, parsed.Total, receipt_id); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE receipt_items SET deleted_at = ? WHERE receipt_id = ? AND deleted_at IS NULL", time.Now().UTC().Format(time.RFC3339), receipt_id); err != nil {
+		return nil, err
+	}
+
+	if err := recordReceiptChange(tx, &ReceiptChange{ReceiptID: receipt_id, UserID: user_id, Action: ActionReparse}); err != nil {
+		return nil, err
+	}
+
+	for _, change := range []struct {
+		field     string
+		old_value interface{}
+		new_value interface{}
+	}{
+		{"supermarket", current.Supermarket, supermarket},
+		{"date", current.Date, parsed.Date},
+		{"currency", current.Currency, parsed.Currency},
+		{"total", current.Total, parsed.Total},
+	} {
+		if err := recordFieldChange(tx, receipt_id, 0, user_id, change.field, change.old_value, change.new_value); err != nil {
+			return nil, err
+		}
+	}
+
+	receipt := *parsed
+	receipt.ID = receipt_id
+	receipt.UserID = current.UserID
+	receipt.Supermarket = supermarket
+
+	if err := insertReceiptItems(tx, &receipt); err != nil {
+		return nil, err
+	}
+
+	for index := range receipt.Items {
+		if err := recordItemValues(tx, receipt_id, user_id, ActionReparse, &receipt.Items[index]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReparseReceipt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs("mercadona s.a.").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Mercadona"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, supermarket, receipt_date, currency, total FROM receipts WHERE id = ? AND deleted_at IS NULL")).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "supermarket", "receipt_date", "currency", "total"}).AddRow(2, "MERCAD0NA", date, "EUR", 9.5))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET supermarket = ?, receipt_date = ?, currency = ?, total = ? WHERE id = ?")).
+		WithArgs("Mercadona", date.Format(time.RFC3339), "EUR", 1.5, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipt_items SET deleted_at = ? WHERE receipt_id = ? AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(5, nil, 1, ActionReparse, "", "", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(5, nil, 1, ActionUpdate, "supermarket", "MERCAD0NA", "Mercadona", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(5, nil, 1, ActionUpdate, "total", "9.5", "1.5", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("PAN").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items")).
+		WithArgs(5, 1.0, "Pan", 0.0, 1.5, 3).
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	expectItemValues(mock, 5, 8, 1, ActionReparse, ReceiptItem{Name: "Pan", Quantity: 1, Price: 1.5})
+	mock.ExpectCommit()
+
+	parsed := Receipt{Supermarket: "MERCADONA S.A.", Date: date, Currency: "EUR", Total: 1.5, Items: []ReceiptItem{{Name: "Pan", Quantity: 1, Price: 1.5}}}
+	receipt, err := ReparseReceipt(db, 5, 1, &parsed)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s parsing receipt", err)
+	}
+
+	assert.Equal(t, int64(2), receipt.UserID)
+	assert.Equal(t, "Mercadona", receipt.Supermarket)
+	assert.Equal(t, int64(8), receipt.Items[0].ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,395 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type ReceiptUpdate struct {
+	Supermarket *string
+	Date        *time.Time
+	Currency    *string
+	Total       *float64
+	HouseholdID *int64
+}
+
+type ReceiptItemUpdate struct {
+	Name      *string
+	Quantity  *float64
+	Price     *float64
+	UnitPrice *float64
+}
+
+// Check given receipt can be changed by user and is not deleted, returning sql.ErrNoRows if not
+// Users can change their own receipts and receipts of households where they are not viewers
+func checkReceiptAccess(db queryer, receipt_id int64, user_id int64) error {
+	var id int64
+	return db.QueryRow("SELECT id FROM receipts WHERE id = ? AND "+receiptWriteAccess+" AND deleted_at IS NULL", receipt_id, user_id).Scan(&id)
+}
+
+// Set receipt total as the sum of its items prices, recording the change made by given user
+func recalculateReceiptTotal(db queryer, receipt_id int64, user_id int64) error {
+	var previous, total float64
+
+	if err := db.QueryRow("SELECT total FROM receipts WHERE id = ?", receipt_id).Scan(&previous); err != nil {
+		return err
+	}
+
+	if err := db.QueryRow("SELECT COALESCE(ROUND(SUM(price), 2), 0) FROM receipt_items WHERE receipt_id = ? AND deleted_at IS NULL", receipt_id).Scan(&total); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("UPDATE receipts SET total = ? WHERE id = ?", total, receipt_id); err != nil {
+		return err
+	}
+
+	return recordFieldChange(db, receipt_id, 0, user_id, "total", previous, total)
+}
+
+// Check item values are valid
+func validateReceiptItem(item *ReceiptItem) error {
+	if len(strings.TrimSpace(item.Name)) == 0 {
+		return errors.New("Item name can not be empty")
+	}
+
+	if item.Quantity <= 0 {
+		return errors.New("Item quantity must be greater than 0")
+	}
+
+	if item.Price < 0 || item.UnitPrice < 0 {
+		return errors.New("Item price can not be negative")
+	}
+
+	return nil
+}
+
+// Update receipt fields for given user, only fields set are changed
+func UpdateReceipt(db *sql.DB, receipt_id int64, user_id int64, update *ReceiptUpdate) (*Receipt, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	// Current values are needed to record what changed
+	current := Receipt{ID: receipt_id}
+	var currency sql.NullString
+	var household_id sql.NullInt64
+
+	err = tx.QueryRow("SELECT user_id, supermarket, receipt_date, currency, total, household_id FROM receipts WHERE id = ? AND "+receiptWriteAccess+" AND deleted_at IS NULL", receipt_id, user_id).
+		Scan(&current.UserID, &current.Supermarket, &current.Date, &currency, &current.Total, &household_id)
+	if err != nil {
+		return nil, err
+	}
+
+	current.Currency = currency.String
+	current.HouseholdID = household_id.Int64
+
+	// Receipt with changes applied must be valid as when it is created
+	updated := current
+
+	if update.Supermarket != nil {
+		updated.Supermarket = strings.TrimSpace(*update.Supermarket)
+	}
+
+	if update.Date != nil {
+		updated.Date = *update.Date
+	}
+
+	if update.Currency != nil {
+		updated.Currency = strings.ToUpper(*update.Currency)
+	}
+
+	if update.Total != nil {
+		updated.Total = *update.Total
+	}
+
+	if err := ValidateReceipt(&updated); err != nil {
+		return nil, err
+	}
+
+	// Supermarket is normalized and owner can not end up with the same receipt twice, as when it is created
+	if update.Supermarket != nil || update.Date != nil || update.Total != nil {
+		if err := CheckReceiptExists(tx, &updated); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.Supermarket != nil {
+		if _, err := tx.Exec("UPDATE receipts SET supermarket = ? WHERE id = ?", updated.Supermarket, receipt_id); err != nil {
+			return nil, err
+		}
+
+		if err := recordFieldChange(tx, receipt_id, 0, user_id, "supermarket", current.Supermarket, updated.Supermarket); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.Date != nil {
+		if _, err := tx.Exec("UPDATE receipts SET receipt_date = ? WHERE id = ?", updated.Date.Format(time.RFC3339), receipt_id); err != nil {
+			return nil, err
+		}
+
+		if err := recordFieldChange(tx, receipt_id, 0, user_id, "date", current.Date, updated.Date); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.Currency != nil {
+		if _, err := tx.Exec("UPDATE receipts SET currency = ? WHERE id = ?", updated.Currency, receipt_id); err != nil {
+			return nil, err
+		}
+
+		if err := recordFieldChange(tx, receipt_id, 0, user_id, "currency", current.Currency, updated.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.Total != nil {
+		if _, err := tx.Exec("UPDATE receipts SET total = ? WHERE id = ?", updated.Total, receipt_id); err != nil {
+			return nil, err
+		}
+
+		if err := recordFieldChange(tx, receipt_id, 0, user_id, "total", current.Total, updated.Total); err != nil {
+			return nil, err
+		}
+	}
+
+	// Receipts can be moved to a household where user can create receipts, or back to personal with 0
+	if update.HouseholdID != nil {
+		household_id := sql.NullInt64{Int64: *update.HouseholdID, Valid: *update.HouseholdID > 0}
+
+		if household_id.Valid {
+			if err := CheckHouseholdWriteAccess(tx, household_id.Int64, user_id); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := tx.Exec("UPDATE receipts SET household_id = ? WHERE id = ?", household_id, receipt_id); err != nil {
+			return nil, err
+		}
+
+		if err := recordFieldChange(tx, receipt_id, 0, user_id, "household_id", current.HouseholdID, household_id.Int64); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return FindReceiptForUser(db, int(receipt_id), int(user_id))
+}
+
+// Delete receipt owned by user and its price changes
+// Receipt is only marked as deleted, so it can be restored and its history is kept
+func DeleteReceipt(db *sql.DB, receipt_id int64, user_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := checkReceiptAccess(tx, receipt_id, user_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM price_changes WHERE receipt_id = ?", receipt_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE receipts SET deleted_at = ? WHERE id = ?", time.Now().UTC().Format(time.RFC3339), receipt_id); err != nil {
+		return err
+	}
+
+	if err := recordReceiptChange(tx, &ReceiptChange{ReceiptID: receipt_id, UserID: user_id, Action: ActionDelete}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Add a new item to receipt owned by user, and recalculate receipt total
+func CreateReceiptItem(db *sql.DB, receipt_id int64, user_id int64, item *ReceiptItem) (*ReceiptItem, error) {
+	if err := validateReceiptItem(item); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := checkReceiptAccess(tx, receipt_id, user_id); err != nil {
+		return nil, err
+	}
+
+	product_id, err := FindOrCreateProduct(tx, item.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec("INSERT INTO receipt_items (receipt_id, quantity, name, unit_price, price, product_id) VALUES (?, ?, ?, ?, ?, ?)",
+		receipt_id, item.Quantity, item.Name, item.UnitPrice, item.Price, product_id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	item.ReceiptID = receipt_id
+	item.ProductID = product_id
+
+	if err := recordItemValues(tx, receipt_id, user_id, ActionCreate, item); err != nil {
+		return nil, err
+	}
+
+	if err := recalculateReceiptTotal(tx, receipt_id, user_id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// Update item from receipt owned by user, only fields set are changed, and recalculate receipt total
+func UpdateReceiptItem(db *sql.DB, receipt_id int64, item_id int64, user_id int64, update *ReceiptItemUpdate) (*ReceiptItem, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := checkReceiptAccess(tx, receipt_id, user_id); err != nil {
+		return nil, err
+	}
+
+	item := ReceiptItem{ID: item_id, ReceiptID: receipt_id}
+	var product_id sql.NullInt64
+
+	err = tx.QueryRow("SELECT name, quantity, unit_price, price, product_id FROM receipt_items WHERE id = ? AND receipt_id = ? AND deleted_at IS NULL", item_id, receipt_id).
+		Scan(&item.Name, &item.Quantity, &item.UnitPrice, &item.Price, &product_id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.ProductID = product_id.Int64
+	previous := item
+
+	if update.Name != nil {
+		item.Name = *update.Name
+	}
+
+	if update.Quantity != nil {
+		item.Quantity = *update.Quantity
+	}
+
+	if update.Price != nil {
+		item.Price = *update.Price
+	}
+
+	if update.UnitPrice != nil {
+		item.UnitPrice = *update.UnitPrice
+	}
+
+	if err := validateReceiptItem(&item); err != nil {
+		return nil, err
+	}
+
+	// A new name can be a different product
+	if update.Name != nil {
+		item.ProductID, err = FindOrCreateProduct(tx, item.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE receipt_items SET name = ?, quantity = ?, unit_price = ?, price = ?, product_id = ? WHERE id = ?",
+		item.Name, item.Quantity, item.UnitPrice, item.Price, item.ProductID, item_id)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []struct {
+		name      string
+		old_value interface{}
+		new_value interface{}
+	}{
+		{"name", previous.Name, item.Name},
+		{"quantity", previous.Quantity, item.Quantity},
+		{"unit_price", previous.UnitPrice, item.UnitPrice},
+		{"price", previous.Price, item.Price},
+	}
+
+	for _, field := range fields {
+		if err := recordFieldChange(tx, receipt_id, item_id, user_id, field.name, field.old_value, field.new_value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recalculateReceiptTotal(tx, receipt_id, user_id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// Delete item from receipt owned by user, and recalculate receipt total
+// Item is only marked as deleted, so it can be restored
+func DeleteReceiptItem(db *sql.DB, receipt_id int64, item_id int64, user_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := checkReceiptAccess(tx, receipt_id, user_id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("UPDATE receipt_items SET deleted_at = ? WHERE id = ? AND receipt_id = ? AND deleted_at IS NULL", time.Now().UTC().Format(time.RFC3339), item_id, receipt_id)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec("DELETE FROM price_changes WHERE receipt_item_id = ?", item_id); err != nil {
+		return err
+	}
+
+	if err := recordReceiptChange(tx, &ReceiptChange{ReceiptID: receipt_id, ReceiptItemID: item_id, UserID: user_id, Action: ActionDelete}); err != nil {
+		return err
+	}
+
+	if err := recalculateReceiptTotal(tx, receipt_id, user_id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,361 @@
+package model
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateReceipt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+	supermarket := " Other "
+	total := 50.5
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, supermarket, receipt_date, currency, total, household_id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member')) AND deleted_at IS NULL")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"user_id", "supermarket", "receipt_date", "currency", "total", "household_id"}).AddRow(2, "Any", ts, "EUR", 50.5, nil))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs("other").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	// Receipt itself is not a duplicate
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts WHERE supermarket LIKE ? AND DATE(receipt_date) = DATE(?) AND total = ? AND id <> ?")).
+		WithArgs("%Other%", ts.Format(time.RFC3339), 50.5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET supermarket = ? WHERE id = ?")).
+		WithArgs("Other", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes (receipt_id, receipt_item_id, user_id, action, field, old_value, new_value, change_date)")).
+		WithArgs(1, nil, 2, ActionUpdate, "supermarket", "Any", "Other", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Total has not changed, so no change is recorded
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET total = ? WHERE id = ?")).
+		WithArgs(50.5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, household_id, supermarket, receipt_date, currency, total, source FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id)")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "household_id", "supermarket", "receipt_date", "currency", "total", "source"}).AddRow(1, 2, nil, "Other", ts, "EUR", 50.5, SourceManual))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_items WHERE receipt_id = ?")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"id", "quantity", "name", "unit_price", "price", "product_id"}))
+
+	receipt, err := UpdateReceipt(db, 1, 2, &ReceiptUpdate{Supermarket: &supermarket, Total: &total})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s updating receipt", err)
+	}
+
+	assert.Equal(t, "Other", receipt.Supermarket)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateReceiptDuplicated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	ts := time.Now()
+	supermarket := "MERCADONA S.A."
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, supermarket, receipt_date, currency, total, household_id FROM receipts WHERE id = ?")).
+		WithArgs(1, 3).
+		WillReturnRows(mock.NewRows([]string{"user_id", "supermarket", "receipt_date", "currency", "total", "household_id"}).AddRow(2, "Any", ts, "EUR", 50.5, 4))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM store_chains")).
+		WithArgs("mercadona s.a.").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Mercadona"))
+
+	// Duplicates are checked for receipt owner, not for the member editing it
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, supermarket, receipt_date, currency, total FROM receipts")).
+		WithArgs("%Mercadona%", ts.Format(time.RFC3339), 50.5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "supermarket", "receipt_date", "currency", "total"}).AddRow(7, 2, "Mercadona", ts, "EUR", 50.5))
+
+	mock.ExpectRollback()
+
+	_, err = UpdateReceipt(db, 1, 3, &ReceiptUpdate{Supermarket: &supermarket})
+
+	assert.Equal(t, ErrReceiptExists, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateReceiptInvalid(t *testing.T) {
+	future := time.Now().AddDate(0, 0, 7)
+	currency := "euro"
+
+	for _, update := range []ReceiptUpdate{{Date: &future}, {Currency: &currency}} {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Unexpected error %s connecting to database", err)
+		}
+
+		mock.ExpectBegin()
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, supermarket, receipt_date, currency, total, household_id FROM receipts WHERE id = ?")).
+			WithArgs(1, 2).
+			WillReturnRows(mock.NewRows([]string{"user_id", "supermarket", "receipt_date", "currency", "total", "household_id"}).AddRow(2, "Any", time.Now(), "EUR", 50.5, nil))
+
+		mock.ExpectRollback()
+
+		_, err = UpdateReceipt(db, 1, 2, &update)
+
+		assert.NotNil(t, err, "Expected error updating receipt with invalid values")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestUpdateReceiptForOtherUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	supermarket := "Other"
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, supermarket, receipt_date, currency, total, household_id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member'))")).
+		WithArgs(1, 3).
+		WillReturnRows(mock.NewRows([]string{"user_id", "supermarket", "receipt_date", "currency", "total", "household_id"}))
+
+	mock.ExpectRollback()
+
+	_, err = UpdateReceipt(db, 1, 3, &ReceiptUpdate{Supermarket: &supermarket})
+
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteReceipt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member'))")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM price_changes WHERE receipt_id = ?")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET deleted_at = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, nil, 2, ActionDelete, "", "", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	if err := DeleteReceipt(db, 1, 2); err != nil {
+		t.Fatalf("Unexpected error %s deleting receipt", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReceiptItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member'))")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name = ?")).
+		WithArgs("PAN").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(4))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_items (receipt_id, quantity, name, unit_price, price, product_id) VALUES (?, ?, ?, ?, ?, ?)")).
+		WithArgs(1, 2.0, "Pan", 0.5, 1.0, 4).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+
+	expectItemValues(mock, 1, 9, 2, ActionCreate, ReceiptItem{Name: "Pan", Quantity: 2, Price: 1.0, UnitPrice: 0.5})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT total FROM receipts WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"total"}).AddRow(3.0))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(ROUND(SUM(price), 2), 0) FROM receipt_items WHERE receipt_id = ? AND deleted_at IS NULL")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"total"}).AddRow(4.0))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET total = ? WHERE id = ?")).
+		WithArgs(4.0, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, nil, 2, ActionUpdate, "total", "3", "4", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	mock.ExpectCommit()
+
+	item, err := CreateReceiptItem(db, 1, 2, &ReceiptItem{Name: "Pan", Quantity: 2, Price: 1.0, UnitPrice: 0.5})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating item", err)
+	}
+
+	assert.Equal(t, int64(9), item.ID)
+	assert.Equal(t, int64(4), item.ProductID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReceiptItemInvalid(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = CreateReceiptItem(db, 1, 2, &ReceiptItem{Name: " ", Quantity: 1, Price: 1.0})
+	assert.NotNil(t, err, "Expected error for empty name")
+
+	_, err = CreateReceiptItem(db, 1, 2, &ReceiptItem{Name: "Pan", Quantity: 0, Price: 1.0})
+	assert.NotNil(t, err, "Expected error for zero quantity")
+}
+
+func TestUpdateReceiptItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	price := 1.25
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member'))")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, quantity, unit_price, price, product_id FROM receipt_items WHERE id = ? AND receipt_id = ?")).
+		WithArgs(5, 1).
+		WillReturnRows(mock.NewRows([]string{"name", "quantity", "unit_price", "price", "product_id"}).AddRow("Pan", 1, 1.2, 1.2, 4))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipt_items SET name = ?, quantity = ?, unit_price = ?, price = ?, product_id = ? WHERE id = ?")).
+		WithArgs("Pan", 1.0, 1.2, 1.25, 4, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipt_changes")).
+		WithArgs(1, 5, 2, ActionUpdate, "price", "1.2", "1.25", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Total has not changed, so no change is recorded
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT total FROM receipts WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"total"}).AddRow(1.25))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_items WHERE receipt_id = ? AND deleted_at IS NULL")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows([]string{"total"}).AddRow(1.25))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipts SET total = ? WHERE id = ?")).
+		WithArgs(1.25, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	item, err := UpdateReceiptItem(db, 1, 5, 2, &ReceiptItemUpdate{Price: &price})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s updating item", err)
+	}
+
+	assert.Equal(t, 1.25, item.Price)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteReceiptItemNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM receipts WHERE id = ? AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id AND role IN ('owner', 'member'))")).
+		WithArgs(1, 2).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE receipt_items SET deleted_at = ? WHERE id = ? AND receipt_id = ? AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), 5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectRollback()
+
+	err = DeleteReceiptItem(db, 1, 5, 2)
+
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Sources a scan can be requested from
+const (
+	ScanSourceUpload  = "upload"
+	ScanSourceBatch   = "batch"
+	ScanSourceWatch   = "watch"
+	ScanSourceEmail   = "email"
+	ScanSourceReparse = "reparse"
+)
+
+// File analyzed by Textract, with pages charged and their estimated cost
+type Scan struct {
+	ID     int64     `json:"id"`
+	UserID int64     `json:"-"`
+	Source string    `json:"source"`
+	Pages  int64     `json:"pages"`
+	Cost   float64   `json:"cost"`
+	Date   time.Time `json:"date"`
+}
+
+// Scans, pages and estimated cost in a period
+type ScanUsage struct {
+	Scans int64   `json:"scans"`
+	Pages int64   `json:"pages"`
+	Cost  float64 `json:"cost"`
+}
+
+func RecordScan(db *sql.DB, scan *Scan) error {
+	if scan.Date.IsZero() {
+		scan.Date = time.Now().UTC()
+	}
+
+	res, err := db.Exec("INSERT INTO scans (user_id, source, pages, cost, scan_date) VALUES (?, ?, ?, ?, ?)",
+		scan.UserID, scan.Source, scan.Pages, scan.Cost, scan.Date.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	scan.ID, err = res.LastInsertId()
+	return err
+}
+
+// Return usage of user between given dates, including from date and excluding to date
+// Usage of every user is returned for user 0
+func FindScanUsage(db *sql.DB, user_id int64, from time.Time, to time.Time) (*ScanUsage, error) {
+	query := "SELECT COUNT(*), COALESCE(SUM(pages), 0), COALESCE(SUM(cost), 0) FROM scans WHERE scan_date >= ? AND scan_date < ?"
+	parameters := []interface{}{from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)}
+
+	if user_id > 0 {
+		query += " AND user_id = ?"
+		parameters = append(parameters, user_id)
+	}
+
+	usage := ScanUsage{}
+	if err := db.QueryRow(query, parameters...).Scan(&usage.Scans, &usage.Pages, &usage.Cost); err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+// Return every scan of user, oldest first
+func FindScansForUser(db *sql.DB, user_id int64) (*[]Scan, error) {
+	rows, err := db.Query("SELECT id, source, pages, cost, scan_date FROM scans WHERE user_id = ? ORDER BY scan_date, id", user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	scans := []Scan{}
+
+	for rows.Next() {
+		scan := Scan{UserID: user_id}
+		if err := rows.Scan(&scan.ID, &scan.Source, &scan.Pages, &scan.Cost, &scan.Date); err != nil {
+			return nil, err
+		}
+
+		scans = append(scans, scan)
+	}
+
+	return &scans, rows.Err()
+}
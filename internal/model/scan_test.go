@@ -0,0 +1,70 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordScan(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scans (user_id, source, pages, cost, scan_date) VALUES (?, ?, ?, ?, ?)")).
+		WithArgs(1, ScanSourceUpload, 2, 0.02, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+
+	scan := Scan{UserID: 1, Source: ScanSourceUpload, Pages: 2, Cost: 0.02}
+
+	if err := RecordScan(db, &scan); err != nil {
+		t.Fatalf("Unexpected error %s recording scan", err)
+	}
+
+	assert.Equal(t, int64(4), scan.ID)
+	assert.False(t, scan.Date.IsZero())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindScanUsage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	query := "SELECT COUNT(*), COALESCE(SUM(pages), 0), COALESCE(SUM(cost), 0) FROM scans WHERE scan_date >= ? AND scan_date < ?"
+
+	mock.ExpectQuery(regexp.QuoteMeta(query+" AND user_id = ?")).
+		WithArgs("2024-03-01T00:00:00Z", "2024-04-01T00:00:00Z", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"scans", "pages", "cost"}).AddRow(3, 4, 0.04))
+
+	// Usage of every user
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs("2024-03-01T00:00:00Z", "2024-04-01T00:00:00Z").
+		WillReturnRows(sqlmock.NewRows([]string{"scans", "pages", "cost"}).AddRow(5, 7, 0.07))
+
+	usage, err := FindScanUsage(db, 1, from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, ScanUsage{Scans: 3, Pages: 4, Cost: 0.04}, *usage)
+
+	usage, err = FindScanUsage(db, 0, from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, ScanUsage{Scans: 5, Pages: 7, Cost: 0.07}, *usage)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,189 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var ErrInvalidRefreshToken = errors.New("Invalid or expired refresh token")
+
+// Login session of a user, kept alive with a refresh token
+type Session struct {
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"-"`
+	UserAgent    string    `json:"user_agent"`
+	IP           string    `json:"ip"`
+	CreatedDate  time.Time `json:"created_date"`
+	LastUsedDate time.Time `json:"last_used_date"`
+	ExpiresDate  time.Time `json:"expires_date"`
+	Current      bool      `json:"current"`
+}
+
+// Return a new random refresh token and its hash, only the hash is stored
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// Return SHA-256 hash of a random token, used to store and find tokens without keeping them
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create a session for user, returning it with its refresh token
+func CreateSession(db *sql.DB, user_id int64, user_agent string, ip string, ttl time.Duration) (*Session, string, error) {
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := Session{UserID: user_id, UserAgent: user_agent, IP: ip, CreatedDate: now, LastUsedDate: now, ExpiresDate: now.Add(ttl)}
+
+	res, err := db.Exec("INSERT INTO sessions (user_id, token_hash, user_agent, ip, created_date, last_used_date, expires_date) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		session.UserID, hash, session.UserAgent, session.IP, session.CreatedDate, session.LastUsedDate, session.ExpiresDate)
+	if err != nil {
+		return nil, "", err
+	}
+
+	session.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &session, token, nil
+}
+
+// Rotate refresh token of its session, returning the session with a new refresh token
+// Using a refresh token which was already rotated revokes its session, as it may have been stolen
+func RefreshSession(db *sql.DB, token string, ip string, ttl time.Duration) (*Session, string, error) {
+	hash := hashToken(token)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer tx.Rollback()
+
+	session := Session{}
+	var revoked_at sql.NullTime
+
+	err = tx.QueryRow("SELECT id, user_id, user_agent, created_date, expires_date, revoked_at FROM sessions WHERE token_hash = ?", hash).
+		Scan(&session.ID, &session.UserID, &session.UserAgent, &session.CreatedDate, &session.ExpiresDate, &revoked_at)
+
+	if err == sql.ErrNoRows {
+		if _, err := tx.Exec("UPDATE sessions SET revoked_at = ? WHERE previous_token_hash = ? AND revoked_at IS NULL", time.Now(), hash); err != nil {
+			return nil, "", err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if revoked_at.Valid || time.Now().After(session.ExpiresDate) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	new_token, new_hash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	session.IP = ip
+	session.LastUsedDate = time.Now()
+	session.ExpiresDate = session.LastUsedDate.Add(ttl)
+
+	if _, err := tx.Exec("UPDATE sessions SET token_hash = ?, previous_token_hash = ?, ip = ?, last_used_date = ?, expires_date = ? WHERE id = ?",
+		new_hash, hash, session.IP, session.LastUsedDate, session.ExpiresDate, session.ID); err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+
+	return &session, new_token, nil
+}
+
+// Check session of user is not revoked nor expired, returning sql.ErrNoRows if it is
+func CheckSessionActive(db *sql.DB, session_id int64, user_id int64) error {
+	var expires_date time.Time
+	if err := db.QueryRow("SELECT expires_date FROM sessions WHERE id = ? AND user_id = ? AND revoked_at IS NULL", session_id, user_id).Scan(&expires_date); err != nil {
+		return err
+	}
+
+	if time.Now().After(expires_date) {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Return sessions of user which are not revoked nor expired, most recently used first
+func FindSessionsForUser(db *sql.DB, user_id int64) (*[]Session, error) {
+	rows, err := db.Query("SELECT id, user_agent, ip, created_date, last_used_date, expires_date FROM sessions WHERE user_id = ? AND revoked_at IS NULL ORDER BY last_used_date DESC", user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := []Session{}
+
+	for rows.Next() {
+		session := Session{UserID: user_id}
+		var user_agent, ip sql.NullString
+		if err := rows.Scan(&session.ID, &user_agent, &ip, &session.CreatedDate, &session.LastUsedDate, &session.ExpiresDate); err != nil {
+			return nil, err
+		}
+
+		if time.Now().After(session.ExpiresDate) {
+			continue
+		}
+
+		session.UserAgent = user_agent.String
+		session.IP = ip.String
+		sessions = append(sessions, session)
+	}
+
+	return &sessions, rows.Err()
+}
+
+// Revoke a session of user, returning sql.ErrNoRows if it does not exist or was already revoked
+func RevokeSession(db *sql.DB, session_id int64, user_id int64) error {
+	res, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", time.Now(), session_id, user_id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Revoke every session of user, like after losing a device
+func RevokeAllSessions(db *sql.DB, user_id int64) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now(), user_id)
+	return err
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sessions (user_id, token_hash, user_agent, ip, created_date, last_used_date, expires_date) VALUES (?, ?, ?, ?, ?, ?, ?)")).
+		WithArgs(1, sqlmock.AnyArg(), "phone", "10.0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	session, token, err := CreateSession(db, 1, "phone", "10.0.0.1", time.Hour)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s creating session", err)
+	}
+
+	assert.Equal(t, int64(7), session.ID)
+	assert.NotEmpty(t, token)
+	assert.NotEqual(t, token, hashToken(token))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	hash := hashToken("token")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, user_agent, created_date, expires_date, revoked_at FROM sessions WHERE token_hash = ?")).
+		WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "user_agent", "created_date", "expires_date", "revoked_at"}).
+			AddRow(7, 1, "phone", time.Now(), time.Now().Add(time.Hour), nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions SET token_hash = ?, previous_token_hash = ?, ip = ?, last_used_date = ?, expires_date = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), hash, "10.0.0.2", sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	session, token, err := RefreshSession(db, "token", "10.0.0.2", time.Hour)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s refreshing session", err)
+	}
+
+	assert.Equal(t, int64(7), session.ID)
+	assert.Equal(t, int64(1), session.UserID)
+	assert.NotEqual(t, "token", token)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRefreshSessionReused(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	hash := hashToken("token")
+
+	// Rotated token revokes its session
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, user_agent, created_date, expires_date, revoked_at FROM sessions WHERE token_hash = ?")).
+		WithArgs(hash).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions SET revoked_at = ? WHERE previous_token_hash = ? AND revoked_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, _, err = RefreshSession(db, "token", "10.0.0.2", time.Hour)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRefreshSessionRevoked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, user_agent, created_date, expires_date, revoked_at FROM sessions WHERE token_hash = ?")).
+		WithArgs(hashToken("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "user_agent", "created_date", "expires_date", "revoked_at"}).
+			AddRow(7, 1, "phone", time.Now(), time.Now().Add(time.Hour), time.Now()))
+	mock.ExpectRollback()
+
+	_, _, err = RefreshSession(db, "token", "10.0.0.2", time.Hour)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCheckSessionActiveExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT expires_date FROM sessions WHERE id = ? AND user_id = ? AND revoked_at IS NULL")).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"expires_date"}).AddRow(time.Now().Add(-time.Minute)))
+
+	assert.Equal(t, sql.ErrNoRows, CheckSessionActive(db, 7, 1))
+}
+
+func TestRevokeSessionNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), 7, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, sql.ErrNoRows, RevokeSession(db, 7, 2))
+}
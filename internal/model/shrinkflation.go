@@ -0,0 +1,151 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Shrinkflation struct {
+	Product           string    `json:"product"`
+	Supermarket       string    `json:"supermarket"`
+	Unit              string    `json:"unit"`
+	PreviousProductID int64     `json:"previous_product_id"`
+	PreviousName      string    `json:"previous_name"`
+	PreviousSize      float64   `json:"previous_size"`
+	PreviousPrice     float64   `json:"previous_price"`
+	PreviousUnitPrice float64   `json:"previous_unit_price"`
+	PreviousDate      time.Time `json:"previous_date"`
+	ProductID         int64     `json:"product_id"`
+	Name              string    `json:"name"`
+	Size              float64   `json:"size"`
+	Price             float64   `json:"price"`
+	UnitPrice         float64   `json:"unit_price"`
+	Date              time.Time `json:"date"`
+	SizeChange        float64   `json:"size_change"`
+	PriceChange       float64   `json:"price_change"`
+	EffectiveIncrease float64   `json:"effective_increase"`
+}
+
+type ShrinkflationFilter struct {
+	Supermarket string
+	MinDate     *time.Time
+	Tolerance   float64
+}
+
+// Purchase of a product with known package size
+type sizedPurchase struct {
+	ProductID int64
+	Name      string
+	Size      float64
+	Unit      string
+	Price     float64
+	Date      time.Time
+}
+
+// Return price per kilogram or litre, or per unit for products sold by units
+func pricePerUnit(price float64, size float64, unit string) float64 {
+	if unit == UnitUnits {
+		return price / size
+	}
+
+	return price / size * 1000
+}
+
+// Find products whose package size was reduced while price per package stayed similar or rose
+// Products are matched by name without size in the same supermarket, and tolerance is the percentage
+// the package price can drop to be still considered similar
+func FindShrinkflationForUser(db *sql.DB, user *User, filters *ShrinkflationFilter) (*[]Shrinkflation, error) {
+	if filters == nil {
+		filters = &ShrinkflationFilter{}
+	}
+
+	var parameters []interface{}
+	parameters = append(parameters, user.ID)
+
+	conditions := []string{receiptReadAccess, "receipts.deleted_at IS NULL", "receipt_items.deleted_at IS NULL", "products.package_size > 0"}
+
+	if len(filters.Supermarket) > 0 {
+		conditions = append(conditions, "receipts.supermarket LIKE ?")
+		parameters = append(parameters, fmt.Sprintf("%%%s%%", filters.Supermarket))
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT receipts.supermarket, receipts.receipt_date, products.id, products.name, products.package_size, products.package_unit,
+		receipt_items.quantity, receipt_items.unit_price, receipt_items.price
+		FROM receipt_items
+		INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+		INNER JOIN products ON products.id = receipt_items.product_id
+		WHERE %s ORDER BY receipts.receipt_date, receipt_items.id`, strings.Join(conditions, " AND ")), parameters...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// Last purchase for each supermarket and product without size
+	last := map[string]sizedPurchase{}
+	found := []Shrinkflation{}
+
+	for rows.Next() {
+		var supermarket string
+		purchase := sizedPurchase{}
+		item := ReceiptItem{}
+
+		if err := rows.Scan(&supermarket, &purchase.Date, &purchase.ProductID, &purchase.Name, &purchase.Size, &purchase.Unit,
+			&item.Quantity, &item.UnitPrice, &item.Price); err != nil {
+			return nil, err
+		}
+
+		purchase.Price = item.EffectiveUnitPrice()
+		product := StripPackageSize(purchase.Name)
+		key := fmt.Sprintf("%s|%s|%s", supermarket, product, purchase.Unit)
+
+		previous, ok := last[key]
+		last[key] = purchase
+
+		if !ok || purchase.Size >= previous.Size || previous.Price <= 0 {
+			continue
+		}
+
+		// Package price dropped more than tolerance, so it is not shrinkflation
+		if purchase.Price < previous.Price*(1-filters.Tolerance/100) {
+			continue
+		}
+
+		previous_unit_price := pricePerUnit(previous.Price, previous.Size, previous.Unit)
+		unit_price := pricePerUnit(purchase.Price, purchase.Size, purchase.Unit)
+
+		if unit_price <= previous_unit_price {
+			continue
+		}
+
+		if filters.MinDate != nil && purchase.Date.Before(*filters.MinDate) {
+			continue
+		}
+
+		found = append(found, Shrinkflation{
+			Product:           product,
+			Supermarket:       supermarket,
+			Unit:              purchase.Unit,
+			PreviousProductID: previous.ProductID,
+			PreviousName:      previous.Name,
+			PreviousSize:      previous.Size,
+			PreviousPrice:     round2(previous.Price),
+			PreviousUnitPrice: round2(previous_unit_price),
+			PreviousDate:      previous.Date,
+			ProductID:         purchase.ProductID,
+			Name:              purchase.Name,
+			Size:              purchase.Size,
+			Price:             round2(purchase.Price),
+			UnitPrice:         round2(unit_price),
+			Date:              purchase.Date,
+			SizeChange:        round2((purchase.Size/previous.Size - 1) * 100),
+			PriceChange:       round2((purchase.Price/previous.Price - 1) * 100),
+			EffectiveIncrease: round2((unit_price/previous_unit_price - 1) * 100),
+		})
+	}
+
+	return &found, nil
+}
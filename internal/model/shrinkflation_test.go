@@ -0,0 +1,83 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindShrinkflationForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	ts := time.Now()
+
+	columns := []string{"supermarket", "receipt_date", "id", "name", "package_size", "package_unit", "quantity", "unit_price", "price"}
+	rows := mock.NewRows(columns).
+		// Size drops and price stays the same
+		AddRow("Any", ts.AddDate(0, -2, 0), 1, "ARROZ 1KG", 1000.0, UnitGrams, 1, 1.0, 1.0).
+		AddRow("Any", ts.AddDate(0, -1, 0), 2, "ARROZ 900G", 900.0, UnitGrams, 1, 1.0, 1.0).
+		// Size drops but price drops even more
+		AddRow("Any", ts.AddDate(0, -2, 0), 3, "ACEITE 1L", 1000.0, UnitMillilitres, 1, 10.0, 10.0).
+		AddRow("Any", ts.AddDate(0, -1, 0), 4, "ACEITE 750ML", 750.0, UnitMillilitres, 1, 7.0, 7.0).
+		// Same product in other supermarket is not compared
+		AddRow("Other", ts, 5, "ARROZ 800G", 800.0, UnitGrams, 1, 1.0, 1.0)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND products.package_size > 0 ORDER BY receipts.receipt_date, receipt_items.id")).
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	found, err := FindShrinkflationForUser(db, &user, &ShrinkflationFilter{Tolerance: 5})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s detecting shrinkflation", err)
+	}
+
+	assert.Equal(t, 1, len(*found))
+
+	shrink := (*found)[0]
+	assert.Equal(t, "ARROZ", shrink.Product)
+	assert.Equal(t, -10.0, shrink.SizeChange)
+	assert.Equal(t, 0.0, shrink.PriceChange)
+	assert.Equal(t, 1.11, shrink.UnitPrice, "Price per kilogram")
+	assert.Equal(t, 11.11, shrink.EffectiveIncrease)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindShrinkflationForUserWithoutFilters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	columns := []string{"supermarket", "receipt_date", "id", "name", "package_size", "package_unit", "quantity", "unit_price", "price"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM receipt_items")).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows(columns))
+
+	found, err := FindShrinkflationForUser(db, &User{ID: 1}, nil)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s detecting shrinkflation", err)
+	}
+
+	assert.Equal(t, 0, len(*found))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,451 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Name used for products without category
+const Uncategorized = "uncategorized"
+
+type CategoryInflation struct {
+	Category string  `json:"category"`
+	Index    float64 `json:"index"`
+	Rate     float64 `json:"rate"`
+}
+
+type InflationPeriod struct {
+	Period     string              `json:"period"`
+	Index      float64             `json:"index"`
+	Rate       float64             `json:"rate"`
+	Coverage   float64             `json:"coverage"`
+	Categories []CategoryInflation `json:"categories"`
+}
+
+type InflationIndex struct {
+	Base        string            `json:"base"`
+	Granularity string            `json:"granularity"`
+	Products    int               `json:"products"`
+	Inflation   float64           `json:"inflation"`
+	Periods     []InflationPeriod `json:"periods"`
+}
+
+type SpendingGroup struct {
+	Key           string  `json:"key"`
+	Total         float64 `json:"total"`
+	Receipts      int64   `json:"receipts"`
+	AverageBasket float64 `json:"average_basket"`
+}
+
+// SQL expressions used to group receipts for each available grouping
+// Receipt dates are days already read in timezone of user, so they are grouped without conversion
+var spendingGroups = map[string]string{
+	"day":         "strftime('%Y-%m-%d', receipt_date)",
+	"week":        "strftime('%Y-W%W', receipt_date)",
+	"month":       "strftime('%Y-%m', receipt_date)",
+	"year":        "strftime('%Y', receipt_date)",
+	"supermarket": "supermarket",
+}
+
+// Product price aggregated for a period
+type productPeriodPrice struct {
+	ProductID int64
+	Category  string
+	Period    string
+	Spent     float64
+	Quantity  float64
+}
+
+// Return key of the period which given date belongs to
+func periodKey(date time.Time, granularity string) (string, error) {
+	switch granularity {
+	case "month":
+		return date.Format("2006-01"), nil
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", date.Year(), (int(date.Month())-1)/3+1), nil
+	case "year":
+		return date.Format("2006"), nil
+	}
+
+	return "", fmt.Errorf("Invalid granularity %s", granularity)
+}
+
+// Return first day of the period which given date belongs to
+func periodStart(date time.Time, granularity string) time.Time {
+	switch granularity {
+	case "quarter":
+		return time.Date(date.Year(), time.Month((int(date.Month())-1)/3*3+1), 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// Compute a personal price index using products bought in base period as basket
+// Basket is repriced every period with the average unit price paid, keeping base quantities (Laspeyres index)
+// When a product is not bought in a period, last known price is used
+func FindInflationIndexForUser(db *sql.DB, user *User, base time.Time, granularity string) (*InflationIndex, error) {
+	base_period, err := periodKey(base, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	// Receipts are grouped by month, and months are grouped by requested granularity afterwards
+	rows, err := db.Query(`SELECT receipt_items.product_id, products.category, strftime('%Y-%m', receipts.receipt_date) AS month, SUM(receipt_items.price), SUM(receipt_items.quantity)
+		FROM receipt_items
+		INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+		INNER JOIN products ON products.id = receipt_items.product_id
+		WHERE `+receiptReadAccess+` AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND DATE(receipts.receipt_date) >= DATE(?)
+		GROUP BY receipt_items.product_id, month ORDER BY month`, user.ID, periodStart(base, granularity).Format(time.RFC3339))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	prices := map[string]map[int64]*productPeriodPrice{}
+	periods := []string{}
+
+	for rows.Next() {
+		price := productPeriodPrice{}
+		var category sql.NullString
+		var month string
+
+		if err := rows.Scan(&price.ProductID, &category, &month, &price.Spent, &price.Quantity); err != nil {
+			return nil, err
+		}
+
+		date, err := time.Parse("2006-01", month)
+		if err != nil {
+			return nil, err
+		}
+
+		price.Period, _ = periodKey(date, granularity)
+		price.Category = category.String
+		if len(price.Category) == 0 {
+			price.Category = Uncategorized
+		}
+
+		if _, ok := prices[price.Period]; !ok {
+			prices[price.Period] = map[int64]*productPeriodPrice{}
+			periods = append(periods, price.Period)
+		}
+
+		if existing, ok := prices[price.Period][price.ProductID]; ok {
+			existing.Spent += price.Spent
+			existing.Quantity += price.Quantity
+		} else {
+			prices[price.Period][price.ProductID] = &price
+		}
+	}
+
+	index := InflationIndex{Base: base_period, Granularity: granularity, Periods: []InflationPeriod{}}
+
+	basket, ok := prices[base_period]
+	if !ok {
+		return &index, nil
+	}
+
+	// Base prices and quantities
+	base_prices := map[int64]float64{}
+	base_quantities := map[int64]float64{}
+	categories := map[string]bool{}
+
+	for product_id, price := range basket {
+		if price.Quantity <= 0 || price.Spent <= 0 {
+			continue
+		}
+		base_prices[product_id] = price.Spent / price.Quantity
+		base_quantities[product_id] = price.Quantity
+		categories[price.Category] = true
+	}
+
+	index.Products = len(base_prices)
+
+	category_names := []string{}
+	for category := range categories {
+		category_names = append(category_names, category)
+	}
+	sort.Strings(category_names)
+
+	// Last known price for each product
+	current_prices := map[int64]float64{}
+	for product_id, price := range base_prices {
+		current_prices[product_id] = price
+	}
+
+	previous_index := 100.0
+	previous_categories := map[string]float64{}
+
+	for _, period := range periods {
+		observed := 0.0
+		base_cost := 0.0
+		cost := 0.0
+		category_base_cost := map[string]float64{}
+		category_cost := map[string]float64{}
+
+		for product_id, base_price := range base_prices {
+			if price, ok := prices[period][product_id]; ok && price.Quantity > 0 && price.Spent > 0 {
+				current_prices[product_id] = price.Spent / price.Quantity
+				observed += base_price * base_quantities[product_id]
+			}
+
+			category := basket[product_id].Category
+			base_cost += base_price * base_quantities[product_id]
+			cost += current_prices[product_id] * base_quantities[product_id]
+			category_base_cost[category] += base_price * base_quantities[product_id]
+			category_cost[category] += current_prices[product_id] * base_quantities[product_id]
+		}
+
+		if base_cost == 0 {
+			continue
+		}
+
+		value := cost / base_cost * 100
+		inflation_period := InflationPeriod{
+			Period:     period,
+			Index:      round2(value),
+			Rate:       round2((value/previous_index - 1) * 100),
+			Coverage:   round2(observed / base_cost * 100),
+			Categories: []CategoryInflation{},
+		}
+
+		for _, category := range category_names {
+			category_value := category_cost[category] / category_base_cost[category] * 100
+			previous, ok := previous_categories[category]
+			if !ok {
+				previous = 100
+			}
+
+			inflation_period.Categories = append(inflation_period.Categories, CategoryInflation{
+				Category: category,
+				Index:    round2(category_value),
+				Rate:     round2((category_value/previous - 1) * 100),
+			})
+			previous_categories[category] = category_value
+		}
+
+		previous_index = value
+		index.Periods = append(index.Periods, inflation_period)
+	}
+
+	if len(index.Periods) > 0 {
+		index.Inflation = round2(index.Periods[len(index.Periods)-1].Index - 100)
+	}
+
+	return &index, nil
+}
+
+// Return total spent, number of receipts and average basket for given user grouped by period, supermarket or category
+// Receipts are filtered with the same criteria used to list them
+func FindSpendingForUser(db *sql.DB, user *User, filters *ReceiptFilter, group_by string) (*[]SpendingGroup, error) {
+	var parameters []interface{}
+	parameters = append(parameters, user.ID)
+
+	var conditions []string
+
+	if filters != nil {
+		// Item, using a subquery to avoid counting receipts more than once
+		if len(filters.Item) > 0 {
+			conditions = append(conditions, "receipts.id IN (SELECT receipt_id FROM receipt_items WHERE name LIKE ? AND deleted_at IS NULL)")
+			parameters = append(parameters, fmt.Sprintf("%%%s%%", filters.Item))
+		}
+
+		filter_conditions, filter_parameters, err := receiptFilterConditions(filters)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, filter_conditions...)
+		parameters = append(parameters, filter_parameters...)
+	}
+
+	where := receiptReadAccess + " AND receipts.deleted_at IS NULL"
+	if len(conditions) > 0 {
+		where = fmt.Sprintf("%s AND %s", where, strings.Join(conditions, " AND "))
+	}
+
+	var query string
+
+	if group_by == "category" {
+		// Receipts can include products from many categories, so totals are the sum of item prices
+		query = fmt.Sprintf(`SELECT COALESCE(NULLIF(products.category, ''), '%s') AS grouping, SUM(receipt_items.price), COUNT(DISTINCT receipts.id) FROM receipt_items
+			INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+			LEFT JOIN products ON products.id = receipt_items.product_id
+			WHERE receipt_items.deleted_at IS NULL AND %s GROUP BY grouping ORDER BY SUM(receipt_items.price) DESC`, Uncategorized, where)
+	} else {
+		expression, ok := spendingGroups[group_by]
+		if !ok {
+			return nil, fmt.Errorf("Invalid grouping %s", group_by)
+		}
+
+		query = fmt.Sprintf("SELECT %s AS grouping, SUM(total), COUNT(*) FROM receipts WHERE %s GROUP BY grouping ORDER BY grouping", expression, where)
+	}
+
+	rows, err := db.Query(query, parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := []SpendingGroup{}
+
+	for rows.Next() {
+		group := SpendingGroup{}
+		var key sql.NullString
+		if err := rows.Scan(&key, &group.Total, &group.Receipts); err != nil {
+			return nil, err
+		}
+
+		group.Key = key.String
+		group.Total = round2(group.Total)
+		if group.Receipts > 0 {
+			group.AverageBasket = round2(group.Total / float64(group.Receipts))
+		}
+
+		groups = append(groups, group)
+	}
+
+	return &groups, nil
+}
+
+type TopItem struct {
+	Rank              int     `json:"rank"`
+	ProductID         int64   `json:"product_id"`
+	Product           string  `json:"product"`
+	Category          string  `json:"category"`
+	Purchases         int64   `json:"purchases"`
+	Quantity          float64 `json:"quantity"`
+	Spent             float64 `json:"spent"`
+	PreviousRank      int     `json:"previous_rank"`
+	PreviousPurchases int64   `json:"previous_purchases"`
+	PreviousQuantity  float64 `json:"previous_quantity"`
+	PreviousSpent     float64 `json:"previous_spent"`
+}
+
+type TopItemFilter struct {
+	MinDate     time.Time
+	MaxDate     time.Time
+	Supermarket string
+	Category    string
+	OrderBy     string
+	Limit       int64
+	HouseholdID int64
+	MemberID    int64
+}
+
+// Columns used to sort top items for each available order
+var topItemOrders = map[string]string{
+	"count":    "purchases",
+	"quantity": "quantity",
+	"spend":    "spent",
+}
+
+// Return products ranked by purchases, quantity or spend between given dates
+func findTopItems(db *sql.DB, user *User, filters *TopItemFilter, min_date time.Time, max_date time.Time, limit int64) ([]TopItem, error) {
+	order, ok := topItemOrders[filters.OrderBy]
+	if !ok {
+		return nil, fmt.Errorf("Invalid order %s", filters.OrderBy)
+	}
+
+	var parameters []interface{}
+	parameters = append(parameters, user.ID)
+
+	conditions, filter_parameters, err := receiptFilterConditions(&ReceiptFilter{Supermarket: filters.Supermarket, HouseholdID: filters.HouseholdID, MemberID: filters.MemberID, MinDate: &min_date, MaxDate: &max_date})
+	if err != nil {
+		return nil, err
+	}
+	parameters = append(parameters, filter_parameters...)
+
+	// Category
+	if filters.Category == Uncategorized {
+		conditions = append(conditions, "(products.category IS NULL OR products.category = '')")
+	} else if len(filters.Category) > 0 {
+		conditions = append(conditions, "products.category = ?")
+		parameters = append(parameters, filters.Category)
+	}
+
+	query := fmt.Sprintf(`SELECT products.id, products.name, products.category, COUNT(DISTINCT receipts.id) AS purchases, SUM(receipt_items.quantity) AS quantity, SUM(receipt_items.price) AS spent
+		FROM receipt_items
+		INNER JOIN receipts ON receipts.id = receipt_items.receipt_id
+		INNER JOIN products ON products.id = receipt_items.product_id
+		WHERE `+receiptReadAccess+` AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND %s
+		GROUP BY products.id ORDER BY %s DESC, products.name`, strings.Join(conditions, " AND "), order)
+
+	if limit > 0 {
+		query = fmt.Sprintf("%s LIMIT %d", query, limit)
+	}
+
+	rows, err := db.Query(query, parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []TopItem{}
+
+	for rows.Next() {
+		item := TopItem{Rank: len(items) + 1}
+		var category sql.NullString
+		if err := rows.Scan(&item.ProductID, &item.Product, &category, &item.Purchases, &item.Quantity, &item.Spent); err != nil {
+			return nil, err
+		}
+
+		item.Category = category.String
+		item.Spent = round2(item.Spent)
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Return most bought products for given user, compared with previous period of the same length
+func FindTopItemsForUser(db *sql.DB, user *User, filters *TopItemFilter) (*[]TopItem, error) {
+	if filters.MaxDate.Before(filters.MinDate) {
+		return nil, errors.New("MaxDate can not no lower than MinDate")
+	}
+
+	items, err := findTopItems(db, user, filters, filters.MinDate, filters.MaxDate, filters.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Previous period ends the day before current one starts
+	days := int(filters.MaxDate.Sub(filters.MinDate).Hours()/24) + 1
+	previous_max := filters.MinDate.AddDate(0, 0, -1)
+	previous_min := filters.MinDate.AddDate(0, 0, -days)
+
+	previous_items, err := findTopItems(db, user, filters, previous_min, previous_max, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := map[int64]TopItem{}
+	for _, item := range previous_items {
+		previous[item.ProductID] = item
+	}
+
+	for index, item := range items {
+		if previous_item, ok := previous[item.ProductID]; ok {
+			items[index].PreviousRank = previous_item.Rank
+			items[index].PreviousPurchases = previous_item.Purchases
+			items[index].PreviousQuantity = previous_item.Quantity
+			items[index].PreviousSpent = previous_item.Spent
+		}
+	}
+
+	return &items, nil
+}
@@ -0,0 +1,272 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindInflationIndexForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := mock.NewRows([]string{"product_id", "category", "month", "spent", "quantity"}).
+		AddRow(1, "dairy", "2023-01", 10.0, 10.0).
+		AddRow(2, nil, "2023-01", 10.0, 5.0).
+		AddRow(1, "dairy", "2023-02", 12.0, 10.0).
+		AddRow(2, nil, "2023-03", 11.0, 5.0)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT receipt_items.product_id, products.category, strftime('%Y-%m', receipts.receipt_date) AS month")).
+		WithArgs(1, base.Format(time.RFC3339)).
+		WillReturnRows(rows)
+
+	index, err := FindInflationIndexForUser(db, &user, base, "month")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s computing inflation index", err)
+	}
+
+	assert.Equal(t, 2, index.Products)
+	assert.Equal(t, 3, len(index.Periods))
+
+	assert.Equal(t, 100.0, index.Periods[0].Index)
+	assert.Equal(t, 110.0, index.Periods[1].Index, "Product 1 price rises 20% with half of basket weight")
+	assert.Equal(t, 50.0, index.Periods[1].Coverage)
+	assert.Equal(t, 115.0, index.Periods[2].Index, "Product 1 keeps last known price")
+	assert.Equal(t, 15.0, index.Inflation)
+
+	assert.Equal(t, "dairy", index.Periods[1].Categories[0].Category)
+	assert.Equal(t, 120.0, index.Periods[1].Categories[0].Index)
+	assert.Equal(t, Uncategorized, index.Periods[1].Categories[1].Category)
+	assert.Equal(t, 100.0, index.Periods[1].Categories[1].Index)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindInflationIndexForUserByYear(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	base := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := mock.NewRows([]string{"product_id", "category", "month", "spent", "quantity"}).
+		AddRow(1, "dairy", "2023-01", 5.0, 5.0).
+		AddRow(1, "dairy", "2023-06", 5.0, 5.0).
+		AddRow(1, "dairy", "2024-02", 11.0, 10.0)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT receipt_items.product_id")).
+		WithArgs(1, "2023-01-01T00:00:00Z").
+		WillReturnRows(rows)
+
+	index, err := FindInflationIndexForUser(db, &user, base, "year")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s computing inflation index", err)
+	}
+
+	assert.Equal(t, "2023", index.Base)
+	assert.Equal(t, 2, len(index.Periods))
+	assert.Equal(t, 110.0, index.Periods[1].Index)
+	assert.Equal(t, 10.0, index.Periods[1].Rate)
+}
+
+func TestFindInflationIndexForUserWithoutBasePeriod(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := mock.NewRows([]string{"product_id", "category", "month", "spent", "quantity"}).
+		AddRow(1, "dairy", "2023-02", 12.0, 10.0)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT receipt_items.product_id")).
+		WithArgs(1, base.Format(time.RFC3339)).
+		WillReturnRows(rows)
+
+	index, err := FindInflationIndexForUser(db, &user, base, "month")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s computing inflation index", err)
+	}
+
+	assert.Equal(t, 0, len(index.Periods), "Index can not be computed without base basket")
+}
+
+func TestFindInflationIndexForUserInvalidGranularity(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = FindInflationIndexForUser(db, &User{ID: 1}, time.Now(), "week")
+
+	assert.NotNil(t, err, "Expected error for invalid granularity")
+}
+
+func TestFindSpendingForUserByMonth(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	ts_min := time.Now().Add(-24 * 60 * time.Hour)
+	ts_max := time.Now()
+
+	rows := mock.NewRows([]string{"grouping", "total", "receipts"}).
+		AddRow("2023-01", 100.0, 4).
+		AddRow("2023-02", 90.0, 3)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT strftime('%Y-%m', receipt_date) AS grouping, SUM(total), COUNT(*) FROM receipts WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND supermarket like ? AND DATE(receipt_date) >= DATE(?) AND DATE(receipt_date) <= DATE(?) GROUP BY grouping")).
+		WithArgs(1, "%merc%", ts_min, ts_max).
+		WillReturnRows(rows)
+
+	filters := ReceiptFilter{Supermarket: "merc", MinDate: &ts_min, MaxDate: &ts_max}
+	spending, err := FindSpendingForUser(db, &user, &filters, "month")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting spending", err)
+	}
+
+	assert.Equal(t, 2, len(*spending))
+	assert.Equal(t, "2023-01", (*spending)[0].Key)
+	assert.Equal(t, 25.0, (*spending)[0].AverageBasket)
+	assert.Equal(t, 30.0, (*spending)[1].AverageBasket)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindSpendingForUserByCategory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+
+	rows := mock.NewRows([]string{"grouping", "total", "receipts"}).
+		AddRow("dairy", 20.0, 2).
+		AddRow(Uncategorized, 10.0, 1)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE receipt_items.deleted_at IS NULL AND ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND receipts.id IN (SELECT receipt_id FROM receipt_items WHERE name LIKE ? AND deleted_at IS NULL) GROUP BY grouping")).
+		WithArgs(1, "%leche%").
+		WillReturnRows(rows)
+
+	filters := ReceiptFilter{Item: "leche"}
+	spending, err := FindSpendingForUser(db, &user, &filters, "category")
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting spending", err)
+	}
+
+	assert.Equal(t, 2, len(*spending))
+	assert.Equal(t, "dairy", (*spending)[0].Key)
+	assert.Equal(t, 10.0, (*spending)[0].AverageBasket)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindSpendingForUserInvalidGrouping(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	_, err = FindSpendingForUser(db, &User{ID: 1}, nil, "hour")
+
+	assert.NotNil(t, err, "Expected error for invalid grouping")
+}
+
+func TestFindTopItemsForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	user := User{ID: 1}
+	ts_min := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	ts_max := time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)
+	previous_min := time.Date(2023, 1, 4, 0, 0, 0, 0, time.UTC)
+	previous_max := time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	columns := []string{"id", "name", "category", "purchases", "quantity", "spent"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE ? IN (SELECT receipts.user_id WHERE receipts.household_id IS NULL UNION SELECT user_id FROM household_members WHERE household_members.household_id = receipts.household_id) AND receipts.deleted_at IS NULL AND receipt_items.deleted_at IS NULL AND DATE(receipt_date) >= DATE(?) AND DATE(receipt_date) <= DATE(?) AND products.category = ? GROUP BY products.id ORDER BY spent DESC, products.name LIMIT 2")).
+		WithArgs(1, &ts_min, &ts_max, "dairy").
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(1, "LECHE", "dairy", 4, 8.0, 9.6).
+			AddRow(2, "YOGUR", "dairy", 2, 4.0, 3.2))
+
+	mock.ExpectQuery(regexp.QuoteMeta("GROUP BY products.id ORDER BY spent DESC, products.name")).
+		WithArgs(1, &previous_min, &previous_max, "dairy").
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(3, "QUESO", "dairy", 1, 1.0, 12.0).
+			AddRow(1, "LECHE", "dairy", 3, 6.0, 6.6))
+
+	filters := TopItemFilter{MinDate: ts_min, MaxDate: ts_max, Category: "dairy", OrderBy: "spend", Limit: 2}
+	items, err := FindTopItemsForUser(db, &user, &filters)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting top items", err)
+	}
+
+	assert.Equal(t, 2, len(*items))
+	assert.Equal(t, 1, (*items)[0].Rank)
+	assert.Equal(t, 2, (*items)[0].PreviousRank)
+	assert.Equal(t, int64(3), (*items)[0].PreviousPurchases)
+	assert.Equal(t, 0, (*items)[1].PreviousRank, "Product not bought in previous period")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindTopItemsForUserInvalidOrder(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	filters := TopItemFilter{MinDate: time.Now(), MaxDate: time.Now(), OrderBy: "name"}
+	_, err = FindTopItemsForUser(db, &User{ID: 1}, &filters)
+
+	assert.NotNil(t, err, "Expected error for invalid order")
+}
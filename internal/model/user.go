@@ -0,0 +1,138 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/relvacode/iso8601"
+)
+
+// Language code with optional region, like es or es-ES
+var localeExp = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// Check profile preferences set by user are valid
+func ValidateUser(user *User) error {
+	if len(user.Locale) > 0 && !localeExp.MatchString(user.Locale) {
+		return fmt.Errorf("Invalid locale %s", user.Locale)
+	}
+
+	if len(user.Currency) > 0 && len(user.Currency) != 3 {
+		return fmt.Errorf("Invalid currency %s", user.Currency)
+	}
+
+	if len(user.Timezone) > 0 {
+		if _, err := time.LoadLocation(user.Timezone); err != nil {
+			return fmt.Errorf("Invalid timezone %s", user.Timezone)
+		}
+	}
+
+	return nil
+}
+
+// Return timezone chosen by user, or UTC if it is not set
+func (user *User) Location() *time.Location {
+	if len(user.Timezone) > 0 {
+		if location, err := time.LoadLocation(user.Timezone); err == nil {
+			return location
+		}
+	}
+
+	return time.UTC
+}
+
+// Return day of given time in timezone of user, stored at midnight UTC like receipt dates
+func (user *User) Day(t time.Time) time.Time {
+	t = t.In(user.Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Parse a date in ISO8601 format and return its day
+// Dates with time and offset are converted to timezone of user, while days and local times are kept as sent
+func (user *User) ParseDate(value string) (time.Time, error) {
+	date, err := iso8601.ParseString(value)
+	if err != nil {
+		return date, err
+	}
+
+	if _, clock, found := strings.Cut(value, "T"); found && strings.ContainsAny(clock, "Z+-") {
+		return user.Day(date), nil
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// Store values from identity provider on login
+// Email and picture are always updated, while name and locale are only set if user did not choose them
+func UpdateUserLogin(db *sql.DB, user *User, email string, name string, picture_url string, locale string) error {
+	if len(user.Name) == 0 {
+		user.Name = name
+	}
+
+	if len(user.Locale) == 0 && localeExp.MatchString(locale) {
+		user.Locale = locale
+	}
+
+	user.Email = email
+	user.PictureURL = picture_url
+
+	_, err := db.Exec("UPDATE users SET email = ?, name = ?, picture_url = ?, locale = ? WHERE id = ?", user.Email, user.Name, user.PictureURL, user.Locale, user.ID)
+	return err
+}
+
+// Store profile preferences chosen by user
+func UpdateUserProfile(db *sql.DB, user *User) error {
+	if err := ValidateUser(user); err != nil {
+		return err
+	}
+
+	_, err := db.Exec("UPDATE users SET name = ?, locale = ?, currency = ?, timezone = ? WHERE id = ?", user.Name, user.Locale, user.Currency, user.Timezone, user.ID)
+	return err
+}
+
+// Create a user for local login with given username, email and password hash
+func CreatePasswordUser(db *sql.DB, username string, email string, password_hash string) (*User, error) {
+	res, err := db.Exec("INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)", username, email, password_hash)
+	if err != nil {
+		return nil, err
+	}
+
+	user_id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{ID: user_id, Email: email}, nil
+}
+
+// Return id and password hash of user with given username, or sql.ErrNoRows if user does not exist or has no password
+func FindUserPasswordHash(db *sql.DB, username string) (int64, string, error) {
+	var user_id int64
+	var password_hash sql.NullString
+
+	if err := db.QueryRow("SELECT id, password_hash FROM users WHERE username = ?", username).Scan(&user_id, &password_hash); err != nil {
+		return 0, "", err
+	}
+
+	if len(password_hash.String) == 0 {
+		return 0, "", sql.ErrNoRows
+	}
+
+	return user_id, password_hash.String, nil
+}
+
+// Change password hash of user with given username, returning sql.ErrNoRows if user does not exist
+func UpdateUserPassword(db *sql.DB, username string, password_hash string) error {
+	res, err := db.Exec("UPDATE users SET password_hash = ? WHERE username = ?", password_hash, username)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUser(t *testing.T) {
+	assert.Nil(t, ValidateUser(&User{Locale: "es-ES", Currency: "EUR", Timezone: "Europe/Madrid"}))
+	assert.Nil(t, ValidateUser(&User{}))
+	assert.Equal(t, "Invalid locale spanish", ValidateUser(&User{Locale: "spanish"}).Error())
+	assert.Equal(t, "Invalid currency EURO", ValidateUser(&User{Currency: "EURO"}).Error())
+	assert.Equal(t, "Invalid timezone Mars/Base", ValidateUser(&User{Timezone: "Mars/Base"}).Error())
+}
+
+func TestUserParseDate(t *testing.T) {
+	user := User{Timezone: "America/New_York"}
+
+	for value, expected := range map[string]string{
+		"2024-01-31":                "2024-01-31",
+		"2024-01-31T23:30:00":       "2024-01-31",
+		"2024-02-01T02:00:00Z":      "2024-01-31",
+		"2024-01-31T23:30:00-05:00": "2024-01-31",
+		"2024-02-01T10:00:00+01:00": "2024-02-01",
+	} {
+		date, err := user.ParseDate(value)
+
+		if err != nil {
+			t.Fatalf("Unexpected error %s parsing %s", err, value)
+		}
+
+		assert.Equal(t, expected, date.Format("2006-01-02"), value)
+		assert.Equal(t, time.UTC, date.Location())
+	}
+
+	date, _ := (&User{}).ParseDate("2024-02-01T02:00:00Z")
+	assert.Equal(t, "2024-02-01", date.Format("2006-01-02"))
+}
+
+func TestUpdateUserLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET email = ?, name = ?, picture_url = ?, locale = ? WHERE id = ?")).
+		WithArgs("new@example.com", "Chosen name", "https://example.com/new.png", "es", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	user := User{ID: 1, Name: "Chosen name", Email: "old@example.com"}
+
+	// Name chosen by user is kept
+	if err := UpdateUserLogin(db, &user, "new@example.com", "Google name", "https://example.com/new.png", "es"); err != nil {
+		t.Fatalf("Unexpected error %s updating user", err)
+	}
+
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Equal(t, "Chosen name", user.Name)
+	assert.Equal(t, "es", user.Locale)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET name = ?, locale = ?, currency = ?, timezone = ? WHERE id = ?")).
+		WithArgs("Me", "es-ES", "EUR", "Europe/Madrid", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, UpdateUserProfile(db, &User{ID: 1, Name: "Me", Locale: "es-ES", Currency: "EUR", Timezone: "Europe/Madrid"}))
+	assert.NotNil(t, UpdateUserProfile(db, &User{ID: 1, Timezone: "Nowhere"}))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
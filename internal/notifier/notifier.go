@@ -0,0 +1,145 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+)
+
+// Deliver detected price changes to the user by any available channel
+type Notifier interface {
+	Notify(user *model.User, changes []model.PriceChange) error
+}
+
+// Send price changes by email using a SMTP server, to the address of the user who owns them
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send price changes as JSON to a generic webhook
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify every configured channel, returning the first error found
+type multiNotifier []Notifier
+
+// Create notifiers configured by environment variables, or nil if there is no one configured
+func NewFromEnv() Notifier {
+	notifiers := multiNotifier{}
+
+	if host := os.Getenv("SMTP_HOST"); len(host) > 0 {
+		port := os.Getenv("SMTP_PORT")
+		if len(port) == 0 {
+			port = "25"
+		}
+
+		notifiers = append(notifiers, &SMTPNotifier{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		})
+	}
+
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); len(url) > 0 {
+		notifiers = append(notifiers, &WebhookNotifier{URL: url})
+	}
+
+	if len(notifiers) == 0 {
+		return nil
+	}
+
+	return notifiers
+}
+
+func (notifiers multiNotifier) Notify(user *model.User, changes []model.PriceChange) error {
+	var first_err error
+
+	for _, n := range notifiers {
+		if err := n.Notify(user, changes); err != nil && first_err == nil {
+			first_err = err
+		}
+	}
+
+	return first_err
+}
+
+// Return only price rises, which are the ones worth to be notified
+func Increases(changes []model.PriceChange) []model.PriceChange {
+	increases := []model.PriceChange{}
+
+	for _, change := range changes {
+		if change.ChangePercent > 0 {
+			increases = append(increases, change)
+		}
+	}
+
+	return increases
+}
+
+func (n *SMTPNotifier) Notify(user *model.User, changes []model.PriceChange) error {
+	// Users without email can still be notified by webhook
+	if len(changes) == 0 || len(user.Email) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+
+	fmt.Fprintf(&body, "From: %s\r\n", n.From)
+	fmt.Fprintf(&body, "To: %s\r\n", user.Email)
+	fmt.Fprintf(&body, "Subject: %d price changes detected\r\n", len(changes))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+
+	for _, change := range changes {
+		fmt.Fprintf(&body, "%s (%s): %.2f -> %.2f (%+.2f%%) on %s\r\n", change.Product, change.Supermarket,
+			change.PreviousPrice, change.Price, change.ChangePercent, change.Date.Format("2006-01-02"))
+	}
+
+	var auth smtp.Auth
+	if len(n.Username) > 0 {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	return smtp.SendMail(fmt.Sprintf("%s:%s", n.Host, n.Port), auth, n.From, []string{user.Email}, body.Bytes())
+}
+
+func (n *WebhookNotifier) Notify(user *model.User, changes []model.PriceChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"user_id": user.ID, "price_changes": changes})
+	if err != nil {
+		return err
+	}
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	res, err := client.Post(n.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("Webhook returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
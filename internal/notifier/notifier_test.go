@@ -0,0 +1,153 @@
+package notifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func priceChanges() []model.PriceChange {
+	return []model.PriceChange{
+		{ProductID: 1, Product: "LECHE ENTERA", Supermarket: "Any", PreviousPrice: 1.0, Price: 1.2, ChangePercent: 20, Date: time.Now()},
+		{ProductID: 2, Product: "PAN", Supermarket: "Any", PreviousPrice: 1.0, Price: 0.9, ChangePercent: -10, Date: time.Now()},
+	}
+}
+
+// Minimal SMTP server which stores the data of the first message received
+func mailCatcher(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %s starting mail catcher", err)
+	}
+
+	messages := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		defer listener.Close()
+
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost\r\n"))
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				conn.Write([]byte("250 localhost\r\n"))
+			case command == "DATA":
+				conn.Write([]byte("354 go ahead\r\n"))
+
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				messages <- data.String()
+				conn.Write([]byte("250 ok\r\n"))
+			case command == "QUIT":
+				conn.Write([]byte("221 bye\r\n"))
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+
+	return listener.Addr().String(), messages
+}
+
+func TestIncreases(t *testing.T) {
+	increases := Increases(priceChanges())
+
+	assert.Equal(t, 1, len(increases), "Only one price increase expected")
+	assert.Equal(t, "LECHE ENTERA", increases[0].Product)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := WebhookNotifier{URL: server.URL}
+	err := n.Notify(&model.User{ID: 1}, priceChanges())
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s sending webhook", err)
+	}
+
+	assert.Equal(t, float64(1), received["user_id"])
+	assert.Equal(t, 2, len(received["price_changes"].([]interface{})))
+}
+
+func TestWebhookNotifierErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := WebhookNotifier{URL: server.URL}
+	err := n.Notify(&model.User{ID: 1}, priceChanges())
+
+	assert.NotNil(t, err, "Expected error for webhook failure status")
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, messages := mailCatcher(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	n := SMTPNotifier{Host: host, Port: port, From: "tracker@localhost"}
+	err := n.Notify(&model.User{ID: 1, Email: "user@localhost"}, priceChanges()[:1])
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s sending email", err)
+	}
+
+	select {
+	case message := <-messages:
+		assert.Contains(t, message, "To: user@localhost")
+		assert.Contains(t, message, "Subject: 1 price changes detected")
+		assert.Contains(t, message, "LECHE ENTERA (Any): 1.00 -> 1.20 (+20.00%)")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Mail catcher did not receive any message")
+	}
+}
+
+func TestNotifyWithoutChanges(t *testing.T) {
+	n := WebhookNotifier{URL: "http://127.0.0.1:0"}
+
+	if err := n.Notify(&model.User{ID: 1}, []model.PriceChange{}); err != nil {
+		t.Fatalf("Unexpected error %s notifying empty list", err)
+	}
+}
+
+func TestSMTPNotifierWithoutEmail(t *testing.T) {
+	n := SMTPNotifier{Host: "127.0.0.1", Port: "0", From: "tracker@localhost"}
+
+	if err := n.Notify(&model.User{ID: 1}, priceChanges()); err != nil {
+		t.Fatalf("Unexpected error %s notifying user without email", err)
+	}
+}
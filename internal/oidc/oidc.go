@@ -0,0 +1,287 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Time keys are kept before reading them again from provider
+const DefaultCacheTTL = time.Hour
+
+// Minimum time between reads of keys when a token is signed with an unknown key
+const minRefreshInterval = time.Minute
+
+var ErrUnknownKey = errors.New("Token is signed with an unknown key")
+
+// Provider configuration read from discovery document
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims of a validated ID token used to link and update users
+type Claims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OpenID Connect provider, whose discovery document and keys are cached
+type Provider struct {
+	Issuer   string
+	ClientID string
+
+	// Time keys are cached, DefaultCacheTTL if empty
+	CacheTTL time.Duration
+
+	// Client used for requests to provider, http.DefaultClient if empty
+	HTTPClient *http.Client
+
+	mutex      sync.Mutex
+	discovery  *Discovery
+	keys       map[string]interface{}
+	fetched_at time.Time
+}
+
+// Return provider configured with OIDC_ISSUER and OIDC_CLIENT_ID, or nil if OIDC_ISSUER is not set
+func ProviderFromEnv() *Provider {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if len(issuer) == 0 {
+		return nil
+	}
+
+	return &Provider{Issuer: strings.TrimSuffix(issuer, "/"), ClientID: os.Getenv("OIDC_CLIENT_ID")}
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error reading %s, status %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Return discovery document of provider, reading it only once
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.discover(ctx)
+}
+
+func (p *Provider) discover(ctx context.Context) (*Discovery, error) {
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := Discovery{}
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("Discovery issuer %s does not match %s", discovery.Issuer, p.Issuer)
+	}
+
+	if len(discovery.JWKSURI) == 0 {
+		return nil, errors.New("Discovery document has no jwks_uri")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// Read signing keys from provider
+func (p *Provider) fetchKeys(ctx context.Context) error {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return err
+	}
+
+	keys := map[string]interface{}{}
+
+	for _, jwk := range set.Keys {
+		if len(jwk.Use) > 0 && jwk.Use != "sig" {
+			continue
+		}
+
+		// Unsupported key types are ignored, tokens signed with them fail as unknown keys
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	p.keys = keys
+	p.fetched_at = time.Now()
+
+	return nil
+}
+
+// Return key with given id, reading keys again when cache expires or key is not found
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ttl := p.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	if p.keys == nil || time.Since(p.fetched_at) > ttl {
+		if err := p.fetchKeys(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	// Provider may have rotated its keys
+	if time.Since(p.fetched_at) > minRefreshInterval {
+		if err := p.fetchKeys(ctx); err != nil {
+			return nil, err
+		}
+
+		if key, ok := p.keys[kid]; ok {
+			return key, nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// Validate signature, issuer, audience and expiration of ID token, and return its claims
+func (p *Provider) Validate(ctx context.Context, id_token string) (*Claims, error) {
+	claims := Claims{}
+
+	_, err := jwt.ParseWithClaims(id_token, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(claims.Subject) == 0 {
+		return nil, errors.New("Token has no subject")
+	}
+
+	return &claims, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Return RSA or EC public key for JSON web key
+func (jwk *jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported curve %s", jwk.Crv)
+		}
+
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key type %s", jwk.Kty)
+	}
+}
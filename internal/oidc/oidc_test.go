@@ -0,0 +1,155 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// Local stand-in issuer serving discovery document and keys
+type testIssuer struct {
+	server     *httptest.Server
+	key        *rsa.PrivateKey
+	kid        string
+	jwks_reads int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error %s generating key", err)
+	}
+
+	issuer := &testIssuer{key: key, kid: "key1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwks_reads++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{{
+			Kid: issuer.kid,
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(issuer.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(issuer.key.E)).Bytes()),
+		}}})
+	})
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (issuer *testIssuer) token(t *testing.T, claims Claims, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	ss, err := token.SignedString(issuer.key)
+	if err != nil {
+		t.Fatalf("Unexpected error %s signing token", err)
+	}
+
+	return ss
+}
+
+func (issuer *testIssuer) claims(audience string) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer.server.URL,
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := Provider{Issuer: issuer.server.URL, ClientID: "tracker"}
+
+	claims, err := provider.Validate(context.Background(), issuer.token(t, issuer.claims("tracker"), "key1"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s validating token", err)
+	}
+
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "jane@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "Jane", claims.Name)
+
+	// Keys are cached
+	_, err = provider.Validate(context.Background(), issuer.token(t, issuer.claims("tracker"), "key1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, issuer.jwks_reads)
+}
+
+func TestValidateWrongAudience(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := Provider{Issuer: issuer.server.URL, ClientID: "tracker"}
+
+	_, err := provider.Validate(context.Background(), issuer.token(t, issuer.claims("other"), "key1"))
+	assert.NotNil(t, err)
+}
+
+func TestValidateExpired(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := Provider{Issuer: issuer.server.URL, ClientID: "tracker"}
+
+	claims := issuer.claims("tracker")
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+	_, err := provider.Validate(context.Background(), issuer.token(t, claims, "key1"))
+	assert.NotNil(t, err)
+}
+
+func TestValidateUnknownKey(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := Provider{Issuer: issuer.server.URL, ClientID: "tracker"}
+
+	_, err := provider.Validate(context.Background(), issuer.token(t, issuer.claims("tracker"), "key2"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestValidateRotatedKey(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := Provider{Issuer: issuer.server.URL, ClientID: "tracker", CacheTTL: time.Nanosecond}
+
+	_, err := provider.Validate(context.Background(), issuer.token(t, issuer.claims("tracker"), "key1"))
+	assert.Nil(t, err)
+
+	// Keys are read again after cache expires
+	issuer.kid = "key2"
+
+	_, err = provider.Validate(context.Background(), issuer.token(t, issuer.claims("tracker"), "key2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, issuer.jwks_reads)
+}
+
+func TestDiscoverWrongIssuer(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := Provider{Issuer: issuer.server.URL + "/other", ClientID: "tracker"}
+
+	_, err := provider.Discover(context.Background())
+	assert.NotNil(t, err)
+}
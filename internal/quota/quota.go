@@ -0,0 +1,216 @@
+package quota
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/cbolanos79/shoppingbag_tracker/internal/receipt_scanner"
+)
+
+// Estimated price of a page analyzed by Textract
+const defaultPageCost = 0.01
+
+var ErrQuotaExceeded = errors.New("Monthly scan budget exceeded")
+
+// Monthly budgets of estimated scan cost, zero means no limit
+// Scans are refused once hard limits are reached, while soft limits only warn
+type Limits struct {
+	PageCost     float64 `json:"page_cost"`
+	UserSoft     float64 `json:"user_soft_limit"`
+	UserHard     float64 `json:"user_hard_limit"`
+	InstanceSoft float64 `json:"instance_soft_limit"`
+	InstanceHard float64 `json:"instance_hard_limit"`
+}
+
+// Scan usage of current month for a user and the whole instance
+type Usage struct {
+	Month    string           `json:"month"`
+	User     *model.ScanUsage `json:"user"`
+	Instance *model.ScanUsage `json:"instance,omitempty"`
+	Limits   Limits           `json:"limits"`
+	Warnings []string         `json:"warnings"`
+	Blocked  bool             `json:"blocked"`
+}
+
+// Scans are checked and recorded one at a time, so concurrent scans do not lock database
+var lock sync.Mutex
+
+// Pages of scans sent to Textract and not recorded yet, by user and for the whole instance
+// Pages are reserved when a scan passes the check and released when it is recorded, so concurrent scans can not all pass
+var (
+	reservedUsers    = map[int64]int64{}
+	reservedInstance int64
+)
+
+// Return value of a cost variable, or default value if it is empty or invalid
+func costFromEnv(name string, default_value float64) float64 {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return default_value
+	}
+
+	cost, err := strconv.ParseFloat(value, 64)
+	if err != nil || cost < 0 {
+		log.Printf("Invalid %s value %s, using default\n", name, value)
+		return default_value
+	}
+
+	return cost
+}
+
+// Return limits configured by SCAN_PAGE_COST, SCAN_USER_SOFT_LIMIT, SCAN_USER_HARD_LIMIT,
+// SCAN_INSTANCE_SOFT_LIMIT and SCAN_INSTANCE_HARD_LIMIT
+func LimitsFromEnv() Limits {
+	return Limits{
+		PageCost:     costFromEnv("SCAN_PAGE_COST", defaultPageCost),
+		UserSoft:     costFromEnv("SCAN_USER_SOFT_LIMIT", 0),
+		UserHard:     costFromEnv("SCAN_USER_HARD_LIMIT", 0),
+		InstanceSoft: costFromEnv("SCAN_INSTANCE_SOFT_LIMIT", 0),
+		InstanceHard: costFromEnv("SCAN_INSTANCE_HARD_LIMIT", 0),
+	}
+}
+
+// Return first day of month of given date, and first day of next month
+func MonthRange(date time.Time) (time.Time, time.Time) {
+	from := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// Return usage of user in month of given date, compared with limits
+func FindUsage(db *sql.DB, limits Limits, user_id int64, date time.Time) (*Usage, error) {
+	from, to := MonthRange(date)
+
+	user, err := model.FindScanUsage(db, user_id, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := model.FindScanUsage(db, 0, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := Usage{Month: from.Format("2006-01"), User: user, Instance: instance, Limits: limits}
+	usage.checkLimits()
+
+	return &usage, nil
+}
+
+// Set warnings and blocked state of usage from its costs and limits
+func (usage *Usage) checkLimits() {
+	limits := usage.Limits
+	usage.Blocked = false
+	usage.Warnings = []string{}
+
+	for _, limit := range []struct {
+		name string
+		cost float64
+		soft float64
+		hard float64
+	}{
+		{"user", usage.User.Cost, limits.UserSoft, limits.UserHard},
+		{"instance", usage.Instance.Cost, limits.InstanceSoft, limits.InstanceHard},
+	} {
+		if limit.hard > 0 && limit.cost >= limit.hard {
+			usage.Blocked = true
+			usage.Warnings = append(usage.Warnings, fmt.Sprintf("Monthly %s hard limit of %.2f reached", limit.name, limit.hard))
+		} else if limit.soft > 0 && limit.cost >= limit.soft {
+			usage.Warnings = append(usage.Warnings, fmt.Sprintf("Monthly %s soft limit of %.2f reached", limit.name, limit.soft))
+		}
+	}
+}
+
+// Check user can scan a file in current month, returning ErrQuotaExceeded if a hard limit is reached
+func Check(db *sql.DB, limits Limits, user_id int64) error {
+	return checkReserved(db, limits, user_id, 0, 0)
+}
+
+// Check limits like Check, adding cost reserved by scans of user and of the whole instance not recorded yet
+func checkReserved(db *sql.DB, limits Limits, user_id int64, user_reserved float64, instance_reserved float64) error {
+	usage, err := FindUsage(db, limits, user_id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if user_reserved > 0 || instance_reserved > 0 {
+		usage.User.Cost += user_reserved
+		usage.Instance.Cost += instance_reserved
+		usage.checkLimits()
+	}
+
+	if usage.Blocked {
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, usage.Warnings[0])
+	}
+
+	for _, warning := range usage.Warnings {
+		log.Printf("Check - Scan for user %d: %s\n", user_id, warning)
+	}
+
+	return nil
+}
+
+// Return a scanner for user which checks limits before sending files to Textract, and records pages analyzed
+// One page is reserved while the file is analyzed, so files scanned at the same time are counted by the check
+// Digital PDF receipts read from their text are free, so they are neither limited nor recorded
+func NewScanner(db *sql.DB, aws_session *session.Session, user_id int64, source string) func(data []byte) (*model.Receipt, error) {
+	limits := LimitsFromEnv()
+
+	return func(data []byte) (*model.Receipt, error) {
+		var reserved int64
+
+		guard := func() error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err := checkReserved(db, limits, user_id, float64(reservedUsers[user_id])*limits.PageCost, float64(reservedInstance)*limits.PageCost); err != nil {
+				return err
+			}
+
+			reserved = 1
+			reserve(user_id, reserved)
+
+			return nil
+		}
+
+		receipt, pages, err := receipt_scanner.ScanBytesGuarded(aws_session, data, guard)
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		// Reserved page is replaced by the recorded one at once, so checks never miss this scan
+		reserve(user_id, -reserved)
+
+		// Pages are charged even if receipt could not be read
+		if pages > 0 {
+			scan := model.Scan{UserID: user_id, Source: source, Pages: pages, Cost: float64(pages) * limits.PageCost}
+			if err := model.RecordScan(db, &scan); err != nil {
+				log.Printf("NewScanner - Error recording scan for user %d\n%v", user_id, err)
+			}
+		}
+
+		return receipt, err
+	}
+}
+
+// Add pages to reservations of user and instance, or release them with a negative number
+// Lock must be held by caller
+func reserve(user_id int64, pages int64) {
+	if pages == 0 {
+		return
+	}
+
+	reservedUsers[user_id] += pages
+	reservedInstance += pages
+
+	if reservedUsers[user_id] <= 0 {
+		delete(reservedUsers, user_id)
+	}
+}
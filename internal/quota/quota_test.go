@@ -0,0 +1,133 @@
+package quota
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Expect usage queries returning given cost for user and instance
+func expectUsage(mock sqlmock.Sqlmock, user_cost float64, instance_cost float64) {
+	query := regexp.QuoteMeta("FROM scans WHERE scan_date >= ? AND scan_date < ?")
+
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"scans", "pages", "cost"}).AddRow(1, 1, user_cost))
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"scans", "pages", "cost"}).AddRow(1, 1, instance_cost))
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	t.Setenv("SCAN_PAGE_COST", "")
+	t.Setenv("SCAN_USER_SOFT_LIMIT", "1.5")
+	t.Setenv("SCAN_USER_HARD_LIMIT", "wrong")
+	t.Setenv("SCAN_INSTANCE_SOFT_LIMIT", "")
+	t.Setenv("SCAN_INSTANCE_HARD_LIMIT", "20")
+
+	assert.Equal(t, Limits{PageCost: defaultPageCost, UserSoft: 1.5, InstanceHard: 20}, LimitsFromEnv())
+}
+
+func TestMonthRange(t *testing.T) {
+	from, to := MonthRange(time.Date(2024, 12, 15, 10, 0, 0, 0, time.UTC))
+
+	assert.Equal(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), to)
+}
+
+func TestFindUsage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	expectUsage(mock, 1.2, 5)
+
+	usage, err := FindUsage(db, Limits{UserSoft: 1, UserHard: 2, InstanceHard: 10}, 1, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s getting usage", err)
+	}
+
+	assert.Equal(t, "2024-03", usage.Month)
+	assert.Equal(t, 1.2, usage.User.Cost)
+	assert.Equal(t, 5.0, usage.Instance.Cost)
+	assert.False(t, usage.Blocked)
+	assert.Equal(t, 1, len(usage.Warnings))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	limits := Limits{UserHard: 2, InstanceHard: 10}
+
+	expectUsage(mock, 1, 5)
+	assert.Nil(t, Check(db, limits, 1))
+
+	// Instance budget is shared by every user
+	expectUsage(mock, 1, 10)
+	assert.True(t, errors.Is(Check(db, limits, 1), ErrQuotaExceeded))
+
+	expectUsage(mock, 2, 5)
+	assert.True(t, errors.Is(Check(db, limits, 1), ErrQuotaExceeded))
+
+	// No limits
+	expectUsage(mock, 100, 500)
+	assert.Nil(t, Check(db, Limits{}, 1))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCheckReserved(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %s connecting to database", err)
+	}
+
+	defer db.Close()
+
+	limits := Limits{UserHard: 2, InstanceHard: 10}
+
+	// Scans in progress are counted as if they were recorded
+	expectUsage(mock, 1.5, 5)
+	assert.Nil(t, checkReserved(db, limits, 1, 0.4, 0.4))
+
+	expectUsage(mock, 1.5, 5)
+	assert.True(t, errors.Is(checkReserved(db, limits, 1, 0.5, 0.5), ErrQuotaExceeded))
+
+	expectUsage(mock, 0, 9.5)
+	assert.True(t, errors.Is(checkReserved(db, limits, 1, 0, 0.5), ErrQuotaExceeded))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	reserve(7, 1)
+	reserve(7, 1)
+	reserve(8, 1)
+
+	assert.Equal(t, int64(2), reservedUsers[7])
+	assert.Equal(t, int64(3), reservedInstance)
+
+	reserve(7, -2)
+	reserve(8, -1)
+
+	_, found := reservedUsers[7]
+	assert.False(t, found)
+	assert.Equal(t, int64(0), reservedInstance)
+}
@@ -0,0 +1,186 @@
+package receipt_scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
+	"github.com/ledongthuc/pdf"
+)
+
+// Error returned when a PDF file has no text, like scanned pictures saved as PDF, which must be read with OCR
+var ErrNoText = errors.New("PDF file has no text")
+
+var (
+	// Dates like 31/01/2024, 31-01-2024 or 31.01.24
+	dateExp = regexp.MustCompile(`\b\d{1,2}[/.-]\d{1,2}[/.-]\d{2,4}\b`)
+
+	// Line with total amount, skipping subtotals
+	totalExp = regexp.MustCompile(`(?i)^(?:importe\s+)?total\b`)
+
+	// Item line: optional quantity, name, optional unit price and price, like "2 x YOGUR 0,50 1,00"
+	itemExp = regexp.MustCompile(`^(?:(\d+(?:[.,]\d+)?)\s*(?:x|ud|uds|kg)?\s+)?(.*?[^\d\s.,].*?)\s+(?:(\d+[.,]\d{2,3})\s*(?:€|EUR)?(?:/kg)?\s+)?(-?\d+[.,]\d{2})\s*(?:€|EUR)?$`)
+
+	// Lines which are not items although they end with an amount
+	skipExp = regexp.MustCompile(`(?i)\b(subtotal|iva|base imponible|tarjeta|efectivo|cambio|entregado|descuento total)\b`)
+)
+
+// Check if content is a PDF file
+func IsPDF(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("%PDF-"))
+}
+
+// Return text lines of every page in a PDF file, in reading order
+func ExtractPDFText(b []byte) ([]string, error) {
+	reader, err := pdf.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+
+	for index := 1; index <= reader.NumPage(); index++ {
+		page := reader.Page(index)
+		if page.V.IsNull() {
+			continue
+		}
+
+		rows, err := page.GetTextByRow()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			words := []string{}
+			for _, text := range row.Content {
+				words = append(words, text.S)
+			}
+
+			line := strings.Join(strings.Fields(strings.Join(words, " ")), " ")
+			if len(line) > 0 {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+// Read receipt from text of a digital PDF file, without using OCR
+// Returns ErrNoText if file has no text or it can not be read
+func ScanPDF(b []byte) (*model.Receipt, error) {
+	lines, err := ExtractPDFText(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoText, err)
+	}
+
+	if len(lines) == 0 {
+		return nil, ErrNoText
+	}
+
+	return ParseText(lines)
+}
+
+// Read receipt fields from text lines: supermarket in first line, then date, items and total
+func ParseText(lines []string) (*model.Receipt, error) {
+	if len(lines) == 0 {
+		return nil, errors.New("Empty receipt")
+	}
+
+	receipt := &model.Receipt{Supermarket: lines[0]}
+
+	date_line := -1
+	for index, line := range lines {
+		if match := dateExp.FindString(line); len(match) > 0 {
+			date, err := parseDate(match)
+			if err != nil {
+				logReceiptError(receipt, fmt.Sprintf("date field: %s", match), err, index)
+				return nil, err
+			}
+
+			receipt.Date = date
+			date_line = index
+			break
+		}
+	}
+
+	if date_line < 0 {
+		return nil, errors.New("Date not found")
+	}
+
+	total_line := -1
+	for index := len(lines) - 1; index > date_line; index-- {
+		if !totalExp.MatchString(lines[index]) {
+			continue
+		}
+
+		amounts := amountExp.FindAllString(lines[index], -1)
+		if len(amounts) == 0 {
+			continue
+		}
+
+		total, err := parseAmount(amounts[len(amounts)-1])
+		if err != nil {
+			logReceiptError(receipt, fmt.Sprintf("total field: %s", lines[index]), err, index)
+			return nil, err
+		}
+
+		receipt.Total = total
+		total_line = index
+		break
+	}
+
+	if total_line < 0 {
+		return nil, errors.New("Total not found")
+	}
+
+	if strings.Contains(strings.Join(lines, " "), "€") || strings.Contains(strings.ToUpper(strings.Join(lines, " ")), "EUR") {
+		receipt.Currency = "EUR"
+	}
+
+	// Items are found between date and total
+	for index := date_line + 1; index < total_line; index++ {
+		line := lines[index]
+		if skipExp.MatchString(line) {
+			continue
+		}
+
+		match := itemExp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		item := model.ReceiptItem{Name: match[2], Quantity: 1}
+
+		var err error
+		if len(match[1]) > 0 {
+			if item.Quantity, err = parseAmount(match[1]); err != nil {
+				logReceiptError(receipt, fmt.Sprintf("quantity field: %s", match[1]), err, index)
+				return nil, err
+			}
+		}
+
+		if len(match[3]) > 0 {
+			if item.UnitPrice, err = parseAmount(match[3]); err != nil {
+				logReceiptError(receipt, fmt.Sprintf("unit price: %s", match[3]), err, index)
+				return nil, err
+			}
+		}
+
+		if item.Price, err = parseAmount(match[4]); err != nil {
+			logReceiptError(receipt, fmt.Sprintf("price field: %s", match[4]), err, index)
+			return nil, err
+		}
+
+		receipt.Items = append(receipt.Items, item)
+	}
+
+	if len(receipt.Items) == 0 {
+		return nil, errors.New("Items not found")
+	}
+
+	return receipt, nil
+}
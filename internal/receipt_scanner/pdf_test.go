@@ -0,0 +1,175 @@
+package receipt_scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Build a PDF file with one page showing given lines of text
+func buildPDF(lines []string) []byte {
+	content := bytes.Buffer{}
+	for index, line := range lines {
+		fmt.Fprintf(&content, "BT /F1 10 Tf 1 0 0 1 20 %d Tm (%s) Tj ET\n", 800-index*14, line)
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 600 850] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString("%PDF-1.4\n")
+
+	offsets := []int{}
+	for index, object := range objects {
+		offsets = append(offsets, buffer.Len())
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", index+1, object)
+	}
+
+	xref := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buffer.Bytes()
+}
+
+var testReceiptLines = []string{
+	"SUPER EXAMPLE S.A.",
+	"Calle Mayor 1",
+	"Fecha: 31/01/2024 10:15",
+	"LECHE ENTERA 1,15",
+	"2 x YOGUR NATURAL 0,50 1,00",
+	"0,512 kg PLATANO 1,99 1,02",
+	"SUBTOTAL 3,17",
+	"TOTAL 3,17 EUR",
+	"TARJETA 3,17",
+}
+
+func TestIsPDF(t *testing.T) {
+	assert.True(t, IsPDF([]byte("%PDF-1.4\n")))
+	assert.False(t, IsPDF([]byte("\xff\xd8\xff")))
+}
+
+func TestExtractPDFText(t *testing.T) {
+	lines, err := ExtractPDFText(buildPDF([]string{"SUPER EXAMPLE", "TOTAL 3,17"}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s reading PDF", err)
+	}
+
+	assert.Equal(t, []string{"SUPER EXAMPLE", "TOTAL 3,17"}, lines)
+}
+
+func TestScanPDF(t *testing.T) {
+	receipt, err := ScanPDF(buildPDF(testReceiptLines))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s scanning PDF", err)
+	}
+
+	assert.Equal(t, "SUPER EXAMPLE S.A.", receipt.Supermarket)
+	assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), receipt.Date)
+	assert.Equal(t, 3.17, receipt.Total)
+	assert.Equal(t, "EUR", receipt.Currency)
+	assert.Equal(t, 3, len(receipt.Items))
+}
+
+func TestScanPDFNoText(t *testing.T) {
+	_, err := ScanPDF(buildPDF([]string{}))
+	assert.Equal(t, ErrNoText, err)
+}
+
+func TestScanPDFInvalid(t *testing.T) {
+	_, err := ScanPDF([]byte("%PDF-1.4 broken"))
+	assert.True(t, errors.Is(err, ErrNoText))
+}
+
+func TestScanBytesPDFWithoutText(t *testing.T) {
+	t.Setenv("PDF_OCR_FALLBACK", "")
+
+	// PDF files without text are always sent to Textract, which is stopped by the guard
+	errStop := errors.New("Textract reached")
+	guard := func() error {
+		return errStop
+	}
+
+	_, pages, err := ScanBytesGuarded(nil, buildPDF([]string{}), guard)
+
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, int64(0), pages)
+}
+
+func TestScanBytesPDFNotParsed(t *testing.T) {
+	t.Setenv("PDF_OCR_FALLBACK", "")
+
+	// Textract must not be used, so the scan is stopped if it is reached
+	guard := func() error {
+		t.Fatalf("Unexpected scan with Textract")
+		return nil
+	}
+
+	_, pages, err := ScanBytesGuarded(nil, buildPDF([]string{"SUPER EXAMPLE", "No date here"}), guard)
+
+	assert.NotNil(t, err, "Expected error reading PDF without date")
+	assert.Equal(t, int64(0), pages)
+}
+
+func TestPDFOCRFallback(t *testing.T) {
+	t.Setenv("PDF_OCR_FALLBACK", "")
+	assert.False(t, PDFOCRFallback())
+
+	t.Setenv("PDF_OCR_FALLBACK", "true")
+	assert.True(t, PDFOCRFallback())
+}
+
+func TestParseText(t *testing.T) {
+	receipt, err := ParseText(testReceiptLines)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %s parsing text", err)
+	}
+
+	assert.Equal(t, "LECHE ENTERA", receipt.Items[0].Name)
+	assert.Equal(t, 1.0, receipt.Items[0].Quantity)
+	assert.Equal(t, 1.15, receipt.Items[0].Price)
+	assert.Equal(t, "YOGUR NATURAL", receipt.Items[1].Name)
+	assert.Equal(t, 2.0, receipt.Items[1].Quantity)
+	assert.Equal(t, 0.5, receipt.Items[1].UnitPrice)
+	assert.Equal(t, 1.0, receipt.Items[1].Price)
+	assert.Equal(t, "PLATANO", receipt.Items[2].Name)
+	assert.Equal(t, 0.512, receipt.Items[2].Quantity)
+	assert.Equal(t, 1.99, receipt.Items[2].UnitPrice)
+	assert.Equal(t, 1.02, receipt.Items[2].Price)
+}
+
+func TestParseTextMissingTotal(t *testing.T) {
+	_, err := ParseText(testReceiptLines[:6])
+	assert.Equal(t, "Total not found", err.Error())
+}
+
+func TestParseTextMissingDate(t *testing.T) {
+	_, err := ParseText([]string{"SUPER", "LECHE 1,15", "TOTAL 1,15"})
+	assert.Equal(t, "Date not found", err.Error())
+}
+
+func TestParseDate(t *testing.T) {
+	for _, value := range []string{"31/01/2024", "31-01-2024", "31.01.24", "31,01,24"} {
+		date, err := parseDate(value)
+		assert.Nil(t, err, "Unexpected error parsing %s", value)
+		assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), date, value)
+	}
+
+	_, err := parseDate("111")
+	assert.NotNil(t, err)
+}
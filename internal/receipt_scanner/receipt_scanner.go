@@ -1,9 +1,12 @@
 package receipt_scanner
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	mime "mime/multipart"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -14,6 +17,9 @@ import (
 	"github.com/cbolanos79/shoppingbag_tracker/internal/model"
 )
 
+// Amount with decimals, like 1,25 or 1.25
+var amountExp = regexp.MustCompile(`\d+(\,|\.)\d+`)
+
 func NewAwsSession() (*session.Session, error) {
 	aws_session, err := session.NewSession()
 
@@ -34,6 +40,28 @@ func logReceiptError(receipt *model.Receipt, msg string, err error, line ...int)
 	log.Print(s)
 }
 
+// Parse receipt date with format dd/mm/yyyy, dd-mm-yyyy or dd.mm.yy
+func parseDate(value string) (time.Time, error) {
+	value = strings.Replace(value, ",", ".", -1)
+
+	// Sometimes, a receipt can have date with format dd.mm.yy due bad quality image or any other problems, which can be a problem to parse
+	// Therefore, check if date has this format and parse with the right layout
+	pattern := regexp.MustCompile(`^\d{1,2}\.\d{1,2}\.\d{1,2}$`)
+
+	if pattern.MatchString(value) {
+		return time.Parse("02.01.06", value)
+	}
+
+	value = strings.NewReplacer("-", "/", ".", "/").Replace(value)
+
+	return time.Parse("02/01/2006", value)
+}
+
+// Parse amount with comma or dot as decimal separator
+func parseAmount(value string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(value, ",", ".", -1), 64)
+}
+
 // Auxiliar function to search string into an array of textract.ExpenseField
 func SearchExpense(item []*textract.ExpenseField, s string) string {
 	for _, item := range item {
@@ -61,18 +89,58 @@ func SearchCurrency(item []*textract.ExpenseField) string {
 
 // Analyze ticket on Textract using OCR and AI, and get in response structured information about receipt
 func Scan(aws_session *session.Session, file mime.File, size int64) (*model.Receipt, error) {
-
-	// Create object to e
-	svc := textract.New(aws_session)
-
 	// Allocate enough space to read file
 	b := make([]byte, size)
-	_, err := file.Read(b)
+	_, err := io.ReadFull(file, b)
 
 	if err != nil {
 		return nil, err
 	}
 
+	return ScanBytes(aws_session, b)
+}
+
+// Check if digital PDF files whose text can not be parsed must be sent to Textract, configured by PDF_OCR_FALLBACK
+func PDFOCRFallback() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("PDF_OCR_FALLBACK"))
+	return err == nil && enabled
+}
+
+// Analyze ticket content already read, used when files do not come from a form, like archives or folders
+// Digital PDF files are read from their text, and only sent to Textract when they have no text
+func ScanBytes(aws_session *session.Session, b []byte) (*model.Receipt, error) {
+	receipt, _, err := ScanBytesGuarded(aws_session, b, nil)
+	return receipt, err
+}
+
+// Analyze ticket content like ScanBytes, returning number of pages analyzed by Textract, which are charged even if receipt can not be read
+// Function guard is called before sending file to Textract, and stops the scan if it returns an error
+func ScanBytesGuarded(aws_session *session.Session, b []byte, guard func() error) (*model.Receipt, int64, error) {
+	if IsPDF(b) {
+		receipt, err := ScanPDF(b)
+		if err == nil {
+			return receipt, 0, nil
+		}
+
+		if errors.Is(err, ErrNoText) {
+			log.Printf("ScanBytes - Error reading PDF text, using OCR\n%v", err)
+		} else if !PDFOCRFallback() {
+			// Textract is charged, so digital PDF files are not sent to it unless PDF_OCR_FALLBACK is enabled
+			return nil, 0, fmt.Errorf("Error reading PDF text: %w", err)
+		} else {
+			log.Printf("ScanBytes - Error parsing PDF text, using OCR\n%v", err)
+		}
+	}
+
+	if guard != nil {
+		if err := guard(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// Create object to e
+	svc := textract.New(aws_session)
+
 	// Make request to Textract in order to analyze data
 	res, err := svc.AnalyzeExpense(&textract.AnalyzeExpenseInput{
 		Document: &textract.Document{
@@ -81,50 +149,45 @@ func Scan(aws_session *session.Session, file mime.File, size int64) (*model.Rece
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	// Pictures have a single page
+	var pages int64 = 1
+	if res.DocumentMetadata != nil && res.DocumentMetadata.Pages != nil {
+		pages = *res.DocumentMetadata.Pages
 	}
 
+	receipt, err := parseExpense(res)
+	return receipt, pages, err
+}
+
+// Read receipt from Textract response
+func parseExpense(res *textract.AnalyzeExpenseOutput) (*model.Receipt, error) {
+	var err error
+
 	// Get supermarket name
 	s := *res.ExpenseDocuments[0].SummaryFields[0].ValueDetection.Text
 	sres := strings.Split(s, "\n")
 	receipt := &model.Receipt{}
 	receipt.Supermarket = sres[0]
 
-	receipt_date := strings.Replace(SearchExpense(res.ExpenseDocuments[0].SummaryFields, "INVOICE_RECEIPT_DATE"), ",", ".", -1)
-	var date time.Time
+	receipt_date := SearchExpense(res.ExpenseDocuments[0].SummaryFields, "INVOICE_RECEIPT_DATE")
 
-	// Sometimes, a receipt can have date with format dd.mm.yy due bad quality image or any other problems, which can be a problem to parse
-	// Therefore, check if date has this format and parse with the right layout
-	pattern := regexp.MustCompile(`^\d{1,2}\.\d{1,2}\.\d{1,2}$`)
-
-	if pattern.FindIndex([]byte(receipt_date)) == nil {
-		receipt_date = strings.Replace(receipt_date, "-", "/", -1)
-
-		date, err = time.Parse("02/01/2006", receipt_date)
-
-		if err != nil {
-			logReceiptError(receipt, fmt.Sprintf("date field with format dd/mm/yyyy: %s", receipt_date), err)
-			return nil, err
-		}
-	} else {
-		date, err = time.Parse("02.01.06", receipt_date)
-
-		if err != nil {
-			logReceiptError(receipt, fmt.Sprintf("date field with format dd.mm.yy: %s", receipt_date), err)
-			return nil, err
-		}
+	date, err := parseDate(receipt_date)
+	if err != nil {
+		logReceiptError(receipt, fmt.Sprintf("date field: %s", receipt_date), err)
+		return nil, err
 	}
 
 	receipt.Date = date
 
 	// Get total amount from receipt
 	stotal := SearchExpense(res.ExpenseDocuments[0].SummaryFields, "TOTAL")
-	amount_exp := regexp.MustCompile(`\d+(\,|\.)\d+`)
-
-	total := amount_exp.Find([]byte(stotal))
+	total := amountExp.Find([]byte(stotal))
 	if total == nil {
 		log.Printf("error parsing total amount: %s", stotal)
-		return nil, err
+		return nil, fmt.Errorf("invalid total amount: %s", stotal)
 	}
 
 	receipt.Total, err = strconv.ParseFloat(strings.Replace(string(total), ",", ".", -1), 64)
@@ -155,7 +218,7 @@ func Scan(aws_session *session.Session, file mime.File, size int64) (*model.Rece
 			quantity, err = strconv.ParseFloat(strings.Replace(string(squantity), ",", ".", -1), 64)
 			if err != nil {
 				// Extract numeric value for quantity because sometimes it's an items weight instead a numeric value
-				rquantity := amount_exp.Find([]byte(squantity))
+				rquantity := amountExp.Find([]byte(squantity))
 				quantity, err = strconv.ParseFloat(strings.Replace(string(rquantity), ",", ".", -1), 64)
 
 				if rquantity == nil {
@@ -180,7 +243,7 @@ func Scan(aws_session *session.Session, file mime.File, size int64) (*model.Rece
 		sunit_price := SearchExpense(line_item.LineItemExpenseFields, "UNIT_PRICE")
 		var unit_price float64
 		if len(sunit_price) > 0 {
-			runit_price := amount_exp.Find([]byte(sunit_price))
+			runit_price := amountExp.Find([]byte(sunit_price))
 
 			if runit_price == nil {
 				logReceiptError(receipt, fmt.Sprintf("unit price: %s", sunit_price), err, index)
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrStorageDisabled = errors.New("Storage of original files is not configured")
+
+// Return folder where original files of receipts are kept, configured by STORAGE_DIR
+// Files are not kept if it is empty
+func Dir() string {
+	return os.Getenv("STORAGE_DIR")
+}
+
+// Keep original file of a receipt of user, returning its path relative to storage folder
+// Files are named by their content, so the same file is only stored once
+func Save(user_id int64, name string, data []byte) (string, error) {
+	dir := Dir()
+	if len(dir) == 0 {
+		return "", ErrStorageDisabled
+	}
+
+	sum := sha256.Sum256(data)
+	relative := filepath.Join(fmt.Sprint(user_id), hex.EncodeToString(sum[:])+strings.ToLower(filepath.Ext(name)))
+	full := filepath.Join(dir, relative)
+
+	if err := os.MkdirAll(filepath.Dir(full), 0o750); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(full, data, 0o640); err != nil {
+		return "", err
+	}
+
+	return relative, nil
+}
+
+// Read a file kept with Save
+func Read(relative string) ([]byte, error) {
+	dir := Dir()
+	if len(dir) == 0 {
+		return nil, ErrStorageDisabled
+	}
+
+	if !filepath.IsLocal(relative) {
+		return nil, fmt.Errorf("Invalid storage path %s", relative)
+	}
+
+	return os.ReadFile(filepath.Join(dir, relative))
+}
+
+// Remove every file kept for user
+func RemoveUser(user_id int64) error {
+	dir := Dir()
+	if len(dir) == 0 {
+		return nil
+	}
+
+	return os.RemoveAll(filepath.Join(dir, fmt.Sprint(user_id)))
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndRead(t *testing.T) {
+	t.Setenv("STORAGE_DIR", t.TempDir())
+
+	path, err := Save(3, "Receipt.PDF", []byte("receipt"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s saving file", err)
+	}
+
+	assert.Regexp(t, `^3/[0-9a-f]{64}\.pdf$`, path)
+
+	data, err := Read(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("receipt"), data)
+}
+
+func TestSaveDisabled(t *testing.T) {
+	t.Setenv("STORAGE_DIR", "")
+
+	_, err := Save(3, "receipt.pdf", []byte("receipt"))
+	assert.ErrorIs(t, err, ErrStorageDisabled)
+}
+
+func TestReadOutsideStorage(t *testing.T) {
+	t.Setenv("STORAGE_DIR", t.TempDir())
+
+	_, err := Read("../secret")
+	assert.NotNil(t, err)
+}
+
+func TestRemoveUser(t *testing.T) {
+	t.Setenv("STORAGE_DIR", t.TempDir())
+
+	path, err := Save(3, "receipt.jpg", []byte("receipt"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s saving file", err)
+	}
+
+	assert.Nil(t, RemoveUser(3))
+
+	_, err = Read(path)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,52 @@
+import { API_URL } from './constants.js'
+
+/*
+    Exchange stored refresh token for new tokens, returning false if session is no longer valid
+    Refresh tokens can only be used once, so the new one is stored
+*/
+async function refreshAuthToken() {
+    const refreshToken = sessionStorage.getItem("refreshtoken")
+    if (!refreshToken) {
+        return false
+    }
+
+    const response = await fetch(`${API_URL}/auth/refresh`, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json"
+        },
+        body: JSON.stringify({refresh_token: refreshToken})
+    })
+
+    if (!response.ok) {
+        return false
+    }
+
+    const data = await response.json()
+    sessionStorage.setItem("authtoken", data.auth_token)
+    sessionStorage.setItem("refreshtoken", data.refresh_token)
+
+    return true
+}
+
+/*
+    Fetch API url with auth token, refreshing it once if it is expired
+*/
+async function authFetch(url, options = {}) {
+    const request = () => fetch(url, {
+        ...options,
+        headers: {
+            ...options.headers,
+            "Authorization": "Bearer " + sessionStorage.getItem("authtoken")
+        }
+    })
+
+    const response = await request()
+    if (response.status == 401 && await refreshAuthToken()) {
+        return request()
+    }
+
+    return response
+}
+
+export { authFetch }
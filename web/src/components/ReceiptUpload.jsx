@@ -3,6 +3,7 @@ import Button from 'react-bootstrap/Button';
 import Form from 'react-bootstrap/Form';
 import Logout from '../logout.jsx'
 import { CLIENT_ID, API_URL } from '../constants.js'
+import { authFetch } from '../auth.js'
 
 /*
   Component to render a form which sends a post request with form data,
@@ -32,14 +33,11 @@ export default class ReceiptUpload extends Component {
         const formData = new FormData()
         formData.append('file', file)
 
-        await fetch(`${API_URL}/receipt`,
+        await authFetch(`${API_URL}/receipt`,
             {
                 method: "POST",
                 mode: "cors",
                 body: formData,
-                headers: {
-                    "Authorization": "Bearer " + sessionStorage.getItem("authtoken")
-                }
             }
         ).
         then((response) => {
@@ -36,6 +36,7 @@ export default function Login() {
             }).
           then(data => {
             sessionStorage.setItem("authtoken", data.auth_token)
+            sessionStorage.setItem("refreshtoken", data.refresh_token)
             sessionStorage.setItem("profile_picture", data.picture_url)
             sessionStorage.setItem("name", data.name)
 
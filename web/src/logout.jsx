@@ -1,9 +1,22 @@
 import {
     Navigate
 } from "react-router-dom"
+import { API_URL } from './constants.js'
 
 export default function Logout() {
+    // Revoke session in API, so its tokens can not be used again
+    const authToken = sessionStorage.getItem("authtoken")
+    if (authToken) {
+        fetch(`${API_URL}/auth/logout`, {
+            method: "POST",
+            headers: {
+                "Authorization": "Bearer " + authToken
+            }
+        }).catch(error => console.error(error.toString()))
+    }
+
     sessionStorage.removeItem("authtoken")
+    sessionStorage.removeItem("refreshtoken")
     sessionStorage.removeItem("name")
     sessionStorage.removeItem("profile_picture")
   
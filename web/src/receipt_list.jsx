@@ -8,6 +8,7 @@ import Button from 'react-bootstrap/Button'
 
 import ReceiptDetail from './components/ReceiptDetail.jsx'
 import { API_URL } from './constants.js'
+import { authFetch } from './auth.js'
 
 function ReceiptList() {    
 
@@ -17,13 +18,10 @@ function ReceiptList() {
     const [showDetail, setShowDetail] = useState(false)
 
     async function showReceiptDetail(id) {
-        await fetch(`${API_URL}/receipts/${id}`,
+        await authFetch(`${API_URL}/receipts/${id}`,
         {
             method: "GET",
             mode: "cors",
-            headers: {
-                "Authorization": "Bearer " + sessionStorage.getItem("authtoken")
-            }
         }
         ).
         then((response) => {
@@ -95,12 +93,9 @@ function ReceiptList() {
         const url = `${API_URL}/receipts`
 
         // Fetch data from API
-        fetch(`${url}?${params.toString()}`, {
+        authFetch(`${url}?${params.toString()}`, {
             method: "GET",
             mode: "cors",
-            headers: {
-                "Authorization": "Bearer " + sessionStorage.getItem("authtoken"),
-            }
         }
         ).
         then((response) => {